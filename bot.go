@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/database"
 	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/BoltzExchange/channel-bot/notifications/providers/outbox"
+	"github.com/BoltzExchange/channel-bot/notifications/templates"
 	"github.com/BoltzExchange/channel-bot/utils"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 
 	"github.com/google/logger"
 )
@@ -14,36 +21,97 @@ func main() {
 	initLogger(cfg.LogFile)
 	logConfig(cfg)
 
-	lndInfo := initLnd(cfg)
-	provider := getNotificationProvider(cfg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	err := provider.SendMessage("Started channel bot with LND node: **" + lndInfo.Alias + "** (`" + lndInfo.IdentityPubkey + "`)")
+	err := cfg.Notifications.ParseBalanceModel()
+	checkError("balance model", err)
+
+	err = cfg.Notifications.ParseRules()
+	checkError("notification rules", err)
+
+	err = cfg.Notifications.ParseConditions()
+	checkError("notification conditions", err)
+
+	err = cfg.Notifications.ParseSignificantChannels(cfg.SignificantChannels)
+	checkError("significant channels", err)
+
+	err = cfg.Notifications.ParseSignificantPeers()
+	checkError("significant peers", err)
+
+	err = cfg.ChannelCleaner.ParseCloseStrategy()
+	checkError("close strategy", err)
+
+	lndInfo := initLnd(ctx, cfg)
+	db := initDatabase(cfg)
+	provider := getNotificationProvider(cfg, db)
+
+	err = provider.SendEvent(&providers.Event{
+		Type:     providers.EventStarted,
+		Severity: providers.SeverityInfo,
+		Title:    "Started channel bot",
+		Peer: &providers.Peer{
+			Pubkey: lndInfo.IdentityPubkey,
+			Alias:  lndInfo.Alias,
+		},
+	})
 	checkError("Notification provider", err)
 
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
-		cfg.Notifications.Init(cfg.SignificantChannels, cfg.LogInsignificant, cfg.Lnd, provider)
+		cfg.Notifications.Init(ctx, cfg.SignificantChannels, cfg.LogInsignificant, cfg.Lnd, provider, db)
 		wg.Done()
 	}()
 
 	go func() {
-		cfg.ChannelCleaner.Init(cfg.Lnd, provider)
+		cfg.ChannelCleaner.Init(ctx, cfg.Lnd, provider)
 		wg.Done()
 	}()
 
-	wg.Wait()
+	<-ctx.Done()
+
+	// Restore the default signal handling so that another signal kills the bot right away
+	stop()
+
 	logger.Info("Shutting down")
+	wg.Wait()
+
+	shutdown(provider, db)
+}
+
+func shutdown(provider providers.NotificationProvider, db *database.Database) {
+	err := provider.SendEvent(&providers.Event{
+		Type:     providers.EventStopped,
+		Severity: providers.SeverityWarning,
+		Title:    "Stopped channel bot",
+	})
+	if err != nil {
+		logger.Warning("Could not send shutdown message: " + err.Error())
+	}
+
+	// Closing the provider sends the notifications that are still queued
+	err = provider.Close()
+	if err != nil {
+		logger.Warning("Could not close notification provider: " + err.Error())
+	}
+
+	err = db.Close()
+	if err != nil {
+		logger.Warning("Could not close database: " + err.Error())
+	}
+
+	logger.Info("Shut down")
 }
 
-func initLnd(cfg *config) *lnrpc.GetInfoResponse {
+func initLnd(ctx context.Context, cfg *config) *lnrpc.GetInfoResponse {
 	logger.Info("Initializing LND client")
 
 	err := cfg.Lnd.Connect()
 	checkError("LND", err)
 
-	lndInfo, err := cfg.Lnd.GetInfo()
+	lndInfo, err := cfg.Lnd.GetInfo(ctx)
 	checkError("LND", err)
 
 	lndInfo.Features = nil
@@ -52,28 +120,44 @@ func initLnd(cfg *config) *lnrpc.GetInfoResponse {
 	return lndInfo
 }
 
-func getNotificationProvider(cfg *config) providers.NotificationProvider {
-	logger.Info("Initializing notification provider client")
-
-	for _, provider := range []providers.NotificationProvider{
-		cfg.Mattermost,
-		cfg.Discord,
-	} {
-		initialized := initNotificationProvider(provider)
-		if initialized != nil {
-			return initialized
-		}
-	}
+func initDatabase(cfg *config) *database.Database {
+	logger.Info("Opening database")
+
+	err := cfg.Database.Connect()
+	checkError("database", err)
 
-	return cfg.Discord
+	logger.Info("Opened database: " + cfg.Database.Path)
+
+	return cfg.Database
 }
 
-func initNotificationProvider(provider providers.NotificationProvider) providers.NotificationProvider {
-	err := provider.Init()
-	if err != nil {
-		logger.Warningf("Could not init %s: %s\n", provider.Name(), err.Error())
-		return nil
-	}
+func getNotificationProvider(cfg *config, db *database.Database) providers.NotificationProvider {
+	logger.Info("Initializing notification provider clients")
+
+	tmpls, err := templates.Parse(cfg.Templates)
+	checkError("notification templates", err)
+
+	composite := providers.NewComposite([]*providers.Route{
+		{
+			Provider: outbox.New(cfg.Mattermost, db, cfg.Outbox, cfg.Mattermost.RateLimit),
+			Events:   cfg.Mattermost.Events,
+		},
+		{
+			Provider: outbox.New(cfg.Discord, db, cfg.Outbox, cfg.Discord.RateLimit),
+			Events:   cfg.Discord.Events,
+		},
+		{
+			Provider: cfg.File,
+			Events:   cfg.File.Events,
+		},
+	})
+
+	provider := templates.NewRenderer(composite, tmpls)
+
+	err = provider.Init()
+	checkError("notification providers", err)
+
+	logger.Info("Initialized notification providers: " + provider.Name())
 
 	return provider
 }
@@ -1,15 +1,29 @@
 package cleaner
 
 import (
+	"context"
 	"github.com/BoltzExchange/channel-bot/lnd"
 	"github.com/BoltzExchange/channel-bot/notifications/providers"
 	"github.com/google/logger"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"math"
 	"strconv"
+	"sync"
 	"time"
 )
 
+const (
+	closeStatusBroadcast = "broadcast"
+	closeStatusConfirmed = "confirmed"
+)
+
+const (
+	closeTypeCooperative = "cooperative"
+	closeTypeForce       = "force"
+)
+
+const closeTypeField = "Close type"
+
 // TODO: should significant channels be ignored?
 type ChannelCleaner struct {
 	Interval int `long:"cleaner.interval" description:"Interval in hours at which inactive channels should be checked and possibly closed. Set to 0 to disable this feature"`
@@ -17,13 +31,29 @@ type ChannelCleaner struct {
 	MaxInactive        int `long:"cleaner.maxinactive" description:"After how many days of inactivity a public channel should be force closed"`
 	MaxInactivePrivate int `long:"cleaner.maxinactiveprivate" description:"After how many days of inactivity a private channel should be force closed"`
 
+	CloseStrategy         string `long:"cleaner.closestrategy" description:"How inactive channels are closed: \"force\" or \"cooperative\", which tries a cooperative close first if the channel is active. LND can only close channels cooperatively over an active link"`
+	CooperativeFeeRate    uint64 `long:"cleaner.cooperativefeerate" description:"Fee rate in sat/vbyte of cooperative closes. Takes precedence over the confirmation target"`
+	CooperativeTargetConf int32  `long:"cleaner.cooperativetargetconf" description:"Confirmation target in blocks from which LND estimates the fee rate of cooperative closes"`
+	CooperativeTimeout    int    `long:"cleaner.cooperativetimeout" description:"Seconds to wait for the closing transaction of a cooperative close to be broadcast before the cleaner continues. The channel is force closed once LND gives up on the cooperative close. Has to be positive"`
+
+	ReconnectGracePeriod int `long:"cleaner.reconnectgraceperiod" description:"Seconds inactive channels are given to become active again after their peer was reconnected. Set to 0 to close inactive channels without trying to reconnect"`
+
+	closeStrategy closeStrategy
+
 	lnd                  lnd.LightningClient
 	notificationProvider providers.NotificationProvider
 
 	ticker *time.Ticker
+
+	// Closes whose confirmation is still being waited for
+	closes sync.WaitGroup
+
+	// Channels whose cooperative close is still being negotiated by LND after the timeout
+	negotiatingLock sync.Mutex
+	negotiating     map[uint64]bool
 }
 
-func (cleaner *ChannelCleaner) Init(lnd lnd.LightningClient, notificationProvider providers.NotificationProvider) {
+func (cleaner *ChannelCleaner) Init(ctx context.Context, lnd lnd.LightningClient, notificationProvider providers.NotificationProvider) {
 	if cleaner.Interval == 0 {
 		return
 	}
@@ -32,20 +62,32 @@ func (cleaner *ChannelCleaner) Init(lnd lnd.LightningClient, notificationProvide
 
 	cleaner.lnd = lnd
 	cleaner.notificationProvider = notificationProvider
+	cleaner.negotiating = map[uint64]bool{}
 
-	cleaner.forceCloseChannels()
+	cleaner.closeChannels(ctx)
 
 	cleaner.ticker = time.NewTicker(time.Duration(cleaner.Interval) * time.Hour)
+	defer cleaner.ticker.Stop()
 
-	for range cleaner.ticker.C {
-		cleaner.forceCloseChannels()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Stopping channel cleaner")
+
+			// The close streams end with the context
+			cleaner.closes.Wait()
+			return
+
+		case <-cleaner.ticker.C:
+			cleaner.closeChannels(ctx)
+		}
 	}
 }
 
-func (cleaner *ChannelCleaner) forceCloseChannels() {
+func (cleaner *ChannelCleaner) closeChannels(ctx context.Context) {
 	logger.Info("Cleaning inactive channels")
 
-	channels, err := cleaner.lnd.ListInactiveChannels()
+	channels, err := cleaner.lnd.ListInactiveChannels(ctx)
 
 	if err != nil {
 		logger.Error("Could not get channels: " + err.Error())
@@ -57,9 +99,15 @@ func (cleaner *ChannelCleaner) forceCloseChannels() {
 	maxInactivePublic := time.Duration(cleaner.MaxInactive) * time.Hour * 24
 	maxInactivePrivate := time.Duration(cleaner.MaxInactivePrivate) * time.Hour * 24
 
+	var zombies []*zombieChannel
+
 	for _, channel := range channels.Channels {
+		if cleaner.isNegotiating(channel.ChanId) {
+			continue
+		}
+
 		// Get the channel info from LND to find out the last time the channel was active
-		channelInfo, err := cleaner.lnd.GetChannelInfo(channel.ChanId)
+		channelInfo, err := cleaner.lnd.GetChannelInfo(ctx, channel.ChanId)
 
 		if err != nil {
 			logger.Error("Could not get channel info: " + err.Error())
@@ -86,19 +134,130 @@ func (cleaner *ChannelCleaner) forceCloseChannels() {
 			continue
 		}
 
-		cleaner.logClosingChannels(channel, lastUpdateTime)
+		zombies = append(zombies, &zombieChannel{
+			channel:    channel,
+			lastUpdate: lastUpdateTime,
+		})
+	}
 
-		// TODO: handle close client
-		_, err = cleaner.lnd.ForceCloseChannel(channel.ChannelPoint)
+	if len(zombies) == 0 {
+		return
+	}
+
+	zombies = cleaner.reconnectPeers(ctx, zombies)
+	active := cleaner.activeChannels(ctx)
+
+	for _, zombie := range zombies {
+		err = cleaner.closeChannel(ctx, zombie.channel, zombie.lastUpdate, active[zombie.channel.ChanId])
 
 		if err != nil {
-			logger.Error("Could not close channel " + lnd.FormatChannelID(channel.ChanId) + ": " + err.Error())
 			return
 		}
 	}
 }
 
-func (cleaner *ChannelCleaner) logClosingChannels(channel *lnrpc.Channel, lastUpdate time.Time) {
+type zombieChannel struct {
+	channel    *lnrpc.Channel
+	lastUpdate time.Time
+}
+
+// closeStream follows the updates that LND sends about a requested close
+type closeStream struct {
+	channel   *lnrpc.Channel
+	closeType string
+	client    lnrpc.Lightning_CloseChannelClient
+
+	// Cancels the context to which the stream is bound
+	cancel context.CancelFunc
+}
+
+type closeUpdate struct {
+	status      string
+	closingTxid string
+	err         error
+}
+
+func (cleaner *ChannelCleaner) openCloseStream(ctx context.Context, channel *lnrpc.Channel, closeType string) (*closeStream, error) {
+	streamCtx, cancel := context.WithCancel(ctx)
+
+	var client lnrpc.Lightning_CloseChannelClient
+	var err error
+
+	if closeType == closeTypeCooperative {
+		client, err = cleaner.lnd.CloseChannel(streamCtx, channel.ChannelPoint, cleaner.CooperativeFeeRate, cleaner.CooperativeTargetConf)
+	} else {
+		client, err = cleaner.lnd.ForceCloseChannel(streamCtx, channel.ChannelPoint)
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &closeStream{
+		channel:   channel,
+		closeType: closeType,
+		client:    client,
+		cancel:    cancel,
+	}, nil
+}
+
+// receiveUpdate reads the stream until the closing transaction was broadcast or confirmed, or the stream failed
+// with an error that LND only sends there
+func (stream *closeStream) receiveUpdate() *closeUpdate {
+	for {
+		update, err := stream.client.Recv()
+
+		if err != nil {
+			return &closeUpdate{err: err}
+		}
+
+		switch update := update.Update.(type) {
+		case *lnrpc.CloseStatusUpdate_ClosePending:
+			return &closeUpdate{status: closeStatusBroadcast, closingTxid: lnd.FormatTxid(update.ClosePending.Txid)}
+
+		case *lnrpc.CloseStatusUpdate_ChanClose:
+			return &closeUpdate{status: closeStatusConfirmed, closingTxid: lnd.FormatTxid(update.ChanClose.ClosingTxid)}
+		}
+	}
+}
+
+// followClose notifies about the update of the close and follows the confirmation of the closing transaction
+// in the background
+func (cleaner *ChannelCleaner) followClose(ctx context.Context, stream *closeStream, update *closeUpdate) {
+	if update.err != nil {
+		// The stream is closed when the bot is stopped
+		if ctx.Err() == nil {
+			cleaner.logCloseFailed(ctx, stream.channel, stream.closeType, update.err)
+		}
+
+		stream.cancel()
+		return
+	}
+
+	cleaner.logCloseUpdate(ctx, stream.channel, stream.closeType, update)
+
+	if update.status == closeStatusConfirmed {
+		stream.cancel()
+		return
+	}
+
+	cleaner.closes.Add(1)
+
+	go func() {
+		defer cleaner.closes.Done()
+		cleaner.followClose(ctx, stream, stream.receiveUpdate())
+	}()
+}
+
+// logClosingChannels notifies which way the channel is closed and, if it is not the configured one, why
+func (cleaner *ChannelCleaner) logClosingChannels(
+	ctx context.Context,
+	channel *lnrpc.Channel,
+	lastUpdate time.Time,
+	closeType string,
+	reason string,
+) {
 	channelType := "public"
 
 	if channel.Private {
@@ -107,9 +266,78 @@ func (cleaner *ChannelCleaner) logClosingChannels(channel *lnrpc.Channel, lastUp
 
 	lastUpdateDelta := int(math.Round(time.Since(lastUpdate).Hours() / 24))
 
-	message := "Force closing " + channelType + " channel `" + lnd.FormatChannelID(channel.ChanId) + "` to `" + lnd.GetNodeName(cleaner.lnd, channel.RemotePubkey) +
-		"` because it was inactive for " + strconv.Itoa(lastUpdateDelta) + " days"
+	nodeName := lnd.GetNodeName(ctx, cleaner.lnd, channel.RemotePubkey)
+
+	action := "Force closing"
+	if closeType == closeTypeCooperative {
+		action = "Cooperatively closing"
+	}
+
+	event := &providers.Event{
+		Type:     providers.EventZombieClose,
+		Severity: providers.SeverityWarning,
+		Title:    action + " inactive " + channelType + " channel to " + nodeName,
+		Channel: &providers.Channel{
+			ID:      channel.ChanId,
+			Private: channel.Private,
+		},
+		Peer: &providers.Peer{
+			Pubkey: channel.RemotePubkey,
+			Alias:  nodeName,
+		},
+		Fields: []*providers.Field{
+			{Name: "Inactive for", Value: strconv.Itoa(lastUpdateDelta) + " days"},
+			{Name: closeTypeField, Value: closeType},
+		},
+	}
+
+	if reason != "" {
+		event.Fields = append(event.Fields, &providers.Field{Name: "Reason", Value: reason})
+	}
 
-	logger.Info(message)
-	_ = cleaner.notificationProvider.SendMessage(message)
+	_ = cleaner.notificationProvider.SendEvent(event)
+}
+
+func (cleaner *ChannelCleaner) logCloseUpdate(ctx context.Context, channel *lnrpc.Channel, closeType string, update *closeUpdate) {
+	event := cleaner.closeEvent(ctx, channel)
+	event.Title = "Closing transaction of " + closeType + " close of channel to " + event.Peer.Alias + " was " + update.status
+	event.Fields = []*providers.Field{
+		{Name: "Status", Value: update.status},
+		{Name: closeTypeField, Value: closeType},
+		{Name: "Closing transaction", Value: update.closingTxid},
+	}
+
+	_ = cleaner.notificationProvider.SendEvent(event)
+}
+
+func (cleaner *ChannelCleaner) logCloseFailed(ctx context.Context, channel *lnrpc.Channel, closeType string, err error) {
+	logger.Error("Could not close channel " + lnd.FormatChannelID(channel.ChanId) + ": " + err.Error())
+
+	event := cleaner.closeEvent(ctx, channel)
+	event.Severity = providers.SeverityCritical
+	event.Title = "Closing channel to " + event.Peer.Alias + " failed"
+	event.Fields = []*providers.Field{
+		{Name: "Status", Value: "failed"},
+		{Name: closeTypeField, Value: closeType},
+		{Name: "Error", Value: err.Error()},
+	}
+
+	_ = cleaner.notificationProvider.SendEvent(event)
+}
+
+func (cleaner *ChannelCleaner) closeEvent(ctx context.Context, channel *lnrpc.Channel) *providers.Event {
+	nodeName := lnd.GetNodeName(ctx, cleaner.lnd, channel.RemotePubkey)
+
+	return &providers.Event{
+		Type:     providers.EventZombieCloseUpdate,
+		Severity: providers.SeverityInfo,
+		Channel: &providers.Channel{
+			ID:      channel.ChanId,
+			Private: channel.Private,
+		},
+		Peer: &providers.Peer{
+			Pubkey: channel.RemotePubkey,
+			Alias:  nodeName,
+		},
+	}
 }
@@ -1,10 +1,16 @@
 package cleaner
 
 import (
+	"context"
+	"errors"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/BoltzExchange/channel-bot/notifications/templates"
 	"github.com/google/logger"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"io"
 	"strings"
 	"testing"
 	"time"
@@ -23,6 +29,7 @@ func (m *MockWriter) Write(p []byte) (n int, err error) {
 type MockDiscordClient struct{}
 
 var sentMessages []string
+var sentEvents []*providers.Event
 
 func (m *MockDiscordClient) Name() string {
 	return "Mocked discord"
@@ -32,6 +39,15 @@ func (m *MockDiscordClient) Init() error {
 	return nil
 }
 
+func (m *MockDiscordClient) Close() error {
+	return nil
+}
+
+func (m *MockDiscordClient) SendEvent(event *providers.Event) error {
+	sentEvents = append(sentEvents, event)
+	return m.SendMessage(event.Message)
+}
+
 func (m *MockDiscordClient) SendMessage(message string) error {
 	sentMessages = append(sentMessages, message)
 	return nil
@@ -39,26 +55,36 @@ func (m *MockDiscordClient) SendMessage(message string) error {
 
 type MockLndClient struct{}
 
-func (m *MockLndClient) GetInfo() (*lnrpc.GetInfoResponse, error) {
+func (m *MockLndClient) GetInfo(context.Context) (*lnrpc.GetInfoResponse, error) {
 	panic("")
 }
 
-func (m *MockLndClient) ListChannels() (*lnrpc.ListChannelsResponse, error) {
-	panic("")
+func (m *MockLndClient) ListChannels(context.Context) (*lnrpc.ListChannelsResponse, error) {
+	return &lnrpc.ListChannelsResponse{
+		Channels: append(append([]*lnrpc.Channel{}, inactiveChannelsResponse.Channels...), activeChannels...),
+	}, nil
 }
 
-func (m *MockLndClient) ClosedChannels() (*lnrpc.ClosedChannelsResponse, error) {
+func (m *MockLndClient) ClosedChannels(context.Context) (*lnrpc.ClosedChannelsResponse, error) {
 	panic("")
 }
 
 const nodeAlias = "alias"
 
-func (m *MockLndClient) GetNodeInfo(string) (*lnrpc.NodeInfo, error) {
-	return &lnrpc.NodeInfo{
+var nodeAddresses []string
+
+func (m *MockLndClient) GetNodeInfo(context.Context, string) (*lnrpc.NodeInfo, error) {
+	nodeInfo := &lnrpc.NodeInfo{
 		Node: &lnrpc.LightningNode{
 			Alias: nodeAlias,
 		},
-	}, nil
+	}
+
+	for _, address := range nodeAddresses {
+		nodeInfo.Node.Addresses = append(nodeInfo.Node.Addresses, &lnrpc.NodeAddress{Network: "tcp", Addr: address})
+	}
+
+	return nodeInfo, nil
 }
 
 var channelInfo = &lnrpc.ChannelEdge{
@@ -70,39 +96,200 @@ var channelInfo = &lnrpc.ChannelEdge{
 	},
 }
 
-func (m *MockLndClient) GetChannelInfo(uint64) (*lnrpc.ChannelEdge, error) {
+func (m *MockLndClient) GetChannelInfo(context.Context, uint64) (*lnrpc.ChannelEdge, error) {
 	return channelInfo, nil
 }
 
 var forceClosedChannels []string
+var forceCloseError error
+
+const closingTxid = "0000000000000000000000000000000000000000000000000000000000000001"
+
+func closingTxidBytes() []byte {
+	txid := make([]byte, 32)
+	txid[0] = 1
+
+	return txid
+}
+
+func defaultCloseUpdates() []*lnrpc.CloseStatusUpdate {
+	return []*lnrpc.CloseStatusUpdate{
+		{
+			Update: &lnrpc.CloseStatusUpdate_ClosePending{
+				ClosePending: &lnrpc.PendingUpdate{Txid: closingTxidBytes()},
+			},
+		},
+		{
+			Update: &lnrpc.CloseStatusUpdate_ChanClose{
+				ChanClose: &lnrpc.ChannelCloseUpdate{ClosingTxid: closingTxidBytes(), Success: true},
+			},
+		},
+	}
+}
 
-func (m *MockLndClient) ForceCloseChannel(channelPoint string) (lnrpc.Lightning_CloseChannelClient, error) {
+var closeUpdates = defaultCloseUpdates()
+
+type MockCloseClient struct {
+	grpc.ClientStream
+
+	updates []*lnrpc.CloseStatusUpdate
+
+	// Blocks until the context is cancelled or an error is released instead of ending the stream once all updates
+	// were received
+	ctx     context.Context
+	block   bool
+	release <-chan error
+}
+
+func (m *MockCloseClient) Recv() (*lnrpc.CloseStatusUpdate, error) {
+	if len(m.updates) == 0 {
+		if m.block {
+			select {
+			case <-m.ctx.Done():
+				return nil, m.ctx.Err()
+
+			case err := <-m.release:
+				return nil, err
+			}
+		}
+
+		return nil, io.EOF
+	}
+
+	update := m.updates[0]
+	m.updates = m.updates[1:]
+
+	return update, nil
+}
+
+func (m *MockLndClient) ForceCloseChannel(_ context.Context, channelPoint string) (lnrpc.Lightning_CloseChannelClient, error) {
 	forceClosedChannels = append(forceClosedChannels, channelPoint)
-	return nil, nil
+
+	if forceCloseError != nil {
+		return nil, forceCloseError
+	}
+
+	return &MockCloseClient{updates: closeUpdates}, nil
+}
+
+var cooperativelyClosedChannels []string
+var cooperativeCloseUpdates = defaultCloseUpdates()
+var blockCooperativeClose bool
+var releaseCooperativeClose chan error
+
+func (m *MockLndClient) CloseChannel(ctx context.Context, channelPoint string, _ uint64, _ int32) (lnrpc.Lightning_CloseChannelClient, error) {
+	cooperativelyClosedChannels = append(cooperativelyClosedChannels, channelPoint)
+
+	return &MockCloseClient{
+		updates: cooperativeCloseUpdates,
+		ctx:     ctx,
+		block:   blockCooperativeClose,
+		release: releaseCooperativeClose,
+	}, nil
+}
+
+var connectedPeers []string
+
+func (m *MockLndClient) ListPeers(context.Context) (*lnrpc.ListPeersResponse, error) {
+	peers := &lnrpc.ListPeersResponse{}
+
+	for _, pubkey := range connectedPeers {
+		peers.Peers = append(peers.Peers, &lnrpc.Peer{PubKey: pubkey})
+	}
+
+	return peers, nil
+}
+
+var connectAttempts []string
+var reachableAddress string
+
+// Whether the channels of a peer become active again or are closed once it is reconnected
+var activeAfterReconnect bool
+var closedAfterReconnect bool
+
+var activeChannels []*lnrpc.Channel
+
+func (m *MockLndClient) ConnectPeer(_ context.Context, pubkey string, host string) error {
+	connectAttempts = append(connectAttempts, host)
+
+	if host != reachableAddress {
+		return errors.New("connection refused")
+	}
+
+	if activeAfterReconnect || closedAfterReconnect {
+		var inactive []*lnrpc.Channel
+
+		for _, channel := range inactiveChannelsResponse.Channels {
+			switch {
+			case channel.RemotePubkey != pubkey:
+				inactive = append(inactive, channel)
+
+			case activeAfterReconnect:
+				activeChannels = append(activeChannels, &lnrpc.Channel{
+					ChanId:       channel.ChanId,
+					RemotePubkey: channel.RemotePubkey,
+					ChannelPoint: channel.ChannelPoint,
+					Active:       true,
+				})
+			}
+		}
+
+		inactiveChannelsResponse = &lnrpc.ListChannelsResponse{Channels: inactive}
+	}
+
+	return nil
 }
 
 var inactiveChannelsResponse = &lnrpc.ListChannelsResponse{}
 
-func (m *MockLndClient) ListInactiveChannels() (*lnrpc.ListChannelsResponse, error) {
+func (m *MockLndClient) PendingChannels(context.Context) (*lnrpc.PendingChannelsResponse, error) {
+	panic("")
+}
+
+func (m *MockLndClient) ForwardingHistory(context.Context, uint64, uint32) (*lnrpc.ForwardingHistoryResponse, error) {
+	panic("")
+}
+
+func (m *MockLndClient) GetTransactions(context.Context, int32) (*lnrpc.TransactionDetails, error) {
+	panic("")
+}
+
+func (m *MockLndClient) ListInactiveChannels(context.Context) (*lnrpc.ListChannelsResponse, error) {
 	return inactiveChannelsResponse, nil
 }
 
-func (m *MockLndClient) SubscribeInvoices(chan<- *lnrpc.Invoice, chan<- error) {
+func (m *MockLndClient) SubscribeInvoices(context.Context, chan<- *lnrpc.Invoice, chan<- error, chan<- struct{}) {
 	panic("implement me")
 }
 
-func (m *MockLndClient) SubscribeHtlcEvents(chan<- *routerrpc.HtlcEvent, chan<- error) {
+func (m *MockLndClient) SubscribeHtlcEvents(context.Context, chan<- *routerrpc.HtlcEvent, chan<- error, chan<- struct{}) {
 	panic("implement me")
 }
 
-func (m *MockLndClient) SubscribeChannelEvents(chan<- *lnrpc.ChannelEventUpdate, chan<- error) {
+func (m *MockLndClient) SubscribeChannelEvents(context.Context, chan<- *lnrpc.ChannelEventUpdate, chan<- error, chan<- struct{}) {
 	panic("implement me")
 }
 
 func cleanUp() {
+	// Confirmations of closes of previous tests are followed in the background
+	cleaner.closes.Wait()
+
 	sentMessages = sentMessages[:0]
+	sentEvents = sentEvents[:0]
 	loggedMessages = loggedMessages[:0]
 	forceClosedChannels = forceClosedChannels[:0]
+	forceCloseError = nil
+	closeUpdates = defaultCloseUpdates()
+	cooperativelyClosedChannels = cooperativelyClosedChannels[:0]
+	cooperativeCloseUpdates = defaultCloseUpdates()
+	blockCooperativeClose = false
+	connectedPeers = nil
+	activeChannels = nil
+	closedAfterReconnect = false
+	nodeAddresses = nil
+	connectAttempts = connectAttempts[:0]
+	reachableAddress = ""
+	activeAfterReconnect = false
 }
 
 var cleaner = ChannelCleaner{
@@ -118,10 +305,14 @@ func TestInit(t *testing.T) {
 	logger.Init("", false, false, mockWriter)
 
 	lnd := &MockLndClient{}
-	discord := &MockDiscordClient{}
+	discord := templates.NewRenderer(&MockDiscordClient{}, templates.Default())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
 
 	go func() {
-		cleaner.Init(lnd, discord)
+		cleaner.Init(ctx, lnd, discord)
+		close(stopped)
 	}()
 
 	time.Sleep(time.Duration(10) * time.Millisecond)
@@ -131,14 +322,22 @@ func TestInit(t *testing.T) {
 	assert.True(t, strings.HasSuffix(loggedMessages[0], "Starting channel cleaner\n"), "Does not send log message on startup")
 	assert.True(t, strings.HasSuffix(loggedMessages[1], "Cleaning inactive channels\n"), "Does not execute cleaning routine on startup")
 
-	cleaner.ticker.Stop()
+	cancel()
+
+	select {
+	case <-stopped:
+		break
+
+	case <-time.After(time.Second):
+		assert.Fail(t, "Does not stop after the context was cancelled")
+	}
 
 	// Make sure nothing was initialized if the channel cleaner service is disabled
 	zeroIntervalCleaner := ChannelCleaner{
 		Interval: 0,
 	}
 
-	zeroIntervalCleaner.Init(lnd, discord)
+	zeroIntervalCleaner.Init(context.Background(), lnd, discord)
 
 	assert.Nil(t, zeroIntervalCleaner.lnd)
 	assert.Nil(t, zeroIntervalCleaner.ticker)
@@ -148,17 +347,18 @@ func TestInit(t *testing.T) {
 
 func testForceClose(t *testing.T) {
 	// Should force close channel
-	cleaner.forceCloseChannels()
+	cleaner.closeChannels(context.Background())
+	cleaner.closes.Wait()
 
 	assert.Equal(t, inactiveChannelsResponse.Channels[0].ChannelPoint, forceClosedChannels[0], "Did not force close channel that has not been updated for longer than the max inactive time")
-	assert.True(t, len(sentMessages) == 1 && len(loggedMessages) == 2, "Did not log channel closure")
+	assert.True(t, len(sentMessages) == 3 && len(loggedMessages) == 4, "Did not log channel closure and its updates")
 
 	// Should not force close because the last update of node 2 is not old enough
 	channelInfo.Node2Policy.LastUpdate = uint32(time.Now().Unix())
 
-	cleaner.forceCloseChannels()
+	cleaner.closeChannels(context.Background())
 
-	assert.True(t, len(forceClosedChannels) == 1 && len(sentMessages) == 1, "Did force close channel although the node 2 update is not old enough")
+	assert.True(t, len(forceClosedChannels) == 1 && len(sentMessages) == 3, "Did force close channel although the node 2 update is not old enough")
 
 	cleanUp()
 }
@@ -206,7 +406,7 @@ func TestForceCloseChannels(t *testing.T) {
 	channelInfo.Node1Policy.LastUpdate = tooOldPublic
 	channelInfo.Node2Policy.LastUpdate = tooOldPublic
 
-	cleaner.forceCloseChannels()
+	cleaner.closeChannels(context.Background())
 
 	assert.Len(t, forceClosedChannels, 0, "Did force private because max timeout of public channels was used")
 
@@ -232,7 +432,7 @@ func TestForceCloseChannels(t *testing.T) {
 		},
 	}
 
-	cleaner.forceCloseChannels()
+	cleaner.closeChannels(context.Background())
 
 	assert.Equal(t, inactiveChannelsResponse.Channels[1].ChannelPoint, forceClosedChannels[0], "Loop was cancelled after first inactive channel that was not force closed")
 
@@ -251,7 +451,7 @@ func TestLogClosingChannels(t *testing.T) {
 	daysAgo := 90
 	lastUpdate := time.Now().AddDate(0, 0, -daysAgo)
 
-	cleaner.logClosingChannels(channel, lastUpdate)
+	cleaner.logClosingChannels(context.Background(), channel, lastUpdate, closeTypeForce, "")
 
 	expectedMessage := "Force closing public channel `145135534931969` to `alias` because it was inactive for 90 days"
 
@@ -261,10 +461,312 @@ func TestLogClosingChannels(t *testing.T) {
 	channel.Private = true
 	expectedMessage = strings.Replace(expectedMessage, "public", "private", 1)
 
-	cleaner.logClosingChannels(channel, lastUpdate)
+	cleaner.logClosingChannels(context.Background(), channel, lastUpdate, closeTypeForce, "")
 
 	assert.Equal(t, expectedMessage, sentMessages[1], "Message sent before closing is invalid: "+sentMessages[0])
 	assert.True(t, strings.HasSuffix(loggedMessages[1], sentMessages[1]+"\n"))
 
 	cleanUp()
 }
+
+func testCloseStream(channel *lnrpc.Channel, updates []*lnrpc.CloseStatusUpdate) *closeStream {
+	return &closeStream{
+		channel:   channel,
+		closeType: closeTypeForce,
+		client:    &MockCloseClient{updates: updates},
+		cancel:    func() {},
+	}
+}
+
+func initTestCleaner() {
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	cleaner.lnd = &MockLndClient{}
+	cleaner.notificationProvider = templates.NewRenderer(&MockDiscordClient{}, templates.Default())
+	cleaner.negotiating = map[uint64]bool{}
+}
+
+func TestFollowClose(t *testing.T) {
+	cleanUp()
+	initTestCleaner()
+
+	channel := &lnrpc.Channel{
+		ChanId:       1,
+		RemotePubkey: "pubkey",
+	}
+
+	ctx := context.Background()
+
+	// Broadcast and confirmation of the closing transaction
+	stream := testCloseStream(channel, defaultCloseUpdates())
+	cleaner.followClose(ctx, stream, stream.receiveUpdate())
+	cleaner.closes.Wait()
+
+	assert.Len(t, sentEvents, 2)
+	assert.Equal(t, providers.EventZombieCloseUpdate, sentEvents[0].Type)
+	assert.Equal(t, "Closing transaction of force close of channel to alias was broadcast", sentEvents[0].Title)
+	assert.Equal(t, "Closing transaction of force close of inactive channel `1` to `alias` was **broadcast**: `"+closingTxid+"`", sentMessages[0])
+	assert.Equal(t, "Closing transaction of force close of inactive channel `1` to `alias` was **confirmed**: `"+closingTxid+"`", sentMessages[1])
+
+	cleanUp()
+
+	// Errors that are only sent on the stream
+	stream = testCloseStream(channel, nil)
+	cleaner.followClose(ctx, stream, stream.receiveUpdate())
+	cleaner.closes.Wait()
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, providers.SeverityCritical, sentEvents[0].Severity)
+	assert.Equal(t, ":rotating_light: Closing inactive channel `1` to `alias` **failed**: EOF :rotating_light:", sentMessages[0])
+
+	cleanUp()
+
+	// The stream ending because the bot is stopped is no failed close
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	stream = testCloseStream(channel, defaultCloseUpdates()[:1])
+	cleaner.followClose(cancelledCtx, stream, stream.receiveUpdate())
+	cleaner.closes.Wait()
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, closeStatusBroadcast, sentEvents[0].Fields[0].Value)
+
+	cleanUp()
+}
+
+func TestForceCloseChannelError(t *testing.T) {
+	cleanUp()
+	initTestCleaner()
+
+	inactiveChannelsResponse.Channels = []*lnrpc.Channel{
+		{
+			ChanId:       5,
+			RemotePubkey: "pub5",
+			ChannelPoint: "public:5",
+		},
+	}
+
+	tooOld := uint32(time.Now().AddDate(0, 0, -(cleaner.MaxInactive + 1)).Unix())
+	channelInfo.Node1Policy.LastUpdate = tooOld
+	channelInfo.Node2Policy.LastUpdate = tooOld
+
+	forceCloseError = errors.New("peer is online")
+	cleaner.closeChannels(context.Background())
+
+	assert.Len(t, sentEvents, 2)
+	assert.Equal(t, providers.EventZombieCloseUpdate, sentEvents[1].Type)
+	assert.Equal(t, "peer is online", sentEvents[1].Fields[2].Value)
+
+	inactiveChannelsResponse.Channels = nil
+	cleanUp()
+}
+
+func TestParseCloseStrategy(t *testing.T) {
+	strategyCleaner := &ChannelCleaner{}
+
+	assert.NoError(t, strategyCleaner.ParseCloseStrategy())
+	assert.Equal(t, closeStrategyForce, strategyCleaner.closeStrategy)
+
+	strategyCleaner.CloseStrategy = "Cooperative"
+	strategyCleaner.CooperativeTimeout = 300
+	assert.NoError(t, strategyCleaner.ParseCloseStrategy())
+	assert.Equal(t, closeStrategyCooperative, strategyCleaner.closeStrategy)
+
+	// Cooperative closes would time out immediately
+	strategyCleaner.CooperativeTimeout = 0
+	assert.Error(t, strategyCleaner.ParseCloseStrategy())
+
+	strategyCleaner.CooperativeTimeout = -1
+	assert.Error(t, strategyCleaner.ParseCloseStrategy())
+
+	strategyCleaner.CloseStrategy = "mutual"
+	assert.Error(t, strategyCleaner.ParseCloseStrategy())
+}
+
+func TestCooperativeClose(t *testing.T) {
+	cleanUp()
+	initTestCleaner()
+
+	cleaner.closeStrategy = closeStrategyCooperative
+	cleaner.CooperativeTimeout = 60
+
+	tooOld := time.Now().AddDate(0, 0, -(cleaner.MaxInactive + 1))
+
+	inactiveChannelsResponse.Channels = []*lnrpc.Channel{
+		{
+			ChanId:       6,
+			RemotePubkey: "pub6",
+			ChannelPoint: "public:6",
+		},
+	}
+
+	channelInfo.Node1Policy.LastUpdate = uint32(tooOld.Unix())
+	channelInfo.Node2Policy.LastUpdate = uint32(tooOld.Unix())
+
+	// Channels that are active again are closed cooperatively
+	inactiveChannelsResponse.Channels[0].Active = true
+
+	cleaner.closeChannels(context.Background())
+	cleaner.closes.Wait()
+
+	assert.Equal(t, []string{"public:6"}, cooperativelyClosedChannels)
+	assert.Empty(t, forceClosedChannels)
+
+	assert.Len(t, sentMessages, 3)
+	assert.Equal(t, "Cooperatively closing inactive public channel to alias", sentEvents[0].Title)
+	assert.Equal(t, "Cooperatively closing public channel `6` to `alias` because it was inactive for 31 days (channel is active)", sentMessages[0])
+	assert.Equal(t, "Closing transaction of cooperative close of inactive channel `6` to `alias` was **broadcast**: `"+closingTxid+"`", sentMessages[1])
+	assert.Equal(t, "Closing transaction of cooperative close of inactive channel `6` to `alias` was **confirmed**: `"+closingTxid+"`", sentMessages[2])
+
+	cleanUp()
+
+	// Inactive channels cannot be closed cooperatively and are force closed right away, even if the peer is connected
+	inactiveChannelsResponse.Channels[0].Active = false
+	connectedPeers = []string{"pub6"}
+
+	cleaner.closeChannels(context.Background())
+	cleaner.closes.Wait()
+
+	assert.Empty(t, cooperativelyClosedChannels)
+	assert.Equal(t, []string{"public:6"}, forceClosedChannels)
+	assert.Equal(t, "Force closing public channel `6` to `alias` because it was inactive for 31 days (channel is not active)", sentMessages[0])
+
+	cleanUp()
+
+	// Failed cooperative closes fall back to a force close
+	inactiveChannelsResponse.Channels[0].Active = true
+	cooperativeCloseUpdates = nil
+
+	cleaner.closeChannels(context.Background())
+	cleaner.closes.Wait()
+
+	assert.Equal(t, []string{"public:6"}, cooperativelyClosedChannels)
+	assert.Equal(t, []string{"public:6"}, forceClosedChannels)
+	assert.Len(t, sentMessages, 4)
+	assert.Equal(t, "Force closing public channel `6` to `alias` because it was inactive for 31 days (cooperative close failed: EOF)", sentMessages[1])
+
+	cleanUp()
+
+	// Cooperative closes whose closing transaction is not broadcast in time are only force closed once LND gave up
+	blockCooperativeClose = true
+	releaseCooperativeClose = make(chan error)
+	cooperativeCloseUpdates = nil
+	cleaner.CooperativeTimeout = 0
+
+	cleaner.closeChannels(context.Background())
+
+	assert.Empty(t, forceClosedChannels)
+	assert.True(t, cleaner.isNegotiating(6))
+
+	// Channels that are still being negotiated are skipped
+	cleaner.closeChannels(context.Background())
+	assert.Equal(t, []string{"public:6"}, cooperativelyClosedChannels)
+
+	releaseCooperativeClose <- errors.New("negotiation failed")
+	cleaner.closes.Wait()
+
+	assert.Equal(t, []string{"public:6"}, forceClosedChannels)
+	assert.False(t, cleaner.isNegotiating(6))
+	assert.Equal(t, "Force closing public channel `6` to `alias` because it was inactive for 31 days "+
+		"(cooperative close failed: negotiation failed)", sentMessages[1])
+
+	releaseCooperativeClose = nil
+	cleaner.closeStrategy = ""
+	cleaner.CooperativeTimeout = 0
+	inactiveChannelsResponse.Channels = nil
+	cleanUp()
+}
+
+func TestReconnectPeers(t *testing.T) {
+	cleanUp()
+	initTestCleaner()
+
+	cleaner.ReconnectGracePeriod = 1
+
+	tooOld := uint32(time.Now().AddDate(0, 0, -(cleaner.MaxInactive + 1)).Unix())
+	channelInfo.Node1Policy.LastUpdate = tooOld
+	channelInfo.Node2Policy.LastUpdate = tooOld
+
+	zombieChannels := []*lnrpc.Channel{
+		{ChanId: 7, RemotePubkey: "pub7", ChannelPoint: "public:7"},
+		{ChanId: 8, RemotePubkey: "pub7", ChannelPoint: "public:8"},
+	}
+
+	// Channels that become active again after reconnecting are not closed
+	inactiveChannelsResponse = &lnrpc.ListChannelsResponse{Channels: zombieChannels}
+	nodeAddresses = []string{"127.0.0.1:9735", "127.0.0.2:9735"}
+	reachableAddress = "127.0.0.2:9735"
+	activeAfterReconnect = true
+
+	cleaner.closeChannels(context.Background())
+
+	assert.Equal(t, nodeAddresses, connectAttempts)
+	assert.Empty(t, forceClosedChannels)
+
+	assert.Len(t, sentEvents, 3)
+	assert.Equal(t, providers.EventZombieReconnect, sentEvents[0].Type)
+	assert.Equal(t, "Reconnected to `alias` at `127.0.0.2:9735`, its inactive channels have 1s to become active again", sentMessages[0])
+	assert.Equal(t, "Inactive channel to alias is active again after reconnecting", sentEvents[1].Title)
+	assert.Equal(t, ":zap: Inactive channel `7` to `alias` is **active** again after reconnecting and is not closed", sentMessages[1])
+	assert.Equal(t, uint64(8), sentEvents[2].Channel.ID)
+
+	cleanUp()
+
+	// Channels that stay inactive after reconnecting are closed
+	inactiveChannelsResponse = &lnrpc.ListChannelsResponse{Channels: zombieChannels[:1]}
+	nodeAddresses = []string{"127.0.0.1:9735"}
+	reachableAddress = "127.0.0.1:9735"
+
+	cleaner.closeChannels(context.Background())
+	cleaner.closes.Wait()
+
+	assert.Equal(t, []string{"public:7"}, forceClosedChannels)
+	assert.Equal(t, reconnectStatusReconnected, sentEvents[0].Fields[0].Value)
+	assert.Equal(t, providers.EventZombieClose, sentEvents[1].Type)
+
+	cleanUp()
+
+	// Channels that were closed during the grace period are neither closed again nor active again
+	inactiveChannelsResponse = &lnrpc.ListChannelsResponse{Channels: zombieChannels[:1]}
+	nodeAddresses = []string{"127.0.0.1:9735"}
+	reachableAddress = "127.0.0.1:9735"
+	closedAfterReconnect = true
+
+	cleaner.closeChannels(context.Background())
+
+	assert.Empty(t, forceClosedChannels)
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, reconnectStatusReconnected, sentEvents[0].Fields[0].Value)
+
+	cleanUp()
+
+	// Peers that cannot be reconnected are closed without waiting
+	inactiveChannelsResponse = &lnrpc.ListChannelsResponse{Channels: zombieChannels[:1]}
+
+	cleaner.closeChannels(context.Background())
+	cleaner.closes.Wait()
+
+	assert.Empty(t, connectAttempts)
+	assert.Equal(t, []string{"public:7"}, forceClosedChannels)
+	assert.Equal(t, providers.SeverityWarning, sentEvents[0].Severity)
+	assert.Equal(t, "Could not reconnect to `alias` before closing its inactive channels: node announcement has no addresses", sentMessages[0])
+
+	cleanUp()
+
+	// Connected peers are not reconnected
+	inactiveChannelsResponse = &lnrpc.ListChannelsResponse{Channels: zombieChannels[:1]}
+	connectedPeers = []string{"pub7"}
+
+	cleaner.closeChannels(context.Background())
+	cleaner.closes.Wait()
+
+	assert.Empty(t, connectAttempts)
+	assert.Equal(t, []string{"public:7"}, forceClosedChannels)
+	assert.Equal(t, providers.EventZombieClose, sentEvents[0].Type)
+
+	cleaner.ReconnectGracePeriod = 0
+	inactiveChannelsResponse = &lnrpc.ListChannelsResponse{}
+	cleanUp()
+}
@@ -0,0 +1,185 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"github.com/BoltzExchange/channel-bot/lnd"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"time"
+)
+
+const (
+	reconnectStatusReconnected = "reconnected"
+	reconnectStatusFailed      = "failed"
+	reconnectStatusActive      = "active"
+)
+
+var errNoAddresses = errors.New("node announcement has no addresses")
+
+// reconnectPeers tries to connect to the peers of the zombie channels that are not connected, because some of them
+// only changed their address, and gives their channels the grace period to become active again. Returns the zombie
+// channels that should still be closed
+func (cleaner *ChannelCleaner) reconnectPeers(ctx context.Context, zombies []*zombieChannel) []*zombieChannel {
+	if cleaner.ReconnectGracePeriod == 0 {
+		return zombies
+	}
+
+	connected, err := cleaner.listPeers(ctx)
+
+	if err != nil {
+		logger.Warning("Could not get peers: " + err.Error())
+		return zombies
+	}
+
+	gracePeriod := time.Duration(cleaner.ReconnectGracePeriod) * time.Second
+	reconnected := map[string]bool{}
+
+	for _, zombie := range zombies {
+		pubkey := zombie.channel.RemotePubkey
+
+		// Peers with multiple zombie channels are only reconnected once
+		if connected[pubkey] {
+			continue
+		}
+
+		connected[pubkey] = true
+
+		address, err := cleaner.connectPeer(ctx, pubkey)
+		cleaner.logReconnect(ctx, pubkey, address, gracePeriod, err)
+
+		if err == nil {
+			reconnected[pubkey] = true
+		}
+	}
+
+	if len(reconnected) == 0 {
+		return zombies
+	}
+
+	logger.Info("Waiting " + gracePeriod.String() + " for reconnected channels to become active")
+
+	select {
+	case <-ctx.Done():
+		return nil
+
+	case <-time.After(gracePeriod):
+	}
+
+	channels, err := cleaner.lnd.ListChannels(ctx)
+
+	// Nothing is closed if it cannot be checked whether the channels are still inactive
+	if err != nil {
+		logger.Error("Could not get channels: " + err.Error())
+		return nil
+	}
+
+	open := map[uint64]*lnrpc.Channel{}
+
+	for _, channel := range channels.Channels {
+		open[channel.ChanId] = channel
+	}
+
+	var remaining []*zombieChannel
+
+	for _, zombie := range zombies {
+		if !reconnected[zombie.channel.RemotePubkey] {
+			remaining = append(remaining, zombie)
+			continue
+		}
+
+		channel := open[zombie.channel.ChanId]
+
+		switch {
+		// Channels that were closed in the meantime are notified about by the notification bot
+		case channel == nil:
+			logger.Info("Inactive channel " + lnd.FormatChannelID(zombie.channel.ChanId) + " was closed during the grace period")
+
+		case channel.Active:
+			cleaner.logReactivated(ctx, zombie.channel)
+
+		default:
+			remaining = append(remaining, zombie)
+		}
+	}
+
+	return remaining
+}
+
+// connectPeer tries the addresses of the node announcement of the peer in the graph until a connection succeeds and
+// returns the address it is connected to
+func (cleaner *ChannelCleaner) connectPeer(ctx context.Context, pubkey string) (string, error) {
+	nodeInfo, err := cleaner.lnd.GetNodeInfo(ctx, pubkey)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(nodeInfo.Node.Addresses) == 0 {
+		return "", errNoAddresses
+	}
+
+	for _, address := range nodeInfo.Node.Addresses {
+		err = cleaner.lnd.ConnectPeer(ctx, pubkey, address.Addr)
+
+		if err == nil {
+			return address.Addr, nil
+		}
+	}
+
+	return "", err
+}
+
+func (cleaner *ChannelCleaner) logReconnect(ctx context.Context, pubkey string, address string, gracePeriod time.Duration, err error) {
+	nodeName := lnd.GetNodeName(ctx, cleaner.lnd, pubkey)
+
+	event := &providers.Event{
+		Type:     providers.EventZombieReconnect,
+		Severity: providers.SeverityInfo,
+		Title:    "Reconnected to " + nodeName,
+		Peer: &providers.Peer{
+			Pubkey: pubkey,
+			Alias:  nodeName,
+		},
+		Fields: []*providers.Field{
+			{Name: "Status", Value: reconnectStatusReconnected},
+			{Name: "Address", Value: address},
+			{Name: "Grace period", Value: gracePeriod.String()},
+		},
+	}
+
+	if err != nil {
+		logger.Warning("Could not reconnect to " + pubkey + ": " + err.Error())
+
+		event.Severity = providers.SeverityWarning
+		event.Title = "Could not reconnect to " + nodeName
+		event.Fields = []*providers.Field{
+			{Name: "Status", Value: reconnectStatusFailed},
+			{Name: "Error", Value: err.Error()},
+		}
+	}
+
+	_ = cleaner.notificationProvider.SendEvent(event)
+}
+
+func (cleaner *ChannelCleaner) logReactivated(ctx context.Context, channel *lnrpc.Channel) {
+	nodeName := lnd.GetNodeName(ctx, cleaner.lnd, channel.RemotePubkey)
+
+	_ = cleaner.notificationProvider.SendEvent(&providers.Event{
+		Type:     providers.EventZombieReconnect,
+		Severity: providers.SeverityInfo,
+		Title:    "Inactive channel to " + nodeName + " is active again after reconnecting",
+		Channel: &providers.Channel{
+			ID:      channel.ChanId,
+			Private: channel.Private,
+		},
+		Peer: &providers.Peer{
+			Pubkey: channel.RemotePubkey,
+			Alias:  nodeName,
+		},
+		Fields: []*providers.Field{
+			{Name: "Status", Value: reconnectStatusActive},
+		},
+	})
+}
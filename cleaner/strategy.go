@@ -0,0 +1,212 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"github.com/BoltzExchange/channel-bot/lnd"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// closeStrategy defines how inactive channels are closed
+type closeStrategy string
+
+const (
+	// Channels are always force closed
+	closeStrategyForce closeStrategy = "force"
+
+	// A cooperative close is tried first if the channel is active, because LND can only negotiate it over an active link
+	closeStrategyCooperative closeStrategy = "cooperative"
+)
+
+// ParseCloseStrategy validates the close strategy and, for cooperative closes, their timeout
+func (cleaner *ChannelCleaner) ParseCloseStrategy() error {
+	switch strategy := closeStrategy(strings.ToLower(cleaner.CloseStrategy)); strategy {
+	case "":
+		cleaner.closeStrategy = closeStrategyForce
+
+	case closeStrategyForce:
+		cleaner.closeStrategy = strategy
+
+	case closeStrategyCooperative:
+		if cleaner.CooperativeTimeout <= 0 {
+			return errors.New("cooperative timeout has to be positive: " + strconv.Itoa(cleaner.CooperativeTimeout))
+		}
+
+		cleaner.closeStrategy = strategy
+
+	default:
+		return errors.New("unknown close strategy: " + cleaner.CloseStrategy)
+	}
+
+	return nil
+}
+
+// activeChannels returns the IDs of the channels that are active, if they are needed for the close strategy.
+// The inactive channels were listed before their peers were reconnected, so some could be active again
+func (cleaner *ChannelCleaner) activeChannels(ctx context.Context) map[uint64]bool {
+	active := map[uint64]bool{}
+
+	if cleaner.closeStrategy != closeStrategyCooperative {
+		return active
+	}
+
+	channels, err := cleaner.lnd.ListChannels(ctx)
+
+	if err != nil {
+		logger.Warning("Could not get channels: " + err.Error())
+		return active
+	}
+
+	for _, channel := range channels.Channels {
+		if channel.Active {
+			active[channel.ChanId] = true
+		}
+	}
+
+	return active
+}
+
+func (cleaner *ChannelCleaner) listPeers(ctx context.Context) (map[string]bool, error) {
+	peers, err := cleaner.lnd.ListPeers(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	connected := map[string]bool{}
+
+	for _, peer := range peers.Peers {
+		connected[peer.PubKey] = true
+	}
+
+	return connected, nil
+}
+
+// closeChannel closes the channel according to the close strategy. An error is returned if the force close could
+// not be requested
+func (cleaner *ChannelCleaner) closeChannel(ctx context.Context, channel *lnrpc.Channel, lastUpdate time.Time, isActive bool) error {
+	reason := ""
+
+	if cleaner.closeStrategy == closeStrategyCooperative {
+		if !isActive {
+			reason = "channel is not active"
+		} else {
+			cleaner.logClosingChannels(ctx, channel, lastUpdate, closeTypeCooperative, "channel is active")
+
+			err := cleaner.cooperativeClose(ctx, channel, lastUpdate)
+
+			if err == nil {
+				return nil
+			}
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			reason = cooperativeCloseFailed(channel, err)
+		}
+	}
+
+	return cleaner.forceClose(ctx, channel, lastUpdate, reason)
+}
+
+func (cleaner *ChannelCleaner) forceClose(ctx context.Context, channel *lnrpc.Channel, lastUpdate time.Time, reason string) error {
+	cleaner.logClosingChannels(ctx, channel, lastUpdate, closeTypeForce, reason)
+
+	stream, err := cleaner.openCloseStream(ctx, channel, closeTypeForce)
+
+	if err != nil {
+		cleaner.logCloseFailed(ctx, channel, closeTypeForce, err)
+		return err
+	}
+
+	cleaner.followClose(ctx, stream, stream.receiveUpdate())
+	return nil
+}
+
+// cooperativeClose waits for the closing transaction of the cooperative close to be broadcast for the configured
+// timeout. LND keeps negotiating after the timeout, so the channel is only force closed once LND gave up on the
+// cooperative close, which is waited for in the background like the confirmation of the close
+func (cleaner *ChannelCleaner) cooperativeClose(ctx context.Context, channel *lnrpc.Channel, lastUpdate time.Time) error {
+	stream, err := cleaner.openCloseStream(ctx, channel, closeTypeCooperative)
+
+	if err != nil {
+		return err
+	}
+
+	updates := make(chan *closeUpdate, 1)
+
+	go func() {
+		updates <- stream.receiveUpdate()
+	}()
+
+	timeout := time.Duration(cleaner.CooperativeTimeout) * time.Second
+
+	select {
+	case update := <-updates:
+		if update.err != nil {
+			stream.cancel()
+			return update.err
+		}
+
+		cleaner.followClose(ctx, stream, update)
+		return nil
+
+	case <-time.After(timeout):
+		logger.Warning("Closing transaction of cooperative close of channel " + lnd.FormatChannelID(channel.ChanId) +
+			" was not broadcast within " + timeout.String() + ", waiting for LND to finish negotiating")
+
+		cleaner.setNegotiating(channel.ChanId, true)
+		cleaner.closes.Add(1)
+
+		go func() {
+			defer cleaner.closes.Done()
+			defer cleaner.setNegotiating(channel.ChanId, false)
+
+			update := <-updates
+
+			if update.err == nil {
+				cleaner.followClose(ctx, stream, update)
+				return
+			}
+
+			stream.cancel()
+
+			// The stream is closed when the bot is stopped
+			if ctx.Err() != nil {
+				return
+			}
+
+			_ = cleaner.forceClose(ctx, channel, lastUpdate, cooperativeCloseFailed(channel, update.err))
+		}()
+
+		return nil
+	}
+}
+
+func (cleaner *ChannelCleaner) setNegotiating(chanId uint64, negotiating bool) {
+	cleaner.negotiatingLock.Lock()
+	defer cleaner.negotiatingLock.Unlock()
+
+	if negotiating {
+		cleaner.negotiating[chanId] = true
+	} else {
+		delete(cleaner.negotiating, chanId)
+	}
+}
+
+func (cleaner *ChannelCleaner) isNegotiating(chanId uint64) bool {
+	cleaner.negotiatingLock.Lock()
+	defer cleaner.negotiatingLock.Unlock()
+
+	return cleaner.negotiating[chanId]
+}
+
+func cooperativeCloseFailed(channel *lnrpc.Channel, err error) string {
+	logger.Warning("Could not close channel " + lnd.FormatChannelID(channel.ChanId) + " cooperatively: " + err.Error())
+	return "cooperative close failed: " + err.Error()
+}
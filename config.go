@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"github.com/BoltzExchange/channel-bot/cleaner"
+	"github.com/BoltzExchange/channel-bot/database"
 	"github.com/BoltzExchange/channel-bot/notifications/providers/discord"
+	"github.com/BoltzExchange/channel-bot/notifications/providers/file"
 	"github.com/BoltzExchange/channel-bot/notifications/providers/mattermost"
+	"github.com/BoltzExchange/channel-bot/notifications/providers/outbox"
 	"github.com/BoltzExchange/channel-bot/utils"
 	"os"
 
@@ -31,13 +34,17 @@ type config struct {
 	ChannelCleaner *cleaner.ChannelCleaner       `group:"Channel Cleaner Options"`
 
 	Lnd        *lnd.LND               `group:"LND Options"`
+	Database   *database.Database     `group:"Database Options"`
+	Outbox     *outbox.Config         `group:"Outbox Options"`
 	Discord    *discord.Discord       `group:"Discord Options"`
 	Mattermost *mattermost.Mattermost `group:"Mattermost Options"`
+	File       *file.File             `group:"File Options"`
 
 	Help *helpOptions `group:"Help Options"`
 
-	// This option is only parsed in the TOML config file
+	// These options are only parsed in the TOML config file
 	SignificantChannels []*notifications.SignificantChannel
+	Templates           map[string]string
 }
 
 func loadConfig() *config {
@@ -47,12 +54,18 @@ func loadConfig() *config {
 
 		LogInsignificant: true,
 
-		Notifications: &notifications.ChannelManager{},
+		Notifications: &notifications.ChannelManager{
+			Interval:            60,
+			InactiveGracePeriod: 600,
+			LockedFundsInterval: 24,
+		},
 
 		ChannelCleaner: &cleaner.ChannelCleaner{
-			Interval:           24,
-			MaxInactive:        30,
-			MaxInactivePrivate: 60,
+			Interval:             24,
+			MaxInactive:          30,
+			MaxInactivePrivate:   60,
+			CooperativeTimeout:   300,
+			ReconnectGracePeriod: 600,
 		},
 	}
 
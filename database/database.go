@@ -0,0 +1,168 @@
+package database
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const defaultPath = "./channel-bot.db"
+
+type Database struct {
+	Path string `long:"database.path" description:"Path to the database file in which the state of the bot is persisted"`
+
+	db *bolt.DB
+}
+
+func (d *Database) Connect() (err error) {
+	if d.Path == "" {
+		d.Path = defaultPath
+	}
+
+	d.db, err = bolt.Open(d.Path, 0600, &bolt.Options{
+		Timeout: time.Second * 5,
+	})
+
+	if err != nil {
+		return errors.New(fmt.Sprint("could not open database: ", err))
+	}
+
+	return nil
+}
+
+func (d *Database) Close() error {
+	if d.db == nil {
+		return nil
+	}
+
+	return d.db.Close()
+}
+
+// Put encodes the value as JSON and writes it to the key in the bucket
+func (d *Database) Put(bucket string, key []byte, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+
+		return b.Put(key, encoded)
+	})
+}
+
+// Append writes the value to the next key of the bucket and returns that key
+func (d *Database) Append(bucket string, value interface{}) (key []byte, err error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+
+		sequence, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		key = Uint64Key(sequence)
+		return b.Put(key, encoded)
+	})
+
+	return key, err
+}
+
+// Get decodes the value of the key in the bucket and returns false if it does not exist
+func (d *Database) Get(bucket string, key []byte, value interface{}) (bool, error) {
+	var encoded []byte
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		if data := b.Get(key); data != nil {
+			encoded = append([]byte{}, data...)
+		}
+
+		return nil
+	})
+
+	if err != nil || encoded == nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(encoded, value)
+}
+
+// Replace writes the already encoded entries to the bucket and deletes all other keys of it in a single transaction
+func (d *Database) Replace(bucket string, entries map[string][]byte) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(bucket)) != nil {
+			if err := tx.DeleteBucket([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+
+		b, err := tx.CreateBucket([]byte(bucket))
+		if err != nil {
+			return err
+		}
+
+		for key, value := range entries {
+			if err := b.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (d *Database) Delete(bucket string, key []byte) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.Delete(key)
+	})
+}
+
+// ForEach calls the callback with all entries of the bucket in the order of their keys
+func (d *Database) ForEach(bucket string, callback func(key []byte, value []byte) error) error {
+	return d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(callback)
+	})
+}
+
+// Uint64Key encodes the number big endian, so that the keys are sorted by their value
+func Uint64Key(number uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, number)
+
+	return key
+}
+
+func ParseUint64Key(key []byte) uint64 {
+	return binary.BigEndian.Uint64(key)
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testValue struct {
+	Name string
+}
+
+func connect(t *testing.T) *Database {
+	db := &Database{
+		Path: filepath.Join(t.TempDir(), "test.db"),
+	}
+
+	assert.Nil(t, db.Connect())
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return db
+}
+
+func TestPutGetDelete(t *testing.T) {
+	db := connect(t)
+
+	value := &testValue{}
+	exists, err := db.Get("bucket", []byte("key"), value)
+
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	assert.Nil(t, db.Put("bucket", []byte("key"), &testValue{Name: "test"}))
+
+	exists, err = db.Get("bucket", []byte("key"), value)
+
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, "test", value.Name)
+
+	assert.Nil(t, db.Delete("bucket", []byte("key")))
+
+	exists, err = db.Get("bucket", []byte("key"), value)
+
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestAppend(t *testing.T) {
+	db := connect(t)
+
+	for _, name := range []string{"first", "second", "third"} {
+		_, err := db.Append("bucket", &testValue{Name: name})
+		assert.Nil(t, err)
+	}
+
+	var keys []uint64
+	var values []string
+
+	err := db.ForEach("bucket", func(key []byte, value []byte) error {
+		keys = append(keys, ParseUint64Key(key))
+		values = append(values, string(value))
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2, 3}, keys)
+	assert.Equal(t, []string{`{"Name":"first"}`, `{"Name":"second"}`, `{"Name":"third"}`}, values)
+
+	// Iterating over a bucket that does not exist should not fail
+	assert.Nil(t, db.ForEach("empty", func([]byte, []byte) error {
+		return nil
+	}))
+}
+
+func TestReplace(t *testing.T) {
+	db := connect(t)
+
+	assert.Nil(t, db.Put("bucket", []byte("old"), &testValue{Name: "old"}))
+	assert.Nil(t, db.Replace("bucket", map[string][]byte{
+		"first":  []byte("1"),
+		"second": []byte("2"),
+	}))
+
+	entries := map[string]string{}
+
+	assert.Nil(t, db.ForEach("bucket", func(key []byte, value []byte) error {
+		entries[string(key)] = string(value)
+		return nil
+	}))
+	assert.Equal(t, map[string]string{"first": "1", "second": "2"}, entries)
+
+	// Replacing with no entries empties the bucket
+	assert.Nil(t, db.Replace("bucket", map[string][]byte{}))
+
+	exists, err := db.Get("bucket", []byte("first"), &testValue{})
+
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestUint64Key(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 1, 0}, Uint64Key(256))
+	assert.Equal(t, uint64(619899158240231424), ParseUint64Key(Uint64Key(619899158240231424)))
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
@@ -16,19 +17,68 @@ import (
 )
 
 type LightningClient interface {
-	GetInfo() (*lnrpc.GetInfoResponse, error)
-	GetNodeInfo(pubkey string) (*lnrpc.NodeInfo, error)
-	ListChannels() (*lnrpc.ListChannelsResponse, error)
-	ClosedChannels() (*lnrpc.ClosedChannelsResponse, error)
-	GetChannelInfo(chanId uint64) (*lnrpc.ChannelEdge, error)
-	ListInactiveChannels() (*lnrpc.ListChannelsResponse, error)
-	ForceCloseChannel(channelPoint string) (lnrpc.Lightning_CloseChannelClient, error)
+	GetInfo(ctx context.Context) (*lnrpc.GetInfoResponse, error)
+	GetNodeInfo(ctx context.Context, pubkey string) (*lnrpc.NodeInfo, error)
+	ListChannels(ctx context.Context) (*lnrpc.ListChannelsResponse, error)
+	ClosedChannels(ctx context.Context) (*lnrpc.ClosedChannelsResponse, error)
+	PendingChannels(ctx context.Context) (*lnrpc.PendingChannelsResponse, error)
+	GetChannelInfo(ctx context.Context, chanId uint64) (*lnrpc.ChannelEdge, error)
+	ListInactiveChannels(ctx context.Context) (*lnrpc.ListChannelsResponse, error)
 
-	SubscribeInvoices(events chan<- *lnrpc.Invoice, errChan chan<- error)
-	SubscribeHtlcEvents(events chan<- *routerrpc.HtlcEvent, errChan chan<- error)
-	SubscribeChannelEvents(events chan<- *lnrpc.ChannelEventUpdate, errChan chan<- error)
+	// Forwarding events since the start time in seconds are returned in pages starting after the index offset
+	ForwardingHistory(ctx context.Context, startTime uint64, indexOffset uint32) (*lnrpc.ForwardingHistoryResponse, error)
+
+	// Unconfirmed transactions of the wallet are always included
+	GetTransactions(ctx context.Context, startHeight int32) (*lnrpc.TransactionDetails, error)
+
+	ListPeers(ctx context.Context) (*lnrpc.ListPeersResponse, error)
+
+	// The host is the address of the peer in the "host:port" format
+	ConnectPeer(ctx context.Context, pubkey string, host string) error
+
+	// The close streams are bound to the context and are closed once it is cancelled.
+	// Cooperative closes use the fee rate in sat/vbyte or, if it is 0, the confirmation target
+	CloseChannel(ctx context.Context, channelPoint string, satPerVbyte uint64, targetConf int32) (lnrpc.Lightning_CloseChannelClient, error)
+	ForceCloseChannel(ctx context.Context, channelPoint string) (lnrpc.Lightning_CloseChannelClient, error)
+
+	// The subscriptions reconnect on their own when the stream to LND breaks.
+	// Errors are sent to the errChan and a value is sent to the restoredChan
+	// once the subscription could be opened again. Cancelling the context
+	// closes the subscription
+	SubscribeInvoices(
+		ctx context.Context,
+		events chan<- *lnrpc.Invoice,
+		errChan chan<- error,
+		restoredChan chan<- struct{},
+	)
+	SubscribeHtlcEvents(
+		ctx context.Context,
+		events chan<- *routerrpc.HtlcEvent,
+		errChan chan<- error,
+		restoredChan chan<- struct{},
+	)
+	SubscribeChannelEvents(
+		ctx context.Context,
+		events chan<- *lnrpc.ChannelEventUpdate,
+		errChan chan<- error,
+		restoredChan chan<- struct{},
+	)
 }
 
+const forwardingHistoryPageSize = 10000
+
+const (
+	defaultInfoTimeout     = 10
+	defaultChannelsTimeout = 30
+	defaultGraphTimeout    = 10
+	defaultConnectTimeout  = 20
+)
+
+var (
+	initialReconnectDelay = time.Second
+	maxReconnectDelay     = time.Minute
+)
+
 type LND struct {
 	Host            string `long:"lnd.host" description:"gRPC host of the LND node"`
 	Port            int    `long:"lnd.port" description:"gRPC port of the LND node"`
@@ -36,9 +86,14 @@ type LND struct {
 	Certificate     string `long:"lnd.certificate" description:"Path to a certificate file of the LND node"`
 	TlsNameOverride string `long:"lnd.tls-name-override" description:"Override the TLS name of the LND node"`
 
-	ctx    context.Context
-	client lnrpc.LightningClient
-	router routerrpc.RouterClient
+	InfoTimeout     int `long:"lnd.timeout.info" description:"Timeout in seconds for querying info of the LND node"`
+	ChannelsTimeout int `long:"lnd.timeout.channels" description:"Timeout in seconds for listing channels"`
+	GraphTimeout    int `long:"lnd.timeout.graph" description:"Timeout in seconds for querying nodes and channels from the graph"`
+	ConnectTimeout  int `long:"lnd.timeout.connect" description:"Timeout in seconds for connecting to peers"`
+
+	macaroon string
+	client   lnrpc.LightningClient
+	router   routerrpc.RouterClient
 }
 
 func (lnd *LND) Connect() error {
@@ -54,100 +109,303 @@ func (lnd *LND) Connect() error {
 		return errors.New(fmt.Sprint("could not create gRPC client: ", err))
 	}
 
+	setDefaultTimeout(&lnd.InfoTimeout, defaultInfoTimeout)
+	setDefaultTimeout(&lnd.ChannelsTimeout, defaultChannelsTimeout)
+	setDefaultTimeout(&lnd.GraphTimeout, defaultGraphTimeout)
+	setDefaultTimeout(&lnd.ConnectTimeout, defaultConnectTimeout)
+
 	lnd.client = lnrpc.NewLightningClient(con)
 	lnd.router = routerrpc.NewRouterClient(con)
 
-	if lnd.ctx == nil {
+	if lnd.macaroon == "" {
 		macaroonFile, err := os.ReadFile(lnd.Macaroon)
 
 		if err != nil {
 			return errors.New(fmt.Sprint("could not read LND macaroon: ", err))
 		}
 
-		macaroon := metadata.Pairs("macaroon", hex.EncodeToString(macaroonFile))
-		lnd.ctx = metadata.NewOutgoingContext(context.Background(), macaroon)
+		lnd.macaroon = hex.EncodeToString(macaroonFile)
 	}
 
 	return nil
 }
 
-func (lnd *LND) GetInfo() (*lnrpc.GetInfoResponse, error) {
-	return lnd.client.GetInfo(lnd.ctx, &lnrpc.GetInfoRequest{})
+func (lnd *LND) GetInfo(ctx context.Context) (*lnrpc.GetInfoResponse, error) {
+	ctx, cancel := lnd.callContext(ctx, lnd.InfoTimeout)
+	defer cancel()
+
+	return lnd.client.GetInfo(ctx, &lnrpc.GetInfoRequest{})
 }
 
-func (lnd *LND) ListChannels() (*lnrpc.ListChannelsResponse, error) {
-	return lnd.client.ListChannels(lnd.ctx, &lnrpc.ListChannelsRequest{})
+func (lnd *LND) ListChannels(ctx context.Context) (*lnrpc.ListChannelsResponse, error) {
+	ctx, cancel := lnd.callContext(ctx, lnd.ChannelsTimeout)
+	defer cancel()
+
+	return lnd.client.ListChannels(ctx, &lnrpc.ListChannelsRequest{})
 }
 
-func (lnd *LND) ListInactiveChannels() (*lnrpc.ListChannelsResponse, error) {
-	return lnd.client.ListChannels(lnd.ctx, &lnrpc.ListChannelsRequest{
+func (lnd *LND) ListInactiveChannels(ctx context.Context) (*lnrpc.ListChannelsResponse, error) {
+	ctx, cancel := lnd.callContext(ctx, lnd.ChannelsTimeout)
+	defer cancel()
+
+	return lnd.client.ListChannels(ctx, &lnrpc.ListChannelsRequest{
 		InactiveOnly: true,
 	})
 }
 
-func (lnd *LND) ClosedChannels() (*lnrpc.ClosedChannelsResponse, error) {
-	return lnd.client.ClosedChannels(lnd.ctx, &lnrpc.ClosedChannelsRequest{})
+func (lnd *LND) ClosedChannels(ctx context.Context) (*lnrpc.ClosedChannelsResponse, error) {
+	ctx, cancel := lnd.callContext(ctx, lnd.ChannelsTimeout)
+	defer cancel()
+
+	return lnd.client.ClosedChannels(ctx, &lnrpc.ClosedChannelsRequest{})
+}
+
+func (lnd *LND) PendingChannels(ctx context.Context) (*lnrpc.PendingChannelsResponse, error) {
+	ctx, cancel := lnd.callContext(ctx, lnd.ChannelsTimeout)
+	defer cancel()
+
+	return lnd.client.PendingChannels(ctx, &lnrpc.PendingChannelsRequest{})
+}
+
+func (lnd *LND) GetTransactions(ctx context.Context, startHeight int32) (*lnrpc.TransactionDetails, error) {
+	ctx, cancel := lnd.callContext(ctx, lnd.ChannelsTimeout)
+	defer cancel()
+
+	return lnd.client.GetTransactions(ctx, &lnrpc.GetTransactionsRequest{
+		StartHeight: startHeight,
+		EndHeight:   -1,
+	})
+}
+
+func (lnd *LND) ForwardingHistory(
+	ctx context.Context,
+	startTime uint64,
+	indexOffset uint32,
+) (*lnrpc.ForwardingHistoryResponse, error) {
+	ctx, cancel := lnd.callContext(ctx, lnd.ChannelsTimeout)
+	defer cancel()
+
+	return lnd.client.ForwardingHistory(ctx, &lnrpc.ForwardingHistoryRequest{
+		StartTime:    startTime,
+		IndexOffset:  indexOffset,
+		NumMaxEvents: forwardingHistoryPageSize,
+	})
 }
 
-func (lnd *LND) GetNodeInfo(pubkey string) (*lnrpc.NodeInfo, error) {
-	return lnd.client.GetNodeInfo(lnd.ctx, &lnrpc.NodeInfoRequest{
+func (lnd *LND) GetNodeInfo(ctx context.Context, pubkey string) (*lnrpc.NodeInfo, error) {
+	ctx, cancel := lnd.callContext(ctx, lnd.GraphTimeout)
+	defer cancel()
+
+	return lnd.client.GetNodeInfo(ctx, &lnrpc.NodeInfoRequest{
 		PubKey: pubkey,
 	})
 }
 
-func (lnd *LND) GetChannelInfo(chanId uint64) (*lnrpc.ChannelEdge, error) {
-	return lnd.client.GetChanInfo(lnd.ctx, &lnrpc.ChanInfoRequest{
+func (lnd *LND) GetChannelInfo(ctx context.Context, chanId uint64) (*lnrpc.ChannelEdge, error) {
+	ctx, cancel := lnd.callContext(ctx, lnd.GraphTimeout)
+	defer cancel()
+
+	return lnd.client.GetChanInfo(ctx, &lnrpc.ChanInfoRequest{
 		ChanId: chanId,
 	})
 }
 
-func (lnd *LND) ForceCloseChannel(channelPoint string) (lnrpc.Lightning_CloseChannelClient, error) {
+func (lnd *LND) ListPeers(ctx context.Context) (*lnrpc.ListPeersResponse, error) {
+	ctx, cancel := lnd.callContext(ctx, lnd.InfoTimeout)
+	defer cancel()
+
+	return lnd.client.ListPeers(ctx, &lnrpc.ListPeersRequest{})
+}
+
+// ConnectPeer gives the call more time than LND has to connect, so that LND can report why the connection failed
+func (lnd *LND) ConnectPeer(ctx context.Context, pubkey string, host string) error {
+	ctx, cancel := lnd.callContext(ctx, lnd.ConnectTimeout+lnd.InfoTimeout)
+	defer cancel()
+
+	_, err := lnd.client.ConnectPeer(ctx, &lnrpc.ConnectPeerRequest{
+		Addr: &lnrpc.LightningAddress{
+			Pubkey: pubkey,
+			Host:   host,
+		},
+		Timeout: uint64(lnd.ConnectTimeout),
+	})
+
+	return err
+}
+
+func (lnd *LND) CloseChannel(
+	ctx context.Context,
+	channelPoint string,
+	satPerVbyte uint64,
+	targetConf int32,
+) (lnrpc.Lightning_CloseChannelClient, error) {
 	channel := parseChannelPoint(channelPoint)
+	request := &lnrpc.CloseChannelRequest{
+		ChannelPoint: &channel,
+		SatPerVbyte:  satPerVbyte,
+	}
 
-	return lnd.client.CloseChannel(lnd.ctx, &lnrpc.CloseChannelRequest{
+	if satPerVbyte == 0 {
+		request.TargetConf = targetConf
+	}
+
+	return lnd.client.CloseChannel(lnd.streamContext(ctx), request)
+}
+
+func (lnd *LND) ForceCloseChannel(ctx context.Context, channelPoint string) (lnrpc.Lightning_CloseChannelClient, error) {
+	channel := parseChannelPoint(channelPoint)
+
+	return lnd.client.CloseChannel(lnd.streamContext(ctx), &lnrpc.CloseChannelRequest{
 		ChannelPoint: &channel,
 		Force:        true,
 	})
 }
 
-func (lnd *LND) SubscribeChannelEvents(events chan<- *lnrpc.ChannelEventUpdate, errChan chan<- error) {
-	client, err := lnd.client.SubscribeChannelEvents(lnd.ctx, &lnrpc.ChannelEventSubscription{})
-	if err != nil {
-		errChan <- err
-		return
-	}
+func (lnd *LND) SubscribeChannelEvents(
+	ctx context.Context,
+	events chan<- *lnrpc.ChannelEventUpdate,
+	errChan chan<- error,
+	restoredChan chan<- struct{},
+) {
+	go handleSubscription(ctx, func() (func() (*lnrpc.ChannelEventUpdate, error), error) {
+		client, err := lnd.client.SubscribeChannelEvents(lnd.streamContext(ctx), &lnrpc.ChannelEventSubscription{})
+		if err != nil {
+			return nil, err
+		}
 
-	go handleSubscription(client.Recv, events, errChan)
+		return client.Recv, nil
+	}, events, errChan, restoredChan)
 }
 
-func (lnd *LND) SubscribeInvoices(events chan<- *lnrpc.Invoice, errChan chan<- error) {
-	client, err := lnd.client.SubscribeInvoices(lnd.ctx, &lnrpc.InvoiceSubscription{})
-	if err != nil {
-		errChan <- err
-		return
-	}
+func (lnd *LND) SubscribeInvoices(
+	ctx context.Context,
+	events chan<- *lnrpc.Invoice,
+	errChan chan<- error,
+	restoredChan chan<- struct{},
+) {
+	go handleSubscription(ctx, func() (func() (*lnrpc.Invoice, error), error) {
+		client, err := lnd.client.SubscribeInvoices(lnd.streamContext(ctx), &lnrpc.InvoiceSubscription{})
+		if err != nil {
+			return nil, err
+		}
 
-	go handleSubscription(client.Recv, events, errChan)
+		return client.Recv, nil
+	}, events, errChan, restoredChan)
 }
 
-func (lnd *LND) SubscribeHtlcEvents(events chan<- *routerrpc.HtlcEvent, errChan chan<- error) {
-	client, err := lnd.router.SubscribeHtlcEvents(lnd.ctx, &routerrpc.SubscribeHtlcEventsRequest{})
-	if err != nil {
-		errChan <- err
-		return
-	}
+func (lnd *LND) SubscribeHtlcEvents(
+	ctx context.Context,
+	events chan<- *routerrpc.HtlcEvent,
+	errChan chan<- error,
+	restoredChan chan<- struct{},
+) {
+	go handleSubscription(ctx, func() (func() (*routerrpc.HtlcEvent, error), error) {
+		client, err := lnd.router.SubscribeHtlcEvents(lnd.streamContext(ctx), &routerrpc.SubscribeHtlcEventsRequest{})
+		if err != nil {
+			return nil, err
+		}
+
+		return client.Recv, nil
+	}, events, errChan, restoredChan)
+}
+
+// callContext authenticates a unary call and limits its duration to the timeout in seconds
+func (lnd *LND) callContext(ctx context.Context, timeout int) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(lnd.streamContext(ctx), time.Duration(timeout)*time.Second)
+}
 
-	go handleSubscription(client.Recv, events, errChan)
+// streamContext authenticates a call without limiting its duration, which is needed for streams
+func (lnd *LND) streamContext(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "macaroon", lnd.macaroon)
 }
 
-func handleSubscription[T any](recv func() (T, error), events chan<- T, errChan chan<- error) {
+func setDefaultTimeout(timeout *int, defaultTimeout int) {
+	if *timeout <= 0 {
+		*timeout = defaultTimeout
+	}
+}
+
+// handleSubscription opens the subscription and forwards its events. When the stream breaks,
+// the error is sent to the errChan and the subscription is opened again with exponential backoff.
+// Once the context is cancelled, the subscription is closed without reporting an error
+func handleSubscription[T any](
+	ctx context.Context,
+	subscribe func() (func() (T, error), error),
+	events chan<- T,
+	errChan chan<- error,
+	restoredChan chan<- struct{},
+) {
+	delay := initialReconnectDelay
+	isBroken := false
+
 	for {
-		event, err := recv()
-		if err != nil {
-			errChan <- err
-			break
+		recv, err := subscribe()
+
+		if err == nil {
+			if isBroken {
+				isBroken = false
+
+				if !send(ctx, restoredChan, struct{}{}) {
+					return
+				}
+			}
+
+			for {
+				event, recvErr := recv()
+				if recvErr != nil {
+					err = recvErr
+					break
+				}
+
+				// The stream is healthy again once it delivered an event
+				delay = initialReconnectDelay
+
+				if !send(ctx, events, event) {
+					return
+				}
+			}
 		}
 
-		events <- event
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Only the first error is reported to not spam the subscriber while LND is unreachable
+		if !isBroken {
+			isBroken = true
+
+			if !send(ctx, errChan, err) {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-time.After(delay):
+			delay = nextReconnectDelay(delay)
+		}
+	}
+}
+
+// send returns false if the context was cancelled before the value could be sent
+func send[T any](ctx context.Context, channel chan<- T, value T) bool {
+	select {
+	case channel <- value:
+		return true
+
+	case <-ctx.Done():
+		return false
 	}
 }
+
+func nextReconnectDelay(delay time.Duration) time.Duration {
+	delay *= 2
+
+	if delay > maxReconnectDelay {
+		return maxReconnectDelay
+	}
+
+	return delay
+}
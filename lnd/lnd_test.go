@@ -0,0 +1,121 @@
+package lnd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setReconnectDelays overrides the reconnect delays for the test and restores them afterwards
+func setReconnectDelays(t *testing.T, initial time.Duration, max time.Duration) {
+	previousInitial, previousMax := initialReconnectDelay, maxReconnectDelay
+
+	t.Cleanup(func() {
+		initialReconnectDelay, maxReconnectDelay = previousInitial, previousMax
+	})
+
+	initialReconnectDelay, maxReconnectDelay = initial, max
+}
+
+func TestHandleSubscriptionReconnect(t *testing.T) {
+	setReconnectDelays(t, time.Millisecond, time.Millisecond*4)
+
+	streamErr := errors.New("stream broke")
+	subscribeErr := errors.New("could not subscribe")
+
+	attempts := 0
+
+	subscribe := func() (func() (int, error), error) {
+		attempts++
+
+		switch attempts {
+		// The first stream delivers one event and breaks
+		case 1:
+			sent := false
+			return func() (int, error) {
+				if sent {
+					return 0, streamErr
+				}
+
+				sent = true
+				return attempts, nil
+			}, nil
+
+		// Subscribing fails a couple of times while LND is unreachable
+		case 2, 3:
+			return nil, subscribeErr
+
+		// And the last stream stays open
+		default:
+			return func() (int, error) {
+				time.Sleep(time.Hour)
+				return 0, nil
+			}, nil
+		}
+	}
+
+	events := make(chan int)
+	errChan := make(chan error)
+	restoredChan := make(chan struct{})
+
+	go handleSubscription(context.Background(), subscribe, events, errChan, restoredChan)
+
+	assert.Equal(t, 1, <-events)
+	assert.Equal(t, streamErr, <-errChan)
+
+	select {
+	case <-restoredChan:
+		break
+
+	case err := <-errChan:
+		assert.Fail(t, "Reported error of failed reconnect attempt: "+err.Error())
+	}
+
+	assert.Equal(t, 4, attempts)
+}
+
+func TestHandleSubscriptionCancel(t *testing.T) {
+	setReconnectDelays(t, time.Hour, maxReconnectDelay)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	subscribe := func() (func() (int, error), error) {
+		return func() (int, error) {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}, nil
+	}
+
+	errChan := make(chan error)
+	done := make(chan struct{})
+
+	go func() {
+		handleSubscription(ctx, subscribe, make(chan int), errChan, make(chan struct{}))
+		close(done)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+		break
+
+	case err := <-errChan:
+		assert.Fail(t, "Reported error of cancelled subscription: "+err.Error())
+
+	case <-time.After(time.Second):
+		assert.Fail(t, "Subscription was not closed after cancelling the context")
+	}
+}
+
+func TestNextReconnectDelay(t *testing.T) {
+	setReconnectDelays(t, initialReconnectDelay, time.Minute)
+
+	assert.Equal(t, time.Second*2, nextReconnectDelay(time.Second))
+	assert.Equal(t, time.Second*40, nextReconnectDelay(time.Second*20))
+	assert.Equal(t, maxReconnectDelay, nextReconnectDelay(time.Second*40))
+	assert.Equal(t, maxReconnectDelay, nextReconnectDelay(maxReconnectDelay))
+}
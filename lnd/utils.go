@@ -1,15 +1,17 @@
 package lnd
 
 import (
+	"context"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"strconv"
 	"strings"
 )
 
-func GetNodeName(lnd LightningClient, remotePubkey string) string {
+func GetNodeName(ctx context.Context, lnd LightningClient, remotePubkey string) string {
 	nodeName := remotePubkey
 
-	nodeInfo, err := lnd.GetNodeInfo(remotePubkey)
+	nodeInfo, err := lnd.GetNodeInfo(ctx, remotePubkey)
 
 	// Use the alias if it can be queried and is not empty
 	if err == nil {
@@ -25,6 +27,26 @@ func FormatChannelID(channelId uint64) string {
 	return strconv.FormatUint(channelId, 10)
 }
 
+// FormatChannelPoint formats the channel point in the "txid:index" format in which LND shows it
+func FormatChannelPoint(channelPoint *lnrpc.ChannelPoint) string {
+	txid, err := lnrpc.GetChanPointFundingTxid(channelPoint)
+	if err != nil {
+		return ""
+	}
+
+	return txid.String() + ":" + strconv.FormatUint(uint64(channelPoint.OutputIndex), 10)
+}
+
+// FormatTxid formats the raw bytes of a transaction ID in the reversed byte order in which it is usually shown
+func FormatTxid(txid []byte) string {
+	hash, err := chainhash.NewHash(txid)
+	if err != nil {
+		return ""
+	}
+
+	return hash.String()
+}
+
 func parseChannelPoint(channelPoint string) lnrpc.ChannelPoint {
 	split := strings.Split(channelPoint, ":")
 	outputIndex, _ := strconv.Atoi(split[1])
@@ -1,6 +1,7 @@
 package lnd
 
 import (
+	"context"
 	"errors"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"strconv"
@@ -17,19 +18,19 @@ const emptyPublicKey = "empty"
 
 type MockLndClient struct{}
 
-func (m *MockLndClient) GetInfo() (*lnrpc.GetInfoResponse, error) {
+func (m *MockLndClient) GetInfo(context.Context) (*lnrpc.GetInfoResponse, error) {
 	panic("")
 }
 
-func (m *MockLndClient) ListChannels() (*lnrpc.ListChannelsResponse, error) {
+func (m *MockLndClient) ListChannels(context.Context) (*lnrpc.ListChannelsResponse, error) {
 	panic("")
 }
 
-func (m *MockLndClient) ClosedChannels() (*lnrpc.ClosedChannelsResponse, error) {
+func (m *MockLndClient) ClosedChannels(context.Context) (*lnrpc.ClosedChannelsResponse, error) {
 	panic("")
 }
 
-func (m *MockLndClient) GetNodeInfo(pubkey string) (*lnrpc.NodeInfo, error) {
+func (m *MockLndClient) GetNodeInfo(_ context.Context, pubkey string) (*lnrpc.NodeInfo, error) {
 	nodeInfo := &lnrpc.NodeInfo{
 		Node: &lnrpc.LightningNode{
 			Alias: nodeAlias,
@@ -58,40 +59,64 @@ func (m *MockLndClient) GetNodeInfo(pubkey string) (*lnrpc.NodeInfo, error) {
 	return nodeInfo, err
 }
 
-func (m *MockLndClient) GetChannelInfo(chanId uint64) (*lnrpc.ChannelEdge, error) {
+func (m *MockLndClient) GetChannelInfo(_ context.Context, chanId uint64) (*lnrpc.ChannelEdge, error) {
 	panic("")
 }
 
-func (m *MockLndClient) ForceCloseChannel(channelPoint string) (lnrpc.Lightning_CloseChannelClient, error) {
+func (m *MockLndClient) ForceCloseChannel(_ context.Context, channelPoint string) (lnrpc.Lightning_CloseChannelClient, error) {
 	panic("")
 }
 
-func (m *MockLndClient) ListInactiveChannels() (*lnrpc.ListChannelsResponse, error) {
+func (m *MockLndClient) ListPeers(context.Context) (*lnrpc.ListPeersResponse, error) {
 	panic("")
 }
 
-func (m *MockLndClient) SubscribeInvoices(chan<- *lnrpc.Invoice, chan<- error) {
+func (m *MockLndClient) ConnectPeer(context.Context, string, string) error {
+	panic("")
+}
+
+func (m *MockLndClient) CloseChannel(context.Context, string, uint64, int32) (lnrpc.Lightning_CloseChannelClient, error) {
+	panic("")
+}
+
+func (m *MockLndClient) PendingChannels(context.Context) (*lnrpc.PendingChannelsResponse, error) {
+	panic("")
+}
+
+func (m *MockLndClient) ForwardingHistory(context.Context, uint64, uint32) (*lnrpc.ForwardingHistoryResponse, error) {
+	panic("")
+}
+
+func (m *MockLndClient) GetTransactions(context.Context, int32) (*lnrpc.TransactionDetails, error) {
+	panic("")
+}
+
+func (m *MockLndClient) ListInactiveChannels(context.Context) (*lnrpc.ListChannelsResponse, error) {
+	panic("")
+}
+
+func (m *MockLndClient) SubscribeInvoices(context.Context, chan<- *lnrpc.Invoice, chan<- error, chan<- struct{}) {
 	panic("implement me")
 }
 
-func (m *MockLndClient) SubscribeHtlcEvents(chan<- *routerrpc.HtlcEvent, chan<- error) {
+func (m *MockLndClient) SubscribeHtlcEvents(context.Context, chan<- *routerrpc.HtlcEvent, chan<- error, chan<- struct{}) {
 	panic("implement me")
 }
 
-func (m *MockLndClient) SubscribeChannelEvents(chan<- *lnrpc.ChannelEventUpdate, chan<- error) {
+func (m *MockLndClient) SubscribeChannelEvents(context.Context, chan<- *lnrpc.ChannelEventUpdate, chan<- error, chan<- struct{}) {
 	panic("implement me")
 }
 
 func TestGetNodeName(t *testing.T) {
 	client := &MockLndClient{}
 
-	nodeName := GetNodeName(client, "")
+	nodeName := GetNodeName(context.Background(), client, "")
 	assert.Equal(t, nodeAlias, nodeName, "Node name is not queried alias")
 
-	nodeName = GetNodeName(client, failPublicKey)
+	nodeName = GetNodeName(context.Background(), client, failPublicKey)
 	assert.Equal(t, failPublicKey, nodeName, "Node name is not remote public key if alias cannot be queried")
 
-	nodeName = GetNodeName(client, emptyPublicKey)
+	nodeName = GetNodeName(context.Background(), client, emptyPublicKey)
 	assert.Equal(t, emptyPublicKey, nodeName, "Node name is not remote public key if alias is an empty string")
 }
 
@@ -144,3 +169,30 @@ func TestParseChannelPoint(t *testing.T) {
 		assert.Equal(t, expectedResults[i].OutputIndex, parseChannelPoint(channelPoint).OutputIndex)
 	}
 }
+
+func TestFormatChannelPoint(t *testing.T) {
+	channelPoint := "446b399af44adbcddf85205d52438356437469fa7d44b0402a03e403318dc0a3:1"
+	parsed := parseChannelPoint(channelPoint)
+
+	assert.Equal(t, channelPoint, FormatChannelPoint(&parsed))
+
+	// The bytes of the funding transaction ID are in reverse order
+	txid := make([]byte, 32)
+	txid[0] = 1
+
+	assert.Equal(t, "0000000000000000000000000000000000000000000000000000000000000001:0", FormatChannelPoint(&lnrpc.ChannelPoint{
+		FundingTxid: &lnrpc.ChannelPoint_FundingTxidBytes{
+			FundingTxidBytes: txid,
+		},
+	}))
+
+	assert.Equal(t, "", FormatChannelPoint(&lnrpc.ChannelPoint{}))
+}
+
+func TestFormatTxid(t *testing.T) {
+	txid := make([]byte, 32)
+	txid[0] = 1
+
+	assert.Equal(t, "0000000000000000000000000000000000000000000000000000000000000001", FormatTxid(txid))
+	assert.Equal(t, "", FormatTxid([]byte{1}))
+}
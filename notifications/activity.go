@@ -0,0 +1,208 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/lnd"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"strconv"
+	"time"
+)
+
+// checkInterval is how often inactive channels are checked against the grace period and pending channels are polled
+const checkInterval = time.Minute
+
+const inactiveForField = "Inactive for"
+
+type inactiveChannel struct {
+	since    time.Time
+	notified bool
+}
+
+// channelActivity tracks the channels that are inactive to notify when they stay inactive for longer than
+// the grace period and when they are active again
+type channelActivity struct {
+	sm          *stateManager
+	gracePeriod time.Duration
+
+	// Inactive channels keyed by their channel point
+	inactive map[string]*inactiveChannel
+}
+
+func initChannelActivity(sm *stateManager, gracePeriod int) *channelActivity {
+	return &channelActivity{
+		sm:          sm,
+		gracePeriod: time.Duration(gracePeriod) * time.Second,
+		inactive:    map[string]*inactiveChannel{},
+	}
+}
+
+// sync compares the tracked channels with the ones of LND in case events were missed
+func (ca *channelActivity) sync(ctx context.Context, channels []*lnrpc.Channel) {
+	existing := map[string]bool{}
+
+	for _, channel := range channels {
+		existing[channel.ChannelPoint] = true
+
+		if channel.Active {
+			ca.setActive(ctx, channel.ChannelPoint)
+		} else {
+			ca.setInactive(channel.ChannelPoint)
+		}
+	}
+
+	for channelPoint := range ca.inactive {
+		if !existing[channelPoint] {
+			delete(ca.inactive, channelPoint)
+		}
+	}
+}
+
+func (ca *channelActivity) handleActive(ctx context.Context, channelPoint *lnrpc.ChannelPoint) {
+	formattedPoint := lnd.FormatChannelPoint(channelPoint)
+
+	ca.updateChannel(ctx, formattedPoint, true)
+	ca.setActive(ctx, formattedPoint)
+}
+
+func (ca *channelActivity) handleInactive(ctx context.Context, channelPoint *lnrpc.ChannelPoint) {
+	formattedPoint := lnd.FormatChannelPoint(channelPoint)
+
+	ca.updateChannel(ctx, formattedPoint, false)
+	ca.setInactive(formattedPoint)
+}
+
+// updateChannel applies the activity to the tracked channel, so that conditions see it before the next reconcile
+func (ca *channelActivity) updateChannel(ctx context.Context, channelPoint string, isActive bool) {
+	channel := ca.sm.channelByPoint(channelPoint)
+	if channel == nil || channel.Active == isActive {
+		return
+	}
+
+	channel.Active = isActive
+	ca.sm.checkConditions(ctx, channel)
+}
+
+func (ca *channelActivity) forgetChannel(channelPoint string) {
+	delete(ca.inactive, channelPoint)
+}
+
+// checkInactive notifies about the channels that have been inactive for longer than the grace period
+func (ca *channelActivity) checkInactive(ctx context.Context) {
+	now := ca.sm.clock.Now()
+
+	for channelPoint, inactive := range ca.inactive {
+		if inactive.notified || now.Sub(inactive.since) < ca.gracePeriod {
+			continue
+		}
+
+		channel := ca.sm.channelByPoint(channelPoint)
+		if channel == nil {
+			continue
+		}
+
+		inactive.notified = true
+		ca.logActivity(ctx, channel, false, now.Sub(inactive.since))
+	}
+}
+
+func (ca *channelActivity) setActive(ctx context.Context, channelPoint string) {
+	inactive := ca.inactive[channelPoint]
+	if inactive == nil {
+		return
+	}
+
+	delete(ca.inactive, channelPoint)
+
+	// Channels that were only inactive for a moment were never notified about
+	if !inactive.notified {
+		return
+	}
+
+	if channel := ca.sm.channelByPoint(channelPoint); channel != nil {
+		ca.logActivity(ctx, channel, true, ca.sm.clock.Now().Sub(inactive.since))
+	}
+}
+
+func (ca *channelActivity) setInactive(channelPoint string) {
+	if ca.inactive[channelPoint] != nil {
+		return
+	}
+
+	ca.inactive[channelPoint] = &inactiveChannel{
+		since: ca.sm.clock.Now(),
+	}
+}
+
+func (ca *channelActivity) logActivity(ctx context.Context, channel *lnrpc.Channel, isActive bool, inactiveFor time.Duration) {
+	significant := ca.sm.significantChannel(channel)
+
+	if significant == nil && !ca.sm.manager.logInsignificant {
+		return
+	}
+
+	nodeName := ca.sm.manager.nc.getNodeName(ctx, channel.RemotePubkey)
+
+	event := &providers.Event{
+		Type:     providers.EventInactive,
+		Severity: providers.SeverityWarning,
+		Title:    "Channel to " + nodeName + " is inactive",
+		Channel: &providers.Channel{
+			ID:      channel.ChanId,
+			Private: channel.Private,
+		},
+		Peer: &providers.Peer{
+			Pubkey: channel.RemotePubkey,
+			Alias:  nodeName,
+		},
+		Fields: []*providers.Field{
+			{Name: inactiveForField, Value: formatDuration(inactiveFor)},
+		},
+	}
+
+	if isActive {
+		event.Type = providers.EventActive
+		event.Severity = providers.SeverityInfo
+		event.Title = "Channel to " + nodeName + " is active again"
+	}
+
+	if significant != nil {
+		event.Channel.Alias = significant.Alias
+	}
+
+	_ = ca.sm.manager.notificationProvider.SendEvent(event)
+}
+
+func (sm *stateManager) channelByPoint(channelPoint string) *lnrpc.Channel {
+	for _, channel := range sm.channels {
+		if channel.ChannelPoint == channelPoint {
+			return channel
+		}
+	}
+
+	return nil
+}
+
+// formatDuration formats the duration in the largest units that fit, down to seconds
+func formatDuration(duration time.Duration) string {
+	if duration < time.Minute {
+		return strconv.Itoa(int(duration.Seconds())) + "s"
+	}
+
+	duration = duration.Round(time.Minute)
+
+	days := int(duration / (24 * time.Hour))
+	hours := int(duration/time.Hour) % 24
+	minutes := int(duration/time.Minute) % 60
+
+	switch {
+	case days != 0:
+		return strconv.Itoa(days) + "d " + strconv.Itoa(hours) + "h"
+
+	case hours != 0:
+		return strconv.Itoa(hours) + "h " + strconv.Itoa(minutes) + "m"
+
+	default:
+		return strconv.Itoa(minutes) + "m"
+	}
+}
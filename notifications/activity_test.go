@@ -0,0 +1,185 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const activityChannelPoint = "446b399af44adbcddf85205d52438356437469fa7d44b0402a03e403318dc0a3:0"
+
+func activityChannelPointRpc() *lnrpc.ChannelPoint {
+	return &lnrpc.ChannelPoint{
+		FundingTxid: &lnrpc.ChannelPoint_FundingTxidStr{
+			FundingTxidStr: "446b399af44adbcddf85205d52438356437469fa7d44b0402a03e403318dc0a3",
+		},
+	}
+}
+
+// activityChannel is channel 1 to the peer "node" whose activity is tested
+func activityChannel() *lnrpc.Channel {
+	return &lnrpc.Channel{
+		ChanId:       1,
+		ChannelPoint: activityChannelPoint,
+		RemotePubkey: "pubkey",
+	}
+}
+
+func TestChannelInactive(t *testing.T) {
+	cleanUp()
+
+	manager := newTestManager(&ChannelManager{InactiveGracePeriod: 600, logInsignificant: true, lnd: nodeLnd}, nil, activityChannel())
+	ctx := context.Background()
+
+	manager.activity.handleInactive(ctx, activityChannelPointRpc())
+
+	// Nothing is sent within the grace period
+	manager.activity.checkInactive(ctx)
+	assert.Len(t, sentEvents, 0)
+
+	manager.sm.clock.MockTime = manager.sm.clock.MockTime.Add(10 * time.Minute)
+	manager.activity.checkInactive(ctx)
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, providers.EventInactive, sentEvents[0].Type)
+	assert.Equal(t, providers.SeverityWarning, sentEvents[0].Severity)
+	assert.Equal(t, "Channel to node is inactive", sentEvents[0].Title)
+	assert.Equal(t, ":rotating_light: Channel `1` to `node` is **inactive** for 10m :rotating_light:", sentMessages[0])
+
+	// Channels are only notified about once
+	manager.sm.clock.MockTime = manager.sm.clock.MockTime.Add(time.Hour)
+	manager.activity.checkInactive(ctx)
+	assert.Len(t, sentEvents, 1)
+
+	manager.activity.handleActive(ctx, activityChannelPointRpc())
+
+	assert.Len(t, sentEvents, 2)
+	assert.Equal(t, providers.EventActive, sentEvents[1].Type)
+	assert.Equal(t, ":zap: Channel `1` to `node` is **active** again after 1h 10m", sentMessages[1])
+	assert.Empty(t, manager.activity.inactive)
+
+	cleanUp()
+}
+
+func TestChannelInactiveWithinGracePeriod(t *testing.T) {
+	cleanUp()
+
+	manager := newTestManager(&ChannelManager{InactiveGracePeriod: 600, logInsignificant: true, lnd: nodeLnd}, nil, activityChannel())
+	ctx := context.Background()
+
+	manager.activity.handleInactive(ctx, activityChannelPointRpc())
+
+	manager.sm.clock.MockTime = manager.sm.clock.MockTime.Add(time.Minute)
+	manager.activity.handleActive(ctx, activityChannelPointRpc())
+
+	manager.sm.clock.MockTime = manager.sm.clock.MockTime.Add(time.Hour)
+	manager.activity.checkInactive(ctx)
+
+	assert.Len(t, sentEvents, 0)
+
+	cleanUp()
+}
+
+func TestChannelInactiveSignificant(t *testing.T) {
+	cleanUp()
+
+	manager := newTestManager(&ChannelManager{InactiveGracePeriod: 600, lnd: nodeLnd}, nil, activityChannel())
+	ctx := context.Background()
+
+	// Insignificant channels are not notified about
+	manager.activity.handleInactive(ctx, activityChannelPointRpc())
+	manager.sm.clock.MockTime = manager.sm.clock.MockTime.Add(time.Hour)
+	manager.activity.checkInactive(ctx)
+
+	assert.Len(t, sentEvents, 0)
+
+	manager = newTestManager(
+		&ChannelManager{InactiveGracePeriod: 600, lnd: nodeLnd},
+		[]*SignificantChannel{{Alias: "Boltz", ChannelID: 1, chanId: 1}},
+		activityChannel(),
+	)
+
+	manager.activity.handleInactive(ctx, activityChannelPointRpc())
+	manager.sm.clock.MockTime = manager.sm.clock.MockTime.Add(time.Hour)
+	manager.activity.checkInactive(ctx)
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, ":rotating_light: Channel **Boltz** `1` to `node` is **inactive** for 1h 0m :rotating_light:", sentMessages[0])
+
+	cleanUp()
+}
+
+func TestSyncChannelActivity(t *testing.T) {
+	cleanUp()
+
+	manager := newTestManager(&ChannelManager{InactiveGracePeriod: 600, logInsignificant: true, lnd: nodeLnd}, nil, activityChannel())
+	ctx := context.Background()
+
+	manager.activity.sync(ctx, []*lnrpc.Channel{
+		{ChanId: 1, ChannelPoint: activityChannelPoint, Active: false},
+	})
+
+	assert.Len(t, manager.activity.inactive, 1)
+
+	manager.sm.clock.MockTime = manager.sm.clock.MockTime.Add(time.Hour)
+	manager.activity.checkInactive(ctx)
+
+	assert.Len(t, sentEvents, 1)
+
+	// Missed events are caught up on
+	manager.activity.sync(ctx, []*lnrpc.Channel{
+		{ChanId: 1, ChannelPoint: activityChannelPoint, Active: true},
+	})
+
+	assert.Len(t, sentEvents, 2)
+	assert.Equal(t, providers.EventActive, sentEvents[1].Type)
+
+	// Channels that vanished are forgotten
+	manager.activity.sync(ctx, []*lnrpc.Channel{
+		{ChanId: 1, ChannelPoint: activityChannelPoint, Active: false},
+	})
+	manager.activity.sync(ctx, []*lnrpc.Channel{})
+
+	assert.Empty(t, manager.activity.inactive)
+
+	cleanUp()
+}
+
+func TestLogFullyResolvedChannel(t *testing.T) {
+	cleanUp()
+
+	manager := newTestManager(&ChannelManager{InactiveGracePeriod: 600, logInsignificant: true, lnd: nodeLnd}, nil, activityChannel())
+	ctx := context.Background()
+
+	manager.logFullyResolvedChannel(ctx, activityChannelPointRpc())
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, "Channel `"+activityChannelPoint+"` was fully resolved on-chain", sentMessages[0])
+
+	closedChannels = []*lnrpc.ChannelCloseSummary{
+		{ChanId: 1, ChannelPoint: activityChannelPoint, RemotePubkey: "pubkey", SettledBalance: 1000},
+	}
+
+	manager.logFullyResolvedChannel(ctx, activityChannelPointRpc())
+
+	assert.Len(t, sentEvents, 2)
+	assert.Equal(t, "Channel to node was fully resolved", sentEvents[1].Title)
+	assert.Equal(t, []*providers.Field{
+		{Name: "Channel point", Value: activityChannelPoint},
+		{Name: "Settled balance", Value: "1,000 sats"},
+	}, sentEvents[1].Fields)
+	assert.Equal(t, "Channel `1` to `node` was fully resolved on-chain", sentMessages[1])
+
+	closedChannels = nil
+	cleanUp()
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "42s", formatDuration(42*time.Second))
+	assert.Equal(t, "5m", formatDuration(5*time.Minute+10*time.Second))
+	assert.Equal(t, "2h 30m", formatDuration(150*time.Minute))
+	assert.Equal(t, "3d 4h", formatDuration(76*time.Hour))
+}
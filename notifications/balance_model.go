@@ -0,0 +1,129 @@
+package notifications
+
+import (
+	"errors"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/protobuf/proto"
+	"strings"
+)
+
+// balanceModel defines which balances of a channel are checked against the limits
+type balanceModel string
+
+const (
+	// The balances of the commitment transaction
+	balanceModelRaw balanceModel = "raw"
+
+	// The local balance that can actually be sent
+	balanceModelSpendable balanceModel = "spendable"
+
+	// The remote balance that can actually be received
+	balanceModelReceivable balanceModel = "receivable"
+)
+
+// ParseBalanceModel validates the balance model. It has to be parsed before the rules
+func (manager *ChannelManager) ParseBalanceModel() error {
+	switch model := balanceModel(strings.ToLower(manager.BalanceModel)); model {
+	case "":
+		manager.balanceModel = balanceModelRaw
+
+	case balanceModelRaw, balanceModelSpendable, balanceModelReceivable:
+		manager.balanceModel = model
+
+	default:
+		return errors.New("unknown balance model: " + manager.BalanceModel)
+	}
+
+	return nil
+}
+
+// apply returns the channel with the balances of the model. The channel itself is not modified
+func (model balanceModel) apply(channel *lnrpc.Channel) *lnrpc.Channel {
+	switch model {
+	case balanceModelSpendable:
+		modeled := proto.Clone(channel).(*lnrpc.Channel)
+		modeled.LocalBalance = spendableBalance(channel)
+
+		return modeled
+
+	case balanceModelReceivable:
+		modeled := proto.Clone(channel).(*lnrpc.Channel)
+		modeled.RemoteBalance = receivableBalance(channel)
+
+		return modeled
+	}
+
+	return channel
+}
+
+// ratio returns the share of the capacity of the channel that is on the local side. In the receivable model,
+// everything that cannot be received is counted as local
+func (model balanceModel) ratio(channel *lnrpc.Channel) float64 {
+	if model == balanceModelReceivable {
+		return 1 - float64(channel.RemoteBalance)/float64(channel.Capacity)
+	}
+
+	return getChannelRatio(channel)
+}
+
+func (model balanceModel) fields() []*providers.Field {
+	if model == "" || model == balanceModelRaw {
+		return nil
+	}
+
+	return []*providers.Field{{Name: "Balance model", Value: string(model)}}
+}
+
+// spendableBalance is the local balance minus the channel reserve and, if we opened the channel, the commit fee,
+// which grows with every HTLC that is added. The anchor outputs are already deducted from the balance of the initiator
+func spendableBalance(channel *lnrpc.Channel) int64 {
+	balance := channel.LocalBalance
+
+	if channel.Initiator {
+		balance -= channel.CommitFee
+	}
+
+	return limitBalance(balance, channel.LocalConstraints, channel.PendingHtlcs, false)
+}
+
+// receivableBalance is the remote balance minus the channel reserve of the peer and, if the peer opened the channel,
+// the commit fee
+func receivableBalance(channel *lnrpc.Channel) int64 {
+	balance := channel.RemoteBalance
+
+	if !channel.Initiator {
+		balance -= channel.CommitFee
+	}
+
+	return limitBalance(balance, channel.RemoteConstraints, channel.PendingHtlcs, true)
+}
+
+// limitBalance deducts the reserve from the balance and caps it with the HTLCs the side can still offer
+func limitBalance(balance int64, constraints *lnrpc.ChannelConstraints, htlcs []*lnrpc.HTLC, incoming bool) int64 {
+	if constraints == nil {
+		return max(balance, 0)
+	}
+
+	balance -= int64(constraints.ChanReserveSat)
+
+	pendingCount := uint32(0)
+	pendingAmount := int64(0)
+
+	for _, htlc := range htlcs {
+		if htlc.Incoming == incoming {
+			pendingCount++
+			pendingAmount += htlc.Amount
+		}
+	}
+
+	if constraints.MaxAcceptedHtlcs != 0 && pendingCount >= constraints.MaxAcceptedHtlcs {
+		return 0
+	}
+
+	if constraints.MaxPendingAmtMsat != 0 {
+		balance = min(balance, int64(constraints.MaxPendingAmtMsat/1000)-pendingAmount)
+	}
+
+	return max(balance, 0)
+}
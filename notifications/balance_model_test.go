@@ -0,0 +1,140 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func modelChannel() *lnrpc.Channel {
+	return &lnrpc.Channel{
+		ChanId:        1,
+		Capacity:      1000000,
+		LocalBalance:  400000,
+		RemoteBalance: 590000,
+		CommitFee:     10000,
+		Initiator:     true,
+		LocalConstraints: &lnrpc.ChannelConstraints{
+			ChanReserveSat: 10000,
+		},
+		RemoteConstraints: &lnrpc.ChannelConstraints{
+			ChanReserveSat: 20000,
+		},
+	}
+}
+
+func TestParseBalanceModel(t *testing.T) {
+	for value, expected := range map[string]balanceModel{
+		"":           balanceModelRaw,
+		"raw":        balanceModelRaw,
+		"Spendable":  balanceModelSpendable,
+		"receivable": balanceModelReceivable,
+	} {
+		manager := &ChannelManager{BalanceModel: value}
+
+		assert.Nil(t, manager.ParseBalanceModel())
+		assert.Equal(t, expected, manager.balanceModel)
+	}
+
+	assert.EqualError(t, (&ChannelManager{BalanceModel: "other"}).ParseBalanceModel(), "unknown balance model: other")
+}
+
+func TestSpendableBalance(t *testing.T) {
+	channel := modelChannel()
+
+	assert.Equal(t, int64(380000), spendableBalance(channel))
+
+	// The commit fee is paid by the initiator
+	channel.Initiator = false
+	assert.Equal(t, int64(390000), spendableBalance(channel))
+
+	// Pending HTLCs use up the value that can be offered
+	channel.LocalConstraints.MaxPendingAmtMsat = 300000000
+	channel.PendingHtlcs = []*lnrpc.HTLC{
+		{Incoming: false, Amount: 50000},
+		{Incoming: true, Amount: 100000},
+	}
+	assert.Equal(t, int64(250000), spendableBalance(channel))
+
+	channel.LocalConstraints.MaxAcceptedHtlcs = 1
+	assert.Equal(t, int64(0), spendableBalance(channel))
+
+	// The balance cannot be negative
+	channel = modelChannel()
+	channel.LocalBalance = 1000
+	assert.Equal(t, int64(0), spendableBalance(channel))
+
+	// Channels without constraints only have the commit fee deducted
+	channel.LocalBalance = 400000
+	channel.LocalConstraints = nil
+	assert.Equal(t, int64(390000), spendableBalance(channel))
+}
+
+func TestReceivableBalance(t *testing.T) {
+	channel := modelChannel()
+
+	assert.Equal(t, int64(570000), receivableBalance(channel))
+
+	channel.Initiator = false
+	assert.Equal(t, int64(560000), receivableBalance(channel))
+
+	channel.Initiator = true
+	channel.RemoteConstraints.MaxAcceptedHtlcs = 1
+	channel.PendingHtlcs = []*lnrpc.HTLC{{Incoming: true, Amount: 1000}}
+	assert.Equal(t, int64(0), receivableBalance(channel))
+}
+
+func TestBalanceModelApply(t *testing.T) {
+	channel := modelChannel()
+
+	assert.Equal(t, channel, balanceModelRaw.apply(channel))
+
+	spendable := balanceModelSpendable.apply(channel)
+	assert.Equal(t, int64(380000), spendable.LocalBalance)
+	assert.Equal(t, int64(590000), spendable.RemoteBalance)
+	assert.InDelta(t, 0.38, balanceModelSpendable.ratio(spendable), 0.0001)
+
+	receivable := balanceModelReceivable.apply(channel)
+	assert.Equal(t, int64(400000), receivable.LocalBalance)
+	assert.Equal(t, int64(570000), receivable.RemoteBalance)
+	assert.InDelta(t, 0.43, balanceModelReceivable.ratio(receivable), 0.0001)
+
+	// The tracked channel is not modified
+	assert.Equal(t, int64(400000), channel.LocalBalance)
+	assert.Equal(t, int64(590000), channel.RemoteBalance)
+}
+
+func TestCheckChannelBalanceModel(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	channelManager := &ChannelManager{
+		BalanceModel:     "spendable",
+		logInsignificant: true,
+	}
+
+	assert.Nil(t, channelManager.ParseBalanceModel())
+
+	newTestManager(channelManager, nil)
+
+	// The raw balance is within the thresholds, but not the spendable one
+	channel := modelChannel()
+	channel.LocalBalance = 310000
+	channel.RemoteBalance = 680000
+
+	channelManager.sm.checkChannel(context.Background(), channel)
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, &providers.Balances{Local: 290000, Remote: 680000, Capacity: 1000000}, sentEvents[0].Balances)
+	assert.Equal(t, []*providers.Field{
+		{Name: "Breached limit", Value: "Minimal ratio of 0.3"},
+		{Name: "Balance model", Value: "spendable"},
+	}, sentEvents[0].Fields)
+
+	cleanUp()
+}
@@ -1,82 +1,83 @@
 package notifications
 
 import (
+	"context"
 	"github.com/google/logger"
-	"github.com/lightningnetwork/lnd/lnrpc"
-	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 )
 
-func (manager *ChannelManager) prepareBalanceCheck() {
-	channels, err := manager.lnd.ListChannels()
+func (manager *ChannelManager) prepareBalanceCheck(ctx context.Context) {
+	channels, err := manager.lnd.ListChannels(ctx)
 
 	if err != nil {
 		logger.Error("Could not get channels: " + err.Error())
 		return
 	}
 
-	manager.sm.populateChannels(channels)
+	manager.catchUp(ctx, channels)
+	manager.sm.populateChannels(ctx, channels)
+	manager.activity.sync(ctx, channels.Channels)
+	manager.syncPendingChannels(ctx)
 }
 
-func (manager *ChannelManager) subscribeHtlcEvents() {
-	logger.Info("Subscribing to HTLC events")
+// recoverMissedEvents catches up on the opens and closes and reconciles the state of the channels, which could
+// have changed while the connection to LND was lost, like it is done when the bot starts
+func (manager *ChannelManager) recoverMissedEvents(ctx context.Context) {
+	channels, err := manager.lnd.ListChannels(ctx)
 
-	htlcEvents := make(chan *routerrpc.HtlcEvent)
-	htlcsErrChan := make(chan error)
+	if err != nil {
+		logger.Error("Could not refresh channels: " + err.Error())
+		return
+	}
 
-	manager.lnd.SubscribeHtlcEvents(htlcEvents, htlcsErrChan)
+	if manager.store.enabled() {
+		manager.catchUp(ctx, channels)
+	} else {
+		manager.catchUpTracked(ctx, channels)
+	}
 
-	logger.Info("Subscribing to invoices")
+	manager.sm.refreshChannels(ctx, channels)
+	manager.hs.reconcile(channels.Channels)
+	manager.activity.sync(ctx, channels.Channels)
+	manager.pollPendingChannels(ctx)
+}
+
+// reconcile replaces the tracked channels and pending HTLCs with the ones of LND,
+// because the balances calculated from events drift over time
+func (manager *ChannelManager) reconcile(ctx context.Context) {
+	channels, err := manager.lnd.ListChannels(ctx)
+
+	if err != nil {
+		logger.Error("Could not reconcile channels: " + err.Error())
+		return
+	}
 
-	invoices := make(chan *lnrpc.Invoice)
-	invoicesErrChan := make(chan error)
+	manager.sm.reconcileChannels(ctx, channels)
+	manager.hs.reconcile(channels.Channels)
+	manager.activity.sync(ctx, channels.Channels)
+}
 
-	manager.lnd.SubscribeInvoices(invoices, invoicesErrChan)
+// syncPendingChannels starts tracking the channels that were already pending open or closing when the bot started
+func (manager *ChannelManager) syncPendingChannels(ctx context.Context) {
+	pendingChannels, err := manager.lnd.PendingChannels(ctx)
 
-	manager.subs = &subscriptionChannels{
-		htlcEvents:      htlcEvents,
-		htlcErrChan:     htlcsErrChan,
-		invoices:        invoices,
-		invoicesErrChan: invoicesErrChan,
+	if err != nil {
+		logger.Error("Could not get pending channels: " + err.Error())
+		return
 	}
+
+	manager.opens.sync(ctx, pendingChannels)
+	manager.closes.sync(ctx, pendingChannels)
 }
 
-func (manager *ChannelManager) handleHtlcEvents(
-	openedChannels <-chan *lnrpc.Channel,
-	closedChannels <-chan *lnrpc.ChannelCloseSummary,
-) {
-	hc := initHtlcStates(manager.sm)
-
-	for {
-		select {
-		case opened := <-openedChannels:
-			manager.sm.handleOpen(opened)
-			break
-
-		case closed := <-closedChannels:
-			manager.sm.handleClose(closed)
-			break
-
-		case event := <-manager.subs.htlcEvents:
-			if event.EventType == routerrpc.HtlcEvent_SEND || event.EventType == routerrpc.HtlcEvent_FORWARD {
-				hc.handleEvent(event)
-			}
-			break
-
-		case invoice := <-manager.subs.invoices:
-			if invoice.State != lnrpc.Invoice_SETTLED {
-				break
-			}
-
-			manager.sm.handleSettledInvoice(invoice)
-			break
-
-		case err := <-manager.subs.htlcErrChan:
-			logger.Fatal("LND channel event subscription errored: " + err.Error())
-			break
-
-		case err := <-manager.subs.invoicesErrChan:
-			logger.Fatal("LND invoice subscription errored: " + err.Error())
-			break
-		}
+// pollPendingChannels notifies about the progress of the channels that are pending open or closing
+func (manager *ChannelManager) pollPendingChannels(ctx context.Context) {
+	pendingChannels, err := manager.lnd.PendingChannels(ctx)
+
+	if err != nil {
+		logger.Warning("Could not poll pending channels: " + err.Error())
+		return
 	}
+
+	manager.opens.update(ctx, pendingChannels)
+	manager.closes.update(ctx, pendingChannels, true)
 }
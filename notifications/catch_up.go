@@ -0,0 +1,88 @@
+package notifications
+
+import (
+	"context"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"strconv"
+)
+
+// catchUp compares the channels of LND with the ones the bot has seen before it was stopped
+// and sends notifications for the channels that were opened or closed in the meantime
+func (manager *ChannelManager) catchUp(ctx context.Context, channels *lnrpc.ListChannelsResponse) {
+	if !manager.store.enabled() {
+		return
+	}
+
+	closedChannels, err := manager.lnd.ClosedChannels(ctx)
+
+	if err != nil {
+		logger.Error("Could not get closed channels: " + err.Error())
+		return
+	}
+
+	known, synced := manager.store.loadKnownChannels()
+	missed := 0
+
+	for _, channel := range channels.Channels {
+		if known[channel.ChannelPoint] != nil {
+			continue
+		}
+
+		if synced {
+			manager.logOpenedChannel(ctx, channel, true)
+			missed++
+		}
+
+		manager.store.saveKnownChannel(channel.ChannelPoint, &knownChannel{
+			ChanId: channel.ChanId,
+		})
+	}
+
+	for _, channel := range closedChannels.Channels {
+		if previous := known[channel.ChannelPoint]; previous != nil && previous.Closed {
+			continue
+		}
+
+		if synced {
+			manager.logClosedChannel(ctx, channel, true)
+			missed++
+		}
+
+		manager.store.saveKnownChannel(channel.ChannelPoint, &knownChannel{
+			ChanId: channel.ChanId,
+			Closed: true,
+		})
+	}
+
+	if !synced {
+		manager.store.setChannelsSynced()
+		logger.Info("Recorded channels to catch up on opens and closes after restarts")
+		return
+	}
+
+	logger.Info("Caught up on " + strconv.Itoa(missed) + " channel opens and closes")
+}
+
+// catchUpTracked compares the channels of LND with the tracked ones when there is no database to catch up on
+// the channels that were opened or closed while the connection to LND was lost
+func (manager *ChannelManager) catchUpTracked(ctx context.Context, channels *lnrpc.ListChannelsResponse) {
+	closedChannels, err := manager.lnd.ClosedChannels(ctx)
+
+	if err != nil {
+		logger.Error("Could not get closed channels: " + err.Error())
+		return
+	}
+
+	for _, channel := range channels.Channels {
+		if manager.sm.channels[channel.ChanId] == nil {
+			manager.logOpenedChannel(ctx, channel, true)
+		}
+	}
+
+	for _, channel := range closedChannels.Channels {
+		if manager.sm.channels[channel.ChanId] != nil {
+			manager.logClosedChannel(ctx, channel, true)
+		}
+	}
+}
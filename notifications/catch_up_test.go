@@ -0,0 +1,148 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCatchUp(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	store := openStore(t)
+
+	channelManager := newTestManager(&ChannelManager{logInsignificant: true, store: store}, nil)
+
+	open := &lnrpc.ListChannelsResponse{
+		Channels: []*lnrpc.Channel{
+			{
+				ChanId:       1,
+				ChannelPoint: "txid:0",
+				RemotePubkey: "pubkey",
+			},
+		},
+	}
+
+	closedChannels = []*lnrpc.ChannelCloseSummary{
+		{
+			ChanId:       2,
+			ChannelPoint: "txid:1",
+			RemotePubkey: "pubkey",
+			CloseType:    lnrpc.ChannelCloseSummary_COOPERATIVE_CLOSE,
+		},
+	}
+
+	// The channels that exist when the bot is started for the first time are only recorded
+	channelManager.catchUp(context.Background(), open)
+
+	assert.Len(t, sentEvents, 0)
+
+	known, synced := store.loadKnownChannels()
+
+	assert.True(t, synced)
+	assert.Equal(t, &knownChannel{ChanId: 1}, known["txid:0"])
+	assert.Equal(t, &knownChannel{ChanId: 2, Closed: true}, known["txid:1"])
+
+	// Channel 1 closed and channel 3 opened while the bot was offline
+	closedChannels = append(closedChannels, &lnrpc.ChannelCloseSummary{
+		ChanId:       1,
+		ChannelPoint: "txid:0",
+		RemotePubkey: "pubkey",
+		CloseType:    lnrpc.ChannelCloseSummary_REMOTE_FORCE_CLOSE,
+	})
+
+	channelManager.catchUp(context.Background(), &lnrpc.ListChannelsResponse{
+		Channels: []*lnrpc.Channel{
+			{
+				ChanId:         3,
+				ChannelPoint:   "txid:2",
+				RemotePubkey:   "pubkey",
+				Capacity:       1000000,
+				Initiator:      true,
+				CommitmentType: lnrpc.CommitmentType_ANCHORS,
+			},
+		},
+	})
+
+	assert.Len(t, sentEvents, 2)
+
+	assert.Equal(t, providers.EventOpened, sentEvents[0].Type)
+	assert.True(t, sentEvents[0].CatchUp)
+	assert.Equal(t, "Channel to pubkey was opened while the bot was offline", sentEvents[0].Title)
+	assert.Equal(t, ":hourglass: **Missed while offline:** Channel `3` to `pubkey` was opened:\n"+
+		"  Capacity: 1,000,000 sats\n"+
+		"  Initiator: local\n"+
+		"  Visibility: public\n"+
+		"  Commitment type: anchors\n"+
+		"  Channel point: `txid:2`", sentMessages[0])
+
+	assert.Equal(t, providers.EventForceClosed, sentEvents[1].Type)
+	assert.True(t, sentEvents[1].CatchUp)
+	assert.Equal(t, uint64(1), sentEvents[1].Channel.ID)
+
+	cleanUp()
+
+	// Nothing is reported twice
+	channelManager.catchUp(context.Background(), &lnrpc.ListChannelsResponse{
+		Channels: []*lnrpc.Channel{
+			{
+				ChanId:       3,
+				ChannelPoint: "txid:2",
+				RemotePubkey: "pubkey",
+			},
+		},
+	})
+
+	assert.Len(t, sentEvents, 0)
+
+	closedChannels = nil
+	cleanUp()
+}
+
+func TestCatchUpLiveEvents(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	store := openStore(t)
+	store.setChannelsSynced()
+
+	channelManager := newTestManager(&ChannelManager{logInsignificant: true, store: store}, nil)
+
+	channel := &lnrpc.Channel{
+		ChanId:        1,
+		ChannelPoint:  "txid:0",
+		RemotePubkey:  "pubkey",
+		LocalBalance:  50,
+		RemoteBalance: 50,
+		Capacity:      100,
+	}
+
+	// Channels that are opened and closed while the bot is running are not caught up on
+	channelManager.sm.handleOpen(context.Background(), channel)
+
+	closedChannels = []*lnrpc.ChannelCloseSummary{
+		{
+			ChanId:       1,
+			ChannelPoint: "txid:0",
+			RemotePubkey: "pubkey",
+		},
+	}
+	channelManager.sm.handleClose(context.Background(), closedChannels[0])
+
+	cleanUp()
+
+	channelManager.catchUp(context.Background(), &lnrpc.ListChannelsResponse{})
+
+	assert.Len(t, sentEvents, 0)
+
+	closedChannels = nil
+	cleanUp()
+}
@@ -1,156 +1,505 @@
 package notifications
 
 import (
+	"context"
+	"errors"
+	"github.com/BoltzExchange/channel-bot/utils"
+	"github.com/google/logger"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"slices"
 	"strconv"
+	"time"
+)
+
+const (
+	defaultMinRatio = 0.3
+	defaultMaxRatio = 0.7
 )
 
 type stateManager struct {
 	manager *ChannelManager
+	clock   *utils.Clock
+
+	// Rules in the order in which they are matched
+	rules    []*Rule
+	tags     map[string][]string
+	cooldown time.Duration
 
-	significantChannels map[uint64]*SignificantChannel
+	// Time after which channels with pending HTLCs are notified when any outcome of the HTLCs breaches a limit
+	unsettledTimeout time.Duration
+
+	significantChannels []*SignificantChannel
 	imbalancedChannels  map[uint64]bool
 
-	channels map[uint64]*lnrpc.Channel
-}
+	// The state of the channels when the last notification about them was sent
+	notifiedStates map[uint64]*channelState
+	// Since when channels have had pending HTLCs
+	unsettledChannels map[uint64]time.Time
+
+	// Peers whose channels are checked combined are keyed by their pubkey
+	significantPeers map[string]*SignificantPeer
+	imbalancedPeers  map[string]bool
+	peerStates       map[string]*channelState
+	unsettledPeers   map[string]time.Time
 
-var defaultRatios = ratios{
-	max: 0.7,
-	min: 0.3,
+	channels map[uint64]*lnrpc.Channel
 }
 
 func initStateManager(manager *ChannelManager, significantChannels []*SignificantChannel) *stateManager {
 	sm := &stateManager{
 		manager: manager,
+		clock:   &utils.Clock{},
+
+		tags:     invertTags(manager.Tags),
+		cooldown: time.Duration(manager.Cooldown) * time.Second,
+
+		unsettledTimeout: time.Duration(manager.UnsettledTimeout) * time.Second,
 
-		significantChannels: map[uint64]*SignificantChannel{},
+		significantChannels: significantChannels,
 		imbalancedChannels:  map[uint64]bool{},
 
+		notifiedStates:    manager.store.loadChannelStates(),
+		unsettledChannels: map[uint64]time.Time{},
+
+		significantPeers: map[string]*SignificantPeer{},
+		imbalancedPeers:  map[string]bool{},
+		peerStates:       manager.store.loadPeerStates(),
+		unsettledPeers:   map[string]time.Time{},
+
 		channels: map[uint64]*lnrpc.Channel{},
 	}
 
-	for _, significant := range significantChannels {
-		maxRatio, _ := strconv.ParseFloat(significant.MaxRatio, 64)
-		minRatio, _ := strconv.ParseFloat(significant.MinRatio, 64)
+	defaultRatios := ratios{
+		max:        defaultMaxRatio,
+		min:        defaultMinRatio,
+		hysteresis: manager.Hysteresis,
+		minDwell:   time.Duration(manager.MinDwell) * time.Second,
+		model:      manager.balanceModel,
+	}
 
-		significant.ratios = ratios{
-			max: maxRatio,
-			min: minRatio,
+	sm.rules = append(append(sm.rules, manager.Rules...), defaultRule(defaultRatios))
+
+	for chanId, state := range sm.notifiedStates {
+		if state.Imbalanced {
+			sm.imbalancedChannels[chanId] = true
 		}
+	}
 
-		sm.significantChannels[significant.ChannelID] = significant
+	for pubkey, state := range sm.peerStates {
+		if state.Imbalanced {
+			sm.imbalancedPeers[pubkey] = true
+		}
+	}
+
+	for _, significant := range manager.SignificantPeers {
+		sm.significantPeers[significant.Pubkey] = significant
 	}
 
 	return sm
 }
 
-func (sm *stateManager) populateChannels(channels *lnrpc.ListChannelsResponse) {
+// parseSignificantRatios parses the thresholds of significant channels and peers. Ratios that are not set are not
+// checked and the hysteresis and the minimal dwell time default to the ones of the manager
+func (manager *ChannelManager) parseSignificantRatios(
+	minRatio string,
+	maxRatio string,
+	hysteresis string,
+	minDwell int,
+	limits ratios,
+) (parsed ratios, err error) {
+	parsed = limits
+	parsed.hysteresis = manager.Hysteresis
+	parsed.minDwell = time.Duration(manager.MinDwell) * time.Second
+	parsed.model = manager.balanceModel
+
+	parsed.disableRatios()
+
+	if maxRatio != "" {
+		if parsed.max, err = strconv.ParseFloat(maxRatio, 64); err != nil {
+			return parsed, errors.New("max ratio is not a number")
+		}
+	}
+
+	if minRatio != "" {
+		if parsed.min, err = strconv.ParseFloat(minRatio, 64); err != nil {
+			return parsed, errors.New("min ratio is not a number")
+		}
+	}
+
+	if hysteresis != "" {
+		if parsed.hysteresis, err = strconv.ParseFloat(hysteresis, 64); err != nil {
+			return parsed, errors.New("hysteresis is not a number")
+		}
+	}
+
+	if minDwell != 0 {
+		parsed.minDwell = time.Duration(minDwell) * time.Second
+	}
+
+	return parsed, parsed.validateBalanceLimits()
+}
+
+func (sm *stateManager) populateChannels(ctx context.Context, channels *lnrpc.ListChannelsResponse) {
 	for _, channel := range channels.Channels {
 		sm.channels[channel.ChanId] = channel
 	}
 
+	sm.forgetVanishedChannels()
+
 	for _, signi := range sm.significantChannels {
-		if channel := sm.channels[signi.ChannelID]; channel != nil {
-			sm.checkChannel(channel)
-		} else {
+		channels := sm.channelsOfSignificant(signi)
+
+		if len(channels) == 0 {
 			signi.logSignificantNotFound(sm.manager.notificationProvider)
+			continue
+		}
+
+		for _, channel := range channels {
+			sm.checkChannel(ctx, channel)
+		}
+	}
+}
+
+// refreshChannels replaces the tracked channels with the ones fetched from LND
+// and checks all channels whose balances changed in the meantime
+func (sm *stateManager) refreshChannels(ctx context.Context, channels *lnrpc.ListChannelsResponse) {
+	previous := sm.replaceChannels(channels)
+
+	for _, channel := range channels.Channels {
+		old := previous[channel.ChanId]
+
+		if old == nil || old.LocalBalance != channel.LocalBalance || old.RemoteBalance != channel.RemoteBalance {
+			sm.checkChannel(ctx, channel)
 		}
 	}
 }
 
-func (sm *stateManager) handleOpen(channel *lnrpc.Channel) {
+// reconcileChannels replaces the tracked channels with the ones fetched from LND,
+// logs how far the tracked balances drifted and checks all channels again
+func (sm *stateManager) reconcileChannels(ctx context.Context, channels *lnrpc.ListChannelsResponse) {
+	previous := sm.replaceChannels(channels)
+
+	for _, channel := range channels.Channels {
+		if old := previous[channel.ChanId]; old != nil {
+			logBalanceDrift(old, channel)
+		}
+
+		sm.checkChannel(ctx, channel)
+	}
+}
+
+// replaceChannels replaces the tracked channels and returns the previous ones
+func (sm *stateManager) replaceChannels(channels *lnrpc.ListChannelsResponse) map[uint64]*lnrpc.Channel {
+	previous := sm.channels
+	sm.channels = map[uint64]*lnrpc.Channel{}
+
+	for _, channel := range channels.Channels {
+		sm.channels[channel.ChanId] = channel
+	}
+
+	sm.forgetVanishedChannels()
+
+	return previous
+}
+
+func (sm *stateManager) handleOpen(ctx context.Context, channel *lnrpc.Channel) {
 	sm.channels[channel.ChanId] = channel
-	sm.checkChannel(channel)
+	sm.manager.store.saveKnownChannel(channel.ChannelPoint, &knownChannel{
+		ChanId: channel.ChanId,
+	})
+
+	sm.checkChannel(ctx, channel)
 }
 
-func (sm *stateManager) handleClose(closed *lnrpc.ChannelCloseSummary) {
+func (sm *stateManager) handleClose(ctx context.Context, closed *lnrpc.ChannelCloseSummary) {
 	delete(sm.channels, closed.ChanId)
-	delete(sm.imbalancedChannels, closed.ChanId)
+	sm.forgetChannel(closed.ChanId)
+
+	sm.manager.store.saveKnownChannel(closed.ChannelPoint, &knownChannel{
+		ChanId: closed.ChanId,
+		Closed: true,
+	})
+	sm.manager.logClosedChannel(ctx, closed, false)
 
-	sm.manager.logClosedChannel(closed)
+	if sm.aggregatesPeer(closed.RemotePubkey) {
+		sm.checkPeer(ctx, closed.RemotePubkey)
+	}
 
-	if signi := sm.significantChannels[closed.ChanId]; signi != nil {
+	// Significant channels that match a peer can still be found when there are other channels to it
+	if signi := sm.significantClosedChannel(closed); signi != nil && len(sm.channelsOfSignificant(signi)) == 0 {
 		signi.logSignificantNotFound(sm.manager.notificationProvider)
 	}
 }
 
-func (sm *stateManager) handleHtlc(channelId uint64, isIncoming bool, amtMsat uint64) {
+func (sm *stateManager) handleHtlc(ctx context.Context, channelId uint64, htlcId uint64, isIncoming bool, amtMsat uint64) {
 	channel := sm.channels[channelId]
 	if channel == nil {
 		return
 	}
 
-	updateChannelBalances(channel, isIncoming, amtMsat)
-	sm.checkChannel(channel)
+	wasPending := removePendingHtlc(channel, htlcId, isIncoming) != nil
+	updateChannelBalances(channel, isIncoming, amtMsat, wasPending)
+	sm.checkChannel(ctx, channel)
 }
 
-func (sm *stateManager) handleSettledInvoice(invoice *lnrpc.Invoice) {
+// handleFailedHtlc checks the channel again without the HTLC. HTLCs that were pending when the balances were queried
+// are not part of the balance of the sending side, which gets their amount back
+func (sm *stateManager) handleFailedHtlc(ctx context.Context, channelId uint64, htlcId uint64, isIncoming bool) {
+	channel := sm.channels[channelId]
+	if channel == nil {
+		return
+	}
+
+	htlc := removePendingHtlc(channel, htlcId, isIncoming)
+	if htlc == nil {
+		return
+	}
+
+	if isIncoming {
+		channel.RemoteBalance += htlc.Amount
+	} else {
+		channel.LocalBalance += htlc.Amount
+	}
+
+	sm.checkChannel(ctx, channel)
+}
+
+func (sm *stateManager) handleSettledInvoice(ctx context.Context, invoice *lnrpc.Invoice) {
 	touchedChannels := map[uint64]*lnrpc.Channel{}
 
 	for _, htlc := range invoice.Htlcs {
 		channel := sm.channels[htlc.ChanId]
+		if channel == nil {
+			continue
+		}
+
 		touchedChannels[htlc.ChanId] = channel
 
-		updateChannelBalances(channel, true, htlc.AmtMsat)
+		wasPending := removePendingHtlc(channel, htlc.HtlcIndex, true) != nil
+		updateChannelBalances(channel, true, htlc.AmtMsat, wasPending)
 	}
 
 	for _, channel := range touchedChannels {
-		sm.checkChannel(channel)
+		sm.checkChannel(ctx, channel)
 	}
 }
 
-func (sm *stateManager) checkChannel(channel *lnrpc.Channel) {
-	signi, isSignificant := sm.significantChannels[channel.ChanId]
+func (sm *stateManager) checkChannel(ctx context.Context, channel *lnrpc.Channel) {
+	sm.checkConditions(ctx, channel)
+
+	signi := sm.significantChannel(channel)
+	isSignificant := signi != nil
 
-	if !isSignificant && (channel.UnsettledBalance != 0 || channel.Private) {
+	if !isSignificant && sm.aggregatesPeer(channel.RemotePubkey) {
+		sm.checkPeer(ctx, channel.RemotePubkey)
 		return
 	}
 
-	channelRatio := getChannelRatio(channel)
-
+	var rule *Rule
 	var checkRatio ratios
 
 	if isSignificant {
 		checkRatio = signi.ratios
 	} else {
-		checkRatio = defaultRatios
+		rule = sm.matchRule(channel)
+
+		if rule == nil || !rule.notify {
+			return
+		}
+
+		checkRatio = rule.ratios
 	}
 
-	if channelRatio > checkRatio.min && channelRatio < checkRatio.max {
-		if contains := sm.imbalancedChannels[channel.ChanId]; contains {
-			if isSignificant {
-				signi.logBalance(sm.manager.notificationProvider, channel, false)
-			} else {
-				sm.manager.logBalance(channel, false)
-			}
-			delete(sm.imbalancedChannels, channel.ChanId)
+	unsettledTooLong := isUnsettledTooLong(sm.unsettledChannels, channel.ChanId, channel, sm.clock.Now(), sm.unsettledTimeout)
+
+	wasImbalanced := sm.imbalancedChannels[channel.ChanId]
+	isImbalanced, modeled := checkRatio.checkOutcomes(checkRatio.model.apply(channel), wasImbalanced, unsettledTooLong)
+
+	state := sm.notifiedStates[channel.ChanId]
+
+	if state == nil {
+		state = &channelState{
+			Imbalanced: wasImbalanced,
+		}
+	}
+
+	notify, modified := sm.evaluateChange(state, wasImbalanced, isImbalanced, checkRatio.minDwell)
+
+	if !notify {
+		if modified {
+			sm.notifiedStates[channel.ChanId] = state
+			sm.manager.store.saveChannelState(channel.ChanId, state)
 		}
 
 		return
 	}
 
-	if contains := sm.imbalancedChannels[channel.ChanId]; contains {
-		return
+	if isSignificant {
+		signi.logBalance(sm.manager.notificationProvider, modeled, isImbalanced, state.SuppressedFlips)
+	} else {
+		sm.manager.logBalance(ctx, modeled, rule, isImbalanced, state.SuppressedFlips)
 	}
 
-	sm.imbalancedChannels[channel.ChanId] = true
+	sm.setImbalanced(channel, isImbalanced)
+}
 
-	if isSignificant {
-		signi.logBalance(sm.manager.notificationProvider, channel, true)
+// evaluateChange tracks for how long the balance state differs from the notified one and returns whether
+// the change should be notified and whether the state was modified. Changes that are reverted before they
+// are notified are counted as suppressed flips
+func (sm *stateManager) evaluateChange(state *channelState, wasImbalanced bool, isImbalanced bool, minDwell time.Duration) (bool, bool) {
+	if isImbalanced == wasImbalanced {
+		if state.PendingSince.IsZero() {
+			return false, false
+		}
+
+		state.PendingSince = time.Time{}
+		state.SuppressedFlips++
+
+		return false, true
+	}
+
+	now := sm.clock.Now()
+
+	if state.PendingSince.IsZero() {
+		state.PendingSince = now
+	}
+
+	if now.Sub(state.PendingSince) < minDwell || sm.inCooldown(state, now) {
+		return false, true
+	}
+
+	return true, true
+}
+
+func (sm *stateManager) inCooldown(state *channelState, now time.Time) bool {
+	return !state.NotifiedAt.IsZero() && now.Sub(state.NotifiedAt) < sm.cooldown
+}
+
+// setImbalanced updates the imbalance flag of the channel and persists the state that was notified
+func (sm *stateManager) setImbalanced(channel *lnrpc.Channel, isImbalanced bool) {
+	if isImbalanced {
+		sm.imbalancedChannels[channel.ChanId] = true
 	} else {
-		sm.manager.logBalance(channel, true)
+		delete(sm.imbalancedChannels, channel.ChanId)
+	}
+
+	state := &channelState{
+		Imbalanced:      isImbalanced,
+		LocalBalance:    channel.LocalBalance,
+		RemoteBalance:   channel.RemoteBalance,
+		NotifiedAt:      sm.clock.Now(),
+		AlertedAtUpdate: channel.NumUpdates,
+	}
+
+	if previous := sm.notifiedStates[channel.ChanId]; previous != nil {
+		state.MetConditions = previous.MetConditions
 	}
+
+	sm.notifiedStates[channel.ChanId] = state
+	sm.manager.store.saveChannelState(channel.ChanId, state)
+}
+
+func (sm *stateManager) forgetChannel(chanId uint64) {
+	delete(sm.imbalancedChannels, chanId)
+	delete(sm.notifiedStates, chanId)
+	delete(sm.unsettledChannels, chanId)
+
+	sm.manager.store.deleteChannelState(chanId)
 }
 
-func updateChannelBalances(channel *lnrpc.Channel, isIncoming bool, amountMsat uint64) {
+// forgetVanishedChannels drops the state of channels that are not open anymore
+func (sm *stateManager) forgetVanishedChannels() {
+	for chanId := range sm.imbalancedChannels {
+		if sm.channels[chanId] == nil {
+			sm.forgetChannel(chanId)
+		}
+	}
+
+	for chanId := range sm.notifiedStates {
+		if sm.channels[chanId] == nil {
+			sm.forgetChannel(chanId)
+		}
+	}
+
+	for chanId := range sm.unsettledChannels {
+		if sm.channels[chanId] == nil {
+			sm.forgetChannel(chanId)
+		}
+	}
+
+	for pubkey := range sm.peerStates {
+		if len(sm.peerChannels(pubkey)) == 0 {
+			sm.forgetPeer(pubkey)
+		}
+	}
+
+	for pubkey := range sm.unsettledPeers {
+		if len(sm.peerChannels(pubkey)) == 0 {
+			sm.forgetPeer(pubkey)
+		}
+	}
+}
+
+// updateChannelBalances moves the amount of the settled HTLC to the receiving side. HTLCs that were pending when the
+// balances were queried are not part of the balance of the sending side anymore
+func updateChannelBalances(channel *lnrpc.Channel, isIncoming bool, amountMsat uint64, wasPending bool) {
+	amountSat := int64(amountMsat / 1000)
+
+	receiving, sending := &channel.LocalBalance, &channel.RemoteBalance
 	if !isIncoming {
-		amountMsat = -amountMsat
+		receiving, sending = sending, receiving
 	}
 
-	amountSat := int64(amountMsat) / 1000
+	*receiving += amountSat
+
+	if !wasPending {
+		*sending -= amountSat
+	}
+
+	// Counts the settled HTLC as update until the next reconcile fetches the actual number from LND
+	channel.NumUpdates++
+}
+
+// removePendingHtlc removes the resolved HTLC from the pending ones of the channel, so that it is not counted in
+// the outcomes and the unsettled balance anymore. Incoming and outgoing HTLCs are indexed separately by LND.
+// Returns the removed HTLC or nil if it was not pending
+func removePendingHtlc(channel *lnrpc.Channel, htlcId uint64, isIncoming bool) *lnrpc.HTLC {
+	for i, htlc := range channel.PendingHtlcs {
+		if htlc.HtlcIndex != htlcId || htlc.Incoming != isIncoming {
+			continue
+		}
+
+		channel.PendingHtlcs = slices.Delete(channel.PendingHtlcs, i, i+1)
+		channel.UnsettledBalance = max(channel.UnsettledBalance-htlc.Amount, 0)
+
+		return htlc
+	}
+
+	return nil
+}
+
+func logBalanceDrift(tracked *lnrpc.Channel, actual *lnrpc.Channel) {
+	localDrift := actual.LocalBalance - tracked.LocalBalance
+	remoteDrift := actual.RemoteBalance - tracked.RemoteBalance
+
+	if localDrift == 0 && remoteDrift == 0 {
+		return
+	}
+
+	logger.Info("Tracked balances of channel " + strconv.FormatUint(actual.ChanId, 10) + " drifted by " +
+		strconv.FormatInt(localDrift, 10) + " sats local and " + strconv.FormatInt(remoteDrift, 10) + " sats remote")
+}
+
+// isImbalanced checks the ratio against the thresholds. Channels that are imbalanced
+// have to be within the thresholds by the hysteresis to be considered balanced again
+func (r ratios) isImbalanced(channelRatio float64, wasImbalanced bool) bool {
+	band := 0.0
+
+	if wasImbalanced {
+		band = r.hysteresis
+	}
 
-	channel.LocalBalance += amountSat
-	channel.RemoteBalance -= amountSat
+	return !(channelRatio > r.min+band && channelRatio < r.max-band)
 }
 
 func getChannelRatio(channel *lnrpc.Channel) float64 {
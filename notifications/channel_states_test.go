@@ -1,17 +1,19 @@
 package notifications
 
 import (
-	"github.com/BoltzExchange/channel-bot/utils"
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
 	"github.com/google/logger"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/stretchr/testify/assert"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func checkParseSignificantChannel(t *testing.T, cm *ChannelManager, unparsedChannel *SignificantChannel) {
-	parsedChannel := cm.sm.significantChannels[unparsedChannel.ChannelID]
+	parsedChannel := cm.sm.significantChannel(&lnrpc.Channel{ChanId: unparsedChannel.ChannelID})
 
 	assert.Equal(t, unparsedChannel.Alias, parsedChannel.Alias)
 	assert.Equal(t, unparsedChannel.ChannelID, parsedChannel.ChannelID)
@@ -38,13 +40,7 @@ func TestParseSignificantChannels(t *testing.T) {
 	mockWriter := &MockWriter{}
 	logger.Init("", false, false, mockWriter)
 
-	channelManager := &ChannelManager{
-		lnd:                  &MockLndClient{},
-		notificationProvider: &MockDiscordClient{},
-		nc:                   initNodeCache(&MockLndClient{}, &utils.Clock{}),
-	}
-
-	channelManager.sm = initStateManager(channelManager, significantChannels)
+	channelManager := newTestManager(&ChannelManager{}, significantChannels)
 
 	checkParseSignificantChannel(t, channelManager, significantChannels[0])
 	checkParseSignificantChannel(t, channelManager, significantChannels[1])
@@ -54,12 +50,6 @@ func TestPopulateChannels(t *testing.T) {
 	mockWriter := &MockWriter{}
 	logger.Init("", false, false, mockWriter)
 
-	channelManager := &ChannelManager{
-		lnd:                  &MockLndClient{},
-		notificationProvider: &MockDiscordClient{},
-		nc:                   initNodeCache(&MockLndClient{}, &utils.Clock{}),
-	}
-
 	significants := []*SignificantChannel{
 		{
 			Alias:     "Test",
@@ -74,7 +64,7 @@ func TestPopulateChannels(t *testing.T) {
 			MaxRatio:  "0.9",
 		},
 	}
-	sm := initStateManager(channelManager, significants)
+	sm := newTestManager(&ChannelManager{}, significants).sm
 
 	chs := &lnrpc.ListChannelsResponse{
 		Channels: []*lnrpc.Channel{
@@ -87,7 +77,7 @@ func TestPopulateChannels(t *testing.T) {
 		},
 	}
 
-	sm.populateChannels(chs)
+	sm.populateChannels(context.Background(), chs)
 
 	assert.Len(t, sm.channels, len(chs.Channels))
 
@@ -99,24 +89,80 @@ func TestPopulateChannels(t *testing.T) {
 	}
 }
 
-func TestHandleOpen(t *testing.T) {
+func TestRefreshChannels(t *testing.T) {
 	mockWriter := &MockWriter{}
 	logger.Init("", false, false, mockWriter)
 
-	channelManager := &ChannelManager{
-		lnd:                  &MockLndClient{},
-		notificationProvider: &MockDiscordClient{},
-		nc:                   initNodeCache(&MockLndClient{}, &utils.Clock{}),
-	}
+	sm := newTestManager(&ChannelManager{logInsignificant: true}, nil).sm
+
+	sm.handleOpen(context.Background(), &lnrpc.Channel{
+		ChanId:        1,
+		LocalBalance:  50,
+		RemoteBalance: 50,
+		Capacity:      100,
+	})
+	sm.handleOpen(context.Background(), &lnrpc.Channel{
+		ChanId:        2,
+		LocalBalance:  90,
+		RemoteBalance: 10,
+		Capacity:      100,
+	})
+
+	assert.True(t, sm.imbalancedChannels[2])
+
+	cleanUp()
+
+	sm.refreshChannels(context.Background(), &lnrpc.ListChannelsResponse{
+		Channels: []*lnrpc.Channel{
+			{
+				ChanId:        1,
+				LocalBalance:  10,
+				RemoteBalance: 90,
+				Capacity:      100,
+			},
+		},
+	})
+
+	assert.Len(t, sm.channels, 1)
+	assert.Equal(t, int64(10), sm.channels[1].LocalBalance)
+
+	assert.True(t, sm.imbalancedChannels[1])
+	assert.False(t, sm.imbalancedChannels[2])
+
+	assert.Len(t, sentMessages, 1)
+	assert.True(t, strings.Contains(sentMessages[0], "imbalanced"))
+
+	cleanUp()
+
+	// Unchanged channels should not be checked again
+	sm.refreshChannels(context.Background(), &lnrpc.ListChannelsResponse{
+		Channels: []*lnrpc.Channel{
+			{
+				ChanId:        1,
+				LocalBalance:  10,
+				RemoteBalance: 90,
+				Capacity:      100,
+			},
+		},
+	})
+
+	assert.Len(t, sentMessages, 0)
+
+	cleanUp()
+}
+
+func TestHandleOpen(t *testing.T) {
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
 
-	sm := initStateManager(channelManager, nil)
+	sm := newTestManager(&ChannelManager{}, nil).sm
 
 	channel := &lnrpc.Channel{
 		ChanId:  123321123,
 		Private: true,
 	}
 
-	sm.handleOpen(channel)
+	sm.handleOpen(context.Background(), channel)
 
 	assert.NotNil(t, sm.channels[channel.ChanId])
 }
@@ -125,22 +171,13 @@ func TestHandleClose(t *testing.T) {
 	mockWriter := &MockWriter{}
 	logger.Init("", false, false, mockWriter)
 
-	channelManager := &ChannelManager{
-		lnd: &MockLndClient{
-			nodeAlias: "someNode",
-		},
-		logInsignificant:     true,
-		notificationProvider: &MockDiscordClient{},
-	}
-	channelManager.nc = initNodeCache(channelManager.lnd, &utils.Clock{})
-
 	significants := []*SignificantChannel{{
 		Alias:     "Test",
 		ChannelID: 842390,
 		MinRatio:  "0.1",
 		MaxRatio:  "0.9",
 	}}
-	sm := initStateManager(channelManager, significants)
+	sm := newTestManager(&ChannelManager{lnd: &MockLndClient{nodeAlias: "someNode"}, logInsignificant: true}, significants).sm
 
 	chs := &lnrpc.ListChannelsResponse{
 		Channels: []*lnrpc.Channel{
@@ -152,11 +189,11 @@ func TestHandleClose(t *testing.T) {
 			},
 		},
 	}
-	sm.populateChannels(chs)
+	sm.populateChannels(context.Background(), chs)
 
 	cleanUp()
 
-	sm.handleClose(&lnrpc.ChannelCloseSummary{
+	sm.handleClose(context.Background(), &lnrpc.ChannelCloseSummary{
 		ChanId:    chs.Channels[0].ChanId,
 		CloseType: lnrpc.ChannelCloseSummary_COOPERATIVE_CLOSE,
 	})
@@ -171,7 +208,7 @@ func TestHandleClose(t *testing.T) {
 
 	cleanUp()
 
-	sm.handleClose(&lnrpc.ChannelCloseSummary{
+	sm.handleClose(context.Background(), &lnrpc.ChannelCloseSummary{
 		ChanId:    chs.Channels[1].ChanId,
 		CloseType: lnrpc.ChannelCloseSummary_COOPERATIVE_CLOSE,
 	})
@@ -192,16 +229,9 @@ func TestHandleHtlc(t *testing.T) {
 	mockWriter := &MockWriter{}
 	logger.Init("", false, false, mockWriter)
 
-	channelManager := &ChannelManager{
-		logInsignificant:     true,
-		lnd:                  &MockLndClient{},
-		notificationProvider: &MockDiscordClient{},
-		nc:                   initNodeCache(&MockLndClient{}, &utils.Clock{}),
-	}
+	sm := newTestManager(&ChannelManager{logInsignificant: true}, nil).sm
 
-	sm := initStateManager(channelManager, nil)
-
-	sm.handleHtlc(0, false, 0)
+	sm.handleHtlc(context.Background(), 0, 0, false, 0)
 
 	channel := &lnrpc.Channel{
 		ChanId:        567234,
@@ -209,8 +239,8 @@ func TestHandleHtlc(t *testing.T) {
 		RemoteBalance: 50,
 		Capacity:      100,
 	}
-	sm.handleOpen(channel)
-	sm.handleHtlc(channel.ChanId, true, 50000)
+	sm.handleOpen(context.Background(), channel)
+	sm.handleHtlc(context.Background(), channel.ChanId, 0, true, 50000)
 
 	assert.Len(t, sentMessages, 1)
 	assert.Len(t, loggedMessages, 1)
@@ -224,16 +254,9 @@ func TestHandleSettledInvoice(t *testing.T) {
 	mockWriter := &MockWriter{}
 	logger.Init("", false, false, mockWriter)
 
-	channelManager := &ChannelManager{
-		logInsignificant:     true,
-		lnd:                  &MockLndClient{},
-		notificationProvider: &MockDiscordClient{},
-		nc:                   initNodeCache(&MockLndClient{}, &utils.Clock{}),
-	}
-
-	sm := initStateManager(channelManager, nil)
+	sm := newTestManager(&ChannelManager{logInsignificant: true}, nil).sm
 
-	sm.handleHtlc(0, false, 0)
+	sm.handleHtlc(context.Background(), 0, 0, false, 0)
 
 	channel := &lnrpc.Channel{
 		ChanId:        567234,
@@ -241,14 +264,19 @@ func TestHandleSettledInvoice(t *testing.T) {
 		RemoteBalance: 50,
 		Capacity:      100,
 	}
-	sm.handleOpen(channel)
+	sm.handleOpen(context.Background(), channel)
 
-	sm.handleSettledInvoice(&lnrpc.Invoice{
+	sm.handleSettledInvoice(context.Background(), &lnrpc.Invoice{
 		Htlcs: []*lnrpc.InvoiceHTLC{
 			{
 				ChanId:  channel.ChanId,
 				AmtMsat: uint64(channel.RemoteBalance) * 1000,
 			},
+			// HTLCs of unknown channels are ignored
+			{
+				ChanId:  1,
+				AmtMsat: 1000,
+			},
 		},
 	})
 
@@ -264,21 +292,13 @@ func TestCheckChannel(t *testing.T) {
 	mockWriter := &MockWriter{}
 	logger.Init("", false, false, mockWriter)
 
-	channelManager := &ChannelManager{
-		lnd: &MockLndClient{
-			nodeAlias: "someNode",
-		},
-		notificationProvider: &MockDiscordClient{},
-	}
-	channelManager.nc = initNodeCache(channelManager.lnd, &utils.Clock{})
-
 	significants := []*SignificantChannel{{
 		Alias:     "Test",
 		ChannelID: 842390,
 		MinRatio:  "0.1",
 		MaxRatio:  "0.9",
 	}}
-	sm := initStateManager(channelManager, significants)
+	sm := newTestManager(&ChannelManager{lnd: &MockLndClient{nodeAlias: "someNode"}}, significants).sm
 
 	chs := &lnrpc.ListChannelsResponse{
 		Channels: []*lnrpc.Channel{
@@ -290,7 +310,7 @@ func TestCheckChannel(t *testing.T) {
 			},
 		},
 	}
-	sm.populateChannels(chs)
+	sm.populateChannels(context.Background(), chs)
 
 	assert.Len(t, sentMessages, 1)
 	assert.Len(t, loggedMessages, 1)
@@ -299,12 +319,12 @@ func TestCheckChannel(t *testing.T) {
 
 	cleanUp()
 
-	sm.checkChannel(&lnrpc.Channel{
+	sm.checkChannel(context.Background(), &lnrpc.Channel{
 		ChanId:  123,
 		Private: true,
 	})
 
-	sm.checkChannel(&lnrpc.Channel{
+	sm.checkChannel(context.Background(), &lnrpc.Channel{
 		ChanId:           123,
 		UnsettledBalance: 12,
 	})
@@ -314,7 +334,7 @@ func TestCheckChannel(t *testing.T) {
 
 	cleanUp()
 
-	sm.checkChannel(&lnrpc.Channel{
+	sm.checkChannel(context.Background(), &lnrpc.Channel{
 		ChanId:       significants[0].ChannelID,
 		LocalBalance: 5,
 		Capacity:     10,
@@ -335,7 +355,7 @@ func TestUpdateChannelBalances(t *testing.T) {
 	remoteBalanceBefore := channel.RemoteBalance
 
 	amountMsat := uint64(1231)
-	updateChannelBalances(channel, true, amountMsat)
+	updateChannelBalances(channel, true, amountMsat, false)
 
 	assert.Equal(t, localBalanceBefore+int64(amountMsat/1000), channel.LocalBalance)
 	assert.Equal(t, remoteBalanceBefore-int64(amountMsat/1000), channel.RemoteBalance)
@@ -344,10 +364,19 @@ func TestUpdateChannelBalances(t *testing.T) {
 	remoteBalanceBefore = channel.RemoteBalance
 
 	amountMsat = uint64(63212)
-	updateChannelBalances(channel, false, amountMsat)
+	updateChannelBalances(channel, false, amountMsat, false)
 
 	assert.Equal(t, localBalanceBefore-int64(amountMsat/1000), channel.LocalBalance)
 	assert.Equal(t, remoteBalanceBefore+int64(amountMsat/1000), channel.RemoteBalance)
+
+	// The sending side does not include HTLCs that were pending
+	localBalanceBefore = channel.LocalBalance
+	remoteBalanceBefore = channel.RemoteBalance
+
+	updateChannelBalances(channel, true, amountMsat, true)
+
+	assert.Equal(t, localBalanceBefore+int64(amountMsat/1000), channel.LocalBalance)
+	assert.Equal(t, remoteBalanceBefore, channel.RemoteBalance)
 }
 
 func TestGetChannelRatio(t *testing.T) {
@@ -358,3 +387,210 @@ func TestGetChannelRatio(t *testing.T) {
 
 	assert.Equal(t, getChannelRatio(channel), 0.6)
 }
+
+func TestReconcileChannels(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	sm := newTestManager(&ChannelManager{logInsignificant: true}, nil).sm
+
+	sm.handleOpen(context.Background(), &lnrpc.Channel{
+		ChanId:        1,
+		LocalBalance:  50,
+		RemoteBalance: 50,
+		Capacity:      100,
+	})
+
+	// The tracked balance drifted and the channel is imbalanced according to LND
+	sm.channels[1].LocalBalance = 65
+	sm.channels[1].RemoteBalance = 35
+
+	sm.reconcileChannels(context.Background(), &lnrpc.ListChannelsResponse{
+		Channels: []*lnrpc.Channel{
+			{
+				ChanId:        1,
+				LocalBalance:  75,
+				RemoteBalance: 25,
+				Capacity:      100,
+			},
+		},
+	})
+
+	assert.Equal(t, int64(75), sm.channels[1].LocalBalance)
+	assert.True(t, sm.imbalancedChannels[1])
+
+	assert.True(t, strings.HasSuffix(loggedMessages[0], "Tracked balances of channel 1 drifted by 10 sats local and -10 sats remote\n"))
+	assert.Len(t, sentMessages, 1)
+	assert.True(t, strings.Contains(sentMessages[0], "imbalanced"))
+
+	cleanUp()
+
+	// Channels without drift are checked again but not notified twice
+	sm.reconcileChannels(context.Background(), &lnrpc.ListChannelsResponse{
+		Channels: []*lnrpc.Channel{
+			{
+				ChanId:        1,
+				LocalBalance:  75,
+				RemoteBalance: 25,
+				Capacity:      100,
+			},
+		},
+	})
+
+	assert.Len(t, loggedMessages, 0)
+	assert.Len(t, sentMessages, 0)
+
+	cleanUp()
+}
+
+func checkBalance(sm *stateManager, localBalance int64) {
+	sm.handleOpen(context.Background(), &lnrpc.Channel{
+		ChanId:        1,
+		LocalBalance:  localBalance,
+		RemoteBalance: 100 - localBalance,
+		Capacity:      100,
+	})
+}
+
+func TestRatiosIsImbalanced(t *testing.T) {
+	r := ratios{
+		min:        0.3,
+		max:        0.7,
+		hysteresis: 0.05,
+	}
+
+	assert.True(t, r.isImbalanced(0.3, false))
+	assert.False(t, r.isImbalanced(0.31, false))
+	assert.True(t, r.isImbalanced(0.7, false))
+
+	// Imbalanced channels have to be within the thresholds by the hysteresis
+	assert.True(t, r.isImbalanced(0.31, true))
+	assert.True(t, r.isImbalanced(0.35, true))
+	assert.False(t, r.isImbalanced(0.36, true))
+	assert.True(t, r.isImbalanced(0.66, true))
+}
+
+func TestCheckChannelHysteresis(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	sm := newTestManager(&ChannelManager{Hysteresis: 0.05, logInsignificant: true}, nil).sm
+
+	checkBalance(sm, 29)
+	checkBalance(sm, 32)
+	checkBalance(sm, 29)
+
+	assert.Len(t, sentEvents, 1)
+	assert.True(t, sm.imbalancedChannels[1])
+
+	checkBalance(sm, 40)
+
+	assert.Len(t, sentEvents, 2)
+	assert.Equal(t, providers.EventBalanced, sentEvents[1].Type)
+
+	cleanUp()
+}
+
+func TestCheckChannelMinDwell(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	sm := newTestManager(&ChannelManager{MinDwell: 60, logInsignificant: true}, nil).sm
+
+	// The channel did not stay imbalanced long enough
+	checkBalance(sm, 20)
+	sm.clock.MockTime = sm.clock.MockTime.Add(30 * time.Second)
+	checkBalance(sm, 50)
+
+	assert.Len(t, sentEvents, 0)
+	assert.Equal(t, 1, sm.notifiedStates[1].SuppressedFlips)
+
+	checkBalance(sm, 20)
+	sm.clock.MockTime = sm.clock.MockTime.Add(30 * time.Second)
+	checkBalance(sm, 20)
+
+	assert.Len(t, sentEvents, 0)
+
+	sm.clock.MockTime = sm.clock.MockTime.Add(30 * time.Second)
+	checkBalance(sm, 20)
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, []*providers.Field{
+		{Name: "Breached limit", Value: "Minimal ratio of 0.3"},
+		{Name: "Suppressed flips", Value: "1"},
+	}, sentEvents[0].Fields)
+	assert.True(t, strings.HasSuffix(sentMessages[0], "\n  Breached limit: Minimal ratio of 0.3\n  Suppressed flips: 1"))
+
+	assert.True(t, sm.imbalancedChannels[1])
+	assert.Equal(t, 0, sm.notifiedStates[1].SuppressedFlips)
+	assert.True(t, sm.notifiedStates[1].PendingSince.IsZero())
+
+	cleanUp()
+}
+
+func TestCheckChannelCooldown(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	sm := newTestManager(&ChannelManager{Cooldown: 600, logInsignificant: true}, nil).sm
+
+	checkBalance(sm, 20)
+	assert.Len(t, sentEvents, 1)
+
+	// Flips during the cooldown are not notified
+	for i := 0; i < 3; i++ {
+		sm.clock.MockTime = sm.clock.MockTime.Add(time.Minute)
+		checkBalance(sm, 50)
+		checkBalance(sm, 20)
+	}
+
+	assert.Len(t, sentEvents, 1)
+	assert.True(t, sm.imbalancedChannels[1])
+
+	sm.clock.MockTime = sm.clock.MockTime.Add(10 * time.Minute)
+	checkBalance(sm, 50)
+
+	assert.Len(t, sentEvents, 2)
+	assert.Equal(t, providers.EventBalanced, sentEvents[1].Type)
+	assert.Equal(t, []*providers.Field{{Name: "Suppressed flips", Value: "3"}}, sentEvents[1].Fields)
+
+	cleanUp()
+}
+
+func TestParseSignificantChannelHysteresis(t *testing.T) {
+	channelManager := &ChannelManager{
+		Hysteresis: 0.02,
+		MinDwell:   30,
+	}
+
+	significantChannels := []*SignificantChannel{
+		{
+			ChannelID: 1,
+			MinRatio:  "0.1",
+			MaxRatio:  "0.9",
+		},
+		{
+			ChannelID:  2,
+			MinRatio:   "0.1",
+			MaxRatio:   "0.9",
+			Hysteresis: "0.05",
+			MinDwell:   120,
+		},
+	}
+
+	sm := newTestManager(channelManager, significantChannels).sm
+
+	assert.Equal(t, 0.02, sm.significantChannel(&lnrpc.Channel{ChanId: 1}).ratios.hysteresis)
+	assert.Equal(t, 30*time.Second, sm.significantChannel(&lnrpc.Channel{ChanId: 1}).ratios.minDwell)
+
+	assert.Equal(t, 0.05, sm.significantChannel(&lnrpc.Channel{ChanId: 2}).ratios.hysteresis)
+	assert.Equal(t, 2*time.Minute, sm.significantChannel(&lnrpc.Channel{ChanId: 2}).ratios.minDwell)
+}
@@ -1,25 +1,281 @@
 package notifications
 
 import (
+	"context"
 	"github.com/BoltzExchange/channel-bot/lnd"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
 	"github.com/google/logger"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func (manager *ChannelManager) logClosedChannel(channel *lnrpc.ChannelCloseSummary) {
+// blockInterval is the average time between two blocks, which is used to estimate the age of channels
+const blockInterval = 10 * time.Minute
+
+// fundingTimeMargin is subtracted from the estimated funding time of channels to not miss any of their forwards
+const fundingTimeMargin = 24 * time.Hour
+
+// maxForwardingPages bounds how much of the forwarding history is queried for a closed channel, because closes
+// are handled in the event loop
+var maxForwardingPages = 10
+
+// forwardingStats are the totals of the forwards through a channel over its lifetime
+type forwardingStats struct {
+	count      int
+	volumeMsat uint64
+
+	// Fees are earned by the outgoing channel of a forward
+	feesMsat uint64
+
+	// Whether there were more forwards than could be queried
+	incomplete bool
+}
+
+func (manager *ChannelManager) logClosedChannel(ctx context.Context, channel *lnrpc.ChannelCloseSummary, catchUp bool) {
+	if !manager.logInsignificant {
+		return
+	}
+
+	event := &providers.Event{
+		Type:     providers.EventClosed,
+		Severity: providers.SeverityInfo,
+		CatchUp:  catchUp,
+	}
+
+	action := "closed"
+
+	switch channel.CloseType {
+	case lnrpc.ChannelCloseSummary_LOCAL_FORCE_CLOSE,
+		lnrpc.ChannelCloseSummary_REMOTE_FORCE_CLOSE,
+		lnrpc.ChannelCloseSummary_BREACH_CLOSE:
+		event.Type = providers.EventForceClosed
+		event.Severity = providers.SeverityCritical
+		action = "force closed"
+
+	// Neither of them is a force close, but funds could be lost when the channel was forgotten by mistake
+	case lnrpc.ChannelCloseSummary_ABANDONED:
+		event.Severity = providers.SeverityWarning
+		action = "abandoned"
+
+	case lnrpc.ChannelCloseSummary_FUNDING_CANCELED:
+		event.Severity = providers.SeverityWarning
+		action = "canceled before its funding confirmed"
+	}
+
+	nodeName := manager.nc.getNodeName(ctx, channel.RemotePubkey)
+
+	event.Title = "Channel to " + nodeName + " was " + action
+
+	if catchUp {
+		event.Title += " while the bot was offline"
+	}
+	event.Channel = &providers.Channel{
+		ID: channel.ChanId,
+	}
+	event.Peer = &providers.Peer{
+		Pubkey: channel.RemotePubkey,
+		Alias:  nodeName,
+	}
+	event.Fields = manager.closeFields(ctx, channel)
+
+	_ = manager.notificationProvider.SendEvent(event)
+}
+
+// closeFields returns how the channel was closed, how its balance was settled and what it earned over its lifetime
+func (manager *ChannelManager) closeFields(ctx context.Context, channel *lnrpc.ChannelCloseSummary) []*providers.Field {
+	fields := []*providers.Field{
+		{Name: "Close type", Value: formatEnum(channel.CloseType.String())},
+		{Name: "Close initiator", Value: formatInitiatorEnum(channel.CloseInitiator)},
+		{Name: "Open initiator", Value: formatInitiatorEnum(channel.OpenInitiator)},
+		{Name: "Closing transaction", Value: channel.ClosingTxHash},
+		{Name: "Capacity", Value: providers.FormatSats(channel.Capacity)},
+		{Name: "Settled balance", Value: providers.FormatSats(channel.SettledBalance)},
+	}
+
+	if channel.TimeLockedBalance != 0 {
+		fields = append(fields, &providers.Field{
+			Name:  "Time-locked balance",
+			Value: providers.FormatSats(channel.TimeLockedBalance),
+		})
+	}
+
+	if age := channelAge(channel); age != 0 {
+		fields = append(fields, &providers.Field{
+			Name:  "Channel age",
+			Value: strconv.Itoa(int(age)) + " blocks (~" + formatDuration(time.Duration(age)*blockInterval) + ")",
+		})
+	}
+
+	stats, err := manager.forwardingStats(
+		ctx,
+		manager.forwardingStartTime(ctx, channel),
+		channelIds(channel.ChanId, channel.ZeroConfConfirmedScid, channel.AliasScids),
+	)
+
+	if err != nil {
+		logger.Warning("Could not get forwarding history: " + err.Error())
+		return fields
+	}
+
+	prefix := ""
+	if stats.incomplete {
+		prefix = "at least "
+	}
+
+	return append(fields,
+		&providers.Field{Name: "Forwards", Value: prefix + strconv.Itoa(stats.count)},
+		&providers.Field{Name: "Forwarded volume", Value: prefix + providers.FormatSats(int64(stats.volumeMsat/1000))},
+		&providers.Field{Name: "Fees earned", Value: prefix + providers.FormatSats(int64(stats.feesMsat/1000))},
+	)
+}
+
+// channelAge returns the number of blocks between the confirmation of the funding and the closing transaction
+// or 0 if it cannot be determined
+func channelAge(channel *lnrpc.ChannelCloseSummary) uint32 {
+	fundingHeight := channelFundingHeight(channel)
+
+	if channel.CloseHeight == 0 || fundingHeight == 0 || fundingHeight > channel.CloseHeight {
+		return 0
+	}
+
+	return channel.CloseHeight - fundingHeight
+}
+
+func channelFundingHeight(channel *lnrpc.ChannelCloseSummary) uint32 {
+	scid := channel.ChanId
+
+	if channel.ZeroConfConfirmedScid != 0 {
+		scid = channel.ZeroConfConfirmedScid
+	}
+
+	return lnwire.NewShortChanIDFromInt(scid).BlockHeight
+}
+
+// forwardingStartTime estimates the funding time of the channel to only query the forwarding history of its lifetime.
+// Blocks are found slightly faster than every ten minutes on average, which makes the estimate rather too early than
+// too late. Returns 0 to query the whole history if the funding time cannot be estimated
+func (manager *ChannelManager) forwardingStartTime(ctx context.Context, channel *lnrpc.ChannelCloseSummary) uint64 {
+	fundingHeight := channelFundingHeight(channel)
+
+	if fundingHeight == 0 {
+		return 0
+	}
+
+	info, err := manager.lnd.GetInfo(ctx)
+
+	if err != nil {
+		logger.Warning("Could not get info of LND: " + err.Error())
+		return 0
+	}
+
+	if info.BestHeaderTimestamp == 0 || fundingHeight > info.BlockHeight {
+		return 0
+	}
+
+	age := time.Duration(info.BlockHeight-fundingHeight) * blockInterval
+	startTime := time.Unix(info.BestHeaderTimestamp, 0).Add(-age - fundingTimeMargin).Unix()
+
+	return uint64(max(startTime, 0))
+}
+
+// forwardingStats sums up the forwards through any of the IDs of a channel in the forwarding history since the start
+// time. At most maxForwardingPages pages are queried, after which the stats are marked as incomplete
+func (manager *ChannelManager) forwardingStats(ctx context.Context, startTime uint64, ids []uint64) (*forwardingStats, error) {
+	isChannel := map[uint64]bool{}
+
+	for _, id := range ids {
+		if id != 0 {
+			isChannel[id] = true
+		}
+	}
+
+	stats := &forwardingStats{}
+	indexOffset := uint32(0)
+
+	for page := 0; ; page++ {
+		if page == maxForwardingPages {
+			stats.incomplete = true
+			return stats, nil
+		}
+
+		history, err := manager.lnd.ForwardingHistory(ctx, startTime, indexOffset)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(history.ForwardingEvents) == 0 {
+			return stats, nil
+		}
+
+		for _, forward := range history.ForwardingEvents {
+			if isChannel[forward.ChanIdIn] {
+				stats.count++
+				stats.volumeMsat += forward.AmtInMsat
+			}
+
+			if isChannel[forward.ChanIdOut] {
+				stats.count++
+				stats.volumeMsat += forward.AmtOutMsat
+				stats.feesMsat += forward.FeeMsat
+			}
+		}
+
+		indexOffset = history.LastOffsetIndex
+	}
+}
+
+func formatInitiatorEnum(initiator lnrpc.Initiator) string {
+	return formatEnum(strings.TrimPrefix(initiator.String(), "INITIATOR_"))
+}
+
+// logFullyResolvedChannel notifies that all outputs of a closed channel were resolved on-chain.
+// The event only has the channel point, which is why the rest is looked up in the closed channels
+func (manager *ChannelManager) logFullyResolvedChannel(ctx context.Context, channelPoint *lnrpc.ChannelPoint) {
 	if !manager.logInsignificant {
 		return
 	}
 
-	closeType := "closed"
+	formattedPoint := lnd.FormatChannelPoint(channelPoint)
 
-	if channel.CloseType != lnrpc.ChannelCloseSummary_COOPERATIVE_CLOSE {
-		closeType = "**force closed** :rotating_light:"
+	event := &providers.Event{
+		Type:     providers.EventFullyResolved,
+		Severity: providers.SeverityInfo,
+		Title:    "Channel " + formattedPoint + " was fully resolved",
+		Fields: []*providers.Field{
+			{Name: channelPointField, Value: formattedPoint},
+		},
 	}
 
-	message := "Channel `" + lnd.FormatChannelID(channel.ChanId) + "` to `" +
-		manager.nc.getNodeName(channel.RemotePubkey) + "` was " + closeType
+	closedChannels, err := manager.lnd.ClosedChannels(ctx)
+
+	if err != nil {
+		logger.Warning("Could not get closed channels: " + err.Error())
+	} else {
+		for _, channel := range closedChannels.Channels {
+			if channel.ChannelPoint != formattedPoint {
+				continue
+			}
+
+			nodeName := manager.nc.getNodeName(ctx, channel.RemotePubkey)
+
+			event.Title = "Channel to " + nodeName + " was fully resolved"
+			event.Channel = &providers.Channel{
+				ID: channel.ChanId,
+			}
+			event.Peer = &providers.Peer{
+				Pubkey: channel.RemotePubkey,
+				Alias:  nodeName,
+			}
+			event.Fields = append(event.Fields, &providers.Field{
+				Name:  "Settled balance",
+				Value: providers.FormatSats(channel.SettledBalance),
+			})
+			break
+		}
+	}
 
-	logger.Info(message)
-	_ = manager.notificationProvider.SendMessage(message)
+	_ = manager.notificationProvider.SendEvent(event)
 }
@@ -1,27 +1,46 @@
 package notifications
 
 import (
-	"github.com/BoltzExchange/channel-bot/utils"
+	"context"
+	"github.com/BoltzExchange/channel-bot/lnd"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
 	"github.com/google/logger"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnwire"
 	"github.com/stretchr/testify/assert"
 	"strings"
 	"testing"
+	"time"
 )
 
+func closedChannelFields(closeType string) string {
+	return "  Close type: " + closeType + "\n" +
+		"  Close initiator: local\n" +
+		"  Open initiator: remote\n" +
+		"  Closing transaction: closing\n" +
+		"  Capacity: 1,000,000 sats\n" +
+		"  Settled balance: 400,000 sats\n" +
+		"  Channel age: 1008 blocks (~7d 0h)\n" +
+		"  Forwards: 0\n" +
+		"  Forwarded volume: 0 sats\n" +
+		"  Fees earned: 0 sats"
+}
+
 func checkForceCloseMessage(
 	t *testing.T,
 	cm *ChannelManager,
-	message string,
 	closedChannel *lnrpc.ChannelCloseSummary,
 	closeType lnrpc.ChannelCloseSummary_ClosureType,
 ) {
 	cleanUp()
 	closedChannel.CloseType = closeType
 
-	cm.logClosedChannel(closedChannel)
+	cm.logClosedChannel(context.Background(), closedChannel, false)
 
-	assert.Equal(t, sentMessages[0], message)
+	message := "Channel `" + lnd.FormatChannelID(closedChannel.ChanId) + "` to `pubkey` was **force closed** :rotating_light: :\n" +
+		closedChannelFields(formatEnum(closeType.String()))
+
+	assert.Equal(t, message, sentMessages[0])
 	assert.True(t, strings.HasSuffix(loggedMessages[0], message+"\n"))
 }
 
@@ -29,38 +48,193 @@ func TestLogClosedChannel(t *testing.T) {
 	mockWriter := &MockWriter{}
 	logger.Init("", false, false, mockWriter)
 
-	channelManager := &ChannelManager{
-		logInsignificant:     true,
-		lnd:                  &MockLndClient{},
-		notificationProvider: &MockDiscordClient{},
-		nc:                   initNodeCache(&MockLndClient{}, &utils.Clock{}),
-	}
-	channelManager.sm = initStateManager(channelManager, nil)
+	channelManager := newTestManager(&ChannelManager{logInsignificant: true}, nil)
 
 	cleanUp()
 
 	// Cooperatively closed channel
 	closedChannel := &lnrpc.ChannelCloseSummary{
-		ChanId:       321,
-		RemotePubkey: "pubkey",
-		CloseType:    lnrpc.ChannelCloseSummary_COOPERATIVE_CLOSE,
+		ChanId:         lnwire.ShortChannelID{BlockHeight: 800000, TxIndex: 1}.ToUint64(),
+		RemotePubkey:   "pubkey",
+		CloseType:      lnrpc.ChannelCloseSummary_COOPERATIVE_CLOSE,
+		CloseInitiator: lnrpc.Initiator_INITIATOR_LOCAL,
+		OpenInitiator:  lnrpc.Initiator_INITIATOR_REMOTE,
+		ClosingTxHash:  "closing",
+		Capacity:       1000000,
+		SettledBalance: 400000,
+		CloseHeight:    801008,
 	}
 
-	message := "Channel `321` to `pubkey` was closed"
+	message := "Channel `" + lnd.FormatChannelID(closedChannel.ChanId) + "` to `pubkey` was closed:\n" +
+		closedChannelFields("cooperative close")
 
-	channelManager.logClosedChannel(closedChannel)
+	channelManager.logClosedChannel(context.Background(), closedChannel, false)
 
-	assert.Equal(t, sentMessages[0], message)
+	assert.Equal(t, message, sentMessages[0])
 	assert.True(t, strings.HasSuffix(loggedMessages[0], message+"\n"))
 
 	// Force closed channels
-	message = strings.ReplaceAll(message, "closed", "**force closed** :rotating_light:")
+	checkForceCloseMessage(t, channelManager, closedChannel, lnrpc.ChannelCloseSummary_LOCAL_FORCE_CLOSE)
+	checkForceCloseMessage(t, channelManager, closedChannel, lnrpc.ChannelCloseSummary_REMOTE_FORCE_CLOSE)
+	checkForceCloseMessage(t, channelManager, closedChannel, lnrpc.ChannelCloseSummary_BREACH_CLOSE)
+
+	// Abandoned channels and canceled fundings are no force closes
+	cleanUp()
+	closedChannel.CloseType = lnrpc.ChannelCloseSummary_ABANDONED
+	channelManager.logClosedChannel(context.Background(), closedChannel, false)
 
-	checkForceCloseMessage(t, channelManager, message, closedChannel, lnrpc.ChannelCloseSummary_LOCAL_FORCE_CLOSE)
-	checkForceCloseMessage(t, channelManager, message, closedChannel, lnrpc.ChannelCloseSummary_REMOTE_FORCE_CLOSE)
-	checkForceCloseMessage(t, channelManager, message, closedChannel, lnrpc.ChannelCloseSummary_BREACH_CLOSE)
-	checkForceCloseMessage(t, channelManager, message, closedChannel, lnrpc.ChannelCloseSummary_FUNDING_CANCELED)
-	checkForceCloseMessage(t, channelManager, message, closedChannel, lnrpc.ChannelCloseSummary_ABANDONED)
+	assert.Equal(t, providers.EventClosed, sentEvents[0].Type)
+	assert.Equal(t, providers.SeverityWarning, sentEvents[0].Severity)
+	assert.Equal(t, "Channel to pubkey was abandoned", sentEvents[0].Title)
+	assert.Equal(t, ":warning: Channel `"+lnd.FormatChannelID(closedChannel.ChanId)+"` to `pubkey` was **abandoned**:\n"+
+		closedChannelFields("abandoned"), sentMessages[0])
 
 	cleanUp()
+	closedChannel.CloseType = lnrpc.ChannelCloseSummary_FUNDING_CANCELED
+	channelManager.logClosedChannel(context.Background(), closedChannel, false)
+
+	assert.Equal(t, providers.EventClosed, sentEvents[0].Type)
+	assert.Equal(t, providers.SeverityWarning, sentEvents[0].Severity)
+	assert.Equal(t, "Channel to pubkey was canceled before its funding confirmed", sentEvents[0].Title)
+	assert.Equal(t, ":warning: Channel `"+lnd.FormatChannelID(closedChannel.ChanId)+"` to `pubkey` was **canceled** "+
+		"before its funding confirmed:\n"+closedChannelFields("funding canceled"), sentMessages[0])
+
+	cleanUp()
+}
+
+func TestCloseFields(t *testing.T) {
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	channelManager := &ChannelManager{
+		lnd: &MockLndClient{},
+	}
+
+	confirmedScid := lnwire.ShortChannelID{BlockHeight: 800000, TxIndex: 1}.ToUint64()
+
+	// Forwards through the confirmed and the alias SCIDs of the channel are counted
+	forwardingEvents = []*lnrpc.ForwardingEvent{
+		{ChanIdIn: 1, ChanIdOut: 2, AmtInMsat: 101000, AmtOutMsat: 100000, FeeMsat: 1000},
+		{ChanIdIn: 2, ChanIdOut: confirmedScid, AmtInMsat: 202000, AmtOutMsat: 200000, FeeMsat: 2000},
+		{ChanIdIn: 16000000, ChanIdOut: 3, AmtInMsat: 303000, AmtOutMsat: 300000, FeeMsat: 3000},
+		{ChanIdIn: 3, ChanIdOut: 16000000, AmtInMsat: 1004000, AmtOutMsat: 1000000, FeeMsat: 4000},
+		{ChanIdIn: 3, ChanIdOut: 4, AmtInMsat: 5000000, AmtOutMsat: 4990000, FeeMsat: 10000},
+	}
+
+	fields := channelManager.closeFields(context.Background(), &lnrpc.ChannelCloseSummary{
+		ChanId:                1,
+		ZeroConfConfirmedScid: confirmedScid,
+		AliasScids:            []uint64{16000000},
+		CloseType:             lnrpc.ChannelCloseSummary_LOCAL_FORCE_CLOSE,
+		SettledBalance:        100000,
+		TimeLockedBalance:     50000,
+		CloseHeight:           800144,
+	})
+
+	assert.Equal(t, []*providers.Field{
+		{Name: "Close type", Value: "local force close"},
+		{Name: "Close initiator", Value: "unknown"},
+		{Name: "Open initiator", Value: "unknown"},
+		{Name: "Closing transaction", Value: ""},
+		{Name: "Capacity", Value: "0 sats"},
+		{Name: "Settled balance", Value: "100,000 sats"},
+		{Name: "Time-locked balance", Value: "50,000 sats"},
+		{Name: "Channel age", Value: "144 blocks (~1d 0h)"},
+		{Name: "Forwards", Value: "4"},
+		{Name: "Forwarded volume", Value: "1,604 sats"},
+		{Name: "Fees earned", Value: "6 sats"},
+	}, fields)
+
+	forwardingEvents = nil
+}
+
+func TestForwardingStatsBounded(t *testing.T) {
+	channelManager := &ChannelManager{
+		lnd: &MockLndClient{},
+	}
+
+	previousMaxPages := maxForwardingPages
+	maxForwardingPages = 2
+
+	t.Cleanup(func() {
+		maxForwardingPages = previousMaxPages
+		forwardingEvents = nil
+	})
+
+	// The mock returns pages of two events, so the fifth event is not queried anymore
+	for i := 0; i < 5; i++ {
+		forwardingEvents = append(forwardingEvents, &lnrpc.ForwardingEvent{ChanIdIn: 1, ChanIdOut: 2, AmtInMsat: 1000})
+	}
+
+	stats, err := channelManager.forwardingStats(context.Background(), 0, []uint64{1})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, stats.count)
+	assert.True(t, stats.incomplete)
+
+	fields := channelManager.closeFields(context.Background(), &lnrpc.ChannelCloseSummary{ChanId: 1})
+	assert.Equal(t, "at least 4", fields[len(fields)-3].Value)
+
+	// Histories whose end is reached within the pages are complete
+	forwardingEvents = forwardingEvents[:2]
+
+	stats, err = channelManager.forwardingStats(context.Background(), 0, []uint64{1})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stats.count)
+	assert.False(t, stats.incomplete)
+}
+
+func TestChannelAge(t *testing.T) {
+	scid := lnwire.ShortChannelID{BlockHeight: 800000}.ToUint64()
+
+	assert.Equal(t, uint32(10), channelAge(&lnrpc.ChannelCloseSummary{ChanId: scid, CloseHeight: 800010}))
+
+	// The age is unknown without close height or with an alias as channel ID
+	assert.Equal(t, uint32(0), channelAge(&lnrpc.ChannelCloseSummary{ChanId: scid}))
+	assert.Equal(t, uint32(0), channelAge(&lnrpc.ChannelCloseSummary{ChanId: 16000000, CloseHeight: 800010}))
+}
+
+func TestForwardingStartTime(t *testing.T) {
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	channelManager := &ChannelManager{
+		lnd: &MockLndClient{},
+	}
+
+	ctx := context.Background()
+	bestHeaderTimestamp = 1700000000
+
+	// The channel was funded 34 blocks ago
+	channel := &lnrpc.ChannelCloseSummary{
+		ChanId: lnwire.ShortChannelID{BlockHeight: blockHeight - 34}.ToUint64(),
+	}
+
+	startTime := uint64(bestHeaderTimestamp - int64((34*blockInterval+fundingTimeMargin)/time.Second))
+	assert.Equal(t, startTime, channelManager.forwardingStartTime(ctx, channel))
+
+	// Forwards before the estimated funding time are not queried
+	forwardingEvents = []*lnrpc.ForwardingEvent{
+		{Timestamp: startTime - 1, ChanIdIn: channel.ChanId, AmtInMsat: 1000000},
+		{Timestamp: startTime, ChanIdIn: channel.ChanId, AmtInMsat: 2000000},
+	}
+	forwardingStartTimes = nil
+
+	fields := channelManager.closeFields(ctx, channel)
+
+	assert.Equal(t, startTime, forwardingStartTimes[0])
+	assert.Equal(t, &providers.Field{Name: "Forwarded volume", Value: "2,000 sats"}, fields[len(fields)-2])
+
+	// The whole history is queried when the funding time cannot be estimated
+	assert.Equal(t, uint64(0), channelManager.forwardingStartTime(ctx, &lnrpc.ChannelCloseSummary{ChanId: 16000000}))
+	assert.Equal(t, uint64(0), channelManager.forwardingStartTime(ctx, &lnrpc.ChannelCloseSummary{
+		ChanId: lnwire.ShortChannelID{BlockHeight: blockHeight + 1}.ToUint64(),
+	}))
+
+	bestHeaderTimestamp = 0
+	assert.Equal(t, uint64(0), channelManager.forwardingStartTime(ctx, channel))
+
+	forwardingEvents = nil
+	forwardingStartTimes = nil
 }
@@ -0,0 +1,327 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/lnd"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	milestoneCloseConfirmed = "close confirmed"
+	milestoneHtlcsResolved  = "HTLCs resolved"
+	milestoneCsvMatured     = "CSV matured"
+	milestoneFundsSwept     = "funds swept"
+)
+
+const lockedBalanceField = "Locked balance"
+
+// How long swept channels are remembered to ignore their fully resolved event
+const sweptRetention = 24 * time.Hour
+
+// pendingClose is a channel whose closing transaction was broadcast, but whose funds were not swept yet
+type pendingClose struct {
+	chanId      uint64
+	pubkey      string
+	closingTxid string
+
+	// Whether the closing transaction of the force close confirmed
+	confirmed bool
+
+	limboBalance      int64
+	recoveredBalance  int64
+	blocksTilMaturity int32
+	pendingHtlcs      int
+}
+
+// closeTracker follows closing channels until all their funds are swept to notify about the milestones of force
+// closes and sends summaries of the funds that are still locked in closing channels
+type closeTracker struct {
+	manager *ChannelManager
+
+	summaryInterval time.Duration
+	lastSummary     time.Time
+
+	// Closing channels keyed by their channel point
+	pending map[string]*pendingClose
+
+	// Times at which channels were notified about as swept keyed by their channel point
+	swept map[string]time.Time
+}
+
+func initCloseTracker(manager *ChannelManager, summaryInterval int) *closeTracker {
+	return &closeTracker{
+		manager:         manager,
+		summaryInterval: time.Duration(summaryInterval) * time.Hour,
+		lastSummary:     manager.sm.clock.Now(),
+		pending:         map[string]*pendingClose{},
+		swept:           map[string]time.Time{},
+	}
+}
+
+// sync starts tracking the channels that are already closing without notifying about the milestones they reached
+func (ct *closeTracker) sync(ctx context.Context, pendingChannels *lnrpc.PendingChannelsResponse) {
+	ct.update(ctx, pendingChannels, false)
+}
+
+// update compares the closing channels of LND with the tracked ones and notifies about the milestones that were reached
+func (ct *closeTracker) update(ctx context.Context, pendingChannels *lnrpc.PendingChannelsResponse, notify bool) {
+	stillPending := map[string]bool{}
+
+	for _, waiting := range pendingChannels.WaitingCloseChannels {
+		channelPoint := waiting.Channel.ChannelPoint
+		stillPending[channelPoint] = true
+
+		tracked := ct.track(channelPoint, waiting.Channel.RemoteNodePub)
+		tracked.closingTxid = waiting.ClosingTxid
+		tracked.limboBalance = waiting.LimboBalance
+	}
+
+	for _, forceClosed := range pendingChannels.PendingForceClosingChannels {
+		channelPoint := forceClosed.Channel.ChannelPoint
+		stillPending[channelPoint] = true
+
+		tracked := ct.track(channelPoint, forceClosed.Channel.RemoteNodePub)
+
+		for _, milestone := range tracked.update(forceClosed) {
+			if notify {
+				ct.logMilestone(ctx, channelPoint, tracked, milestone)
+			}
+		}
+	}
+
+	for channelPoint, tracked := range ct.pending {
+		if stillPending[channelPoint] {
+			continue
+		}
+
+		// Cooperative closes are done once their closing transaction confirmed, which is notified separately
+		if tracked.confirmed && notify {
+			ct.logMilestone(ctx, channelPoint, tracked, milestoneFundsSwept)
+			ct.swept[channelPoint] = ct.manager.sm.clock.Now()
+		}
+
+		delete(ct.pending, channelPoint)
+	}
+
+	ct.pruneSwept()
+	ct.checkSummary(ctx)
+}
+
+func (ct *closeTracker) handleClose(closed *lnrpc.ChannelCloseSummary) {
+	if tracked := ct.pending[closed.ChannelPoint]; tracked != nil {
+		tracked.chanId = closed.ChanId
+	}
+}
+
+// handleFullyResolved returns whether the resolved channel was a tracked force close, which is notified about
+// as funds swept milestone instead, or was already notified about as swept by the poll of the closing channels
+func (ct *closeTracker) handleFullyResolved(ctx context.Context, channelPoint *lnrpc.ChannelPoint) bool {
+	formattedPoint := lnd.FormatChannelPoint(channelPoint)
+
+	if _, swept := ct.swept[formattedPoint]; swept {
+		delete(ct.swept, formattedPoint)
+		return true
+	}
+
+	tracked := ct.pending[formattedPoint]
+	if tracked == nil {
+		return false
+	}
+
+	delete(ct.pending, formattedPoint)
+
+	if !tracked.confirmed {
+		return false
+	}
+
+	ct.logMilestone(ctx, formattedPoint, tracked, milestoneFundsSwept)
+	return true
+}
+
+func (ct *closeTracker) track(channelPoint string, pubkey string) *pendingClose {
+	if tracked := ct.pending[channelPoint]; tracked != nil {
+		return tracked
+	}
+
+	tracked := &pendingClose{
+		pubkey: pubkey,
+	}
+
+	if channel := ct.manager.sm.channelByPoint(channelPoint); channel != nil {
+		tracked.chanId = channel.ChanId
+	} else if known := ct.manager.store.loadKnownChannel(channelPoint); known != nil {
+		tracked.chanId = known.ChanId
+	}
+
+	ct.pending[channelPoint] = tracked
+	return tracked
+}
+
+func (ct *closeTracker) pruneSwept() {
+	now := ct.manager.sm.clock.Now()
+
+	for channelPoint, sweptAt := range ct.swept {
+		if now.Sub(sweptAt) > sweptRetention {
+			delete(ct.swept, channelPoint)
+		}
+	}
+}
+
+// update applies the state of the force closed channel and returns the milestones that were reached since the last update
+func (pc *pendingClose) update(forceClosed *lnrpc.PendingChannelsResponse_ForceClosedChannel) []string {
+	var milestones []string
+
+	if !pc.confirmed {
+		milestones = append(milestones, milestoneCloseConfirmed)
+	} else {
+		if pc.pendingHtlcs != 0 && len(forceClosed.PendingHtlcs) == 0 {
+			milestones = append(milestones, milestoneHtlcsResolved)
+		}
+
+		if pc.blocksTilMaturity > 0 && forceClosed.BlocksTilMaturity <= 0 {
+			milestones = append(milestones, milestoneCsvMatured)
+		}
+	}
+
+	pc.confirmed = true
+	pc.closingTxid = forceClosed.ClosingTxid
+	pc.limboBalance = forceClosed.LimboBalance
+	pc.recoveredBalance = forceClosed.RecoveredBalance
+	pc.blocksTilMaturity = forceClosed.BlocksTilMaturity
+	pc.pendingHtlcs = len(forceClosed.PendingHtlcs)
+
+	return milestones
+}
+
+func (ct *closeTracker) checkSummary(ctx context.Context) {
+	now := ct.manager.sm.clock.Now()
+
+	if ct.summaryInterval == 0 || now.Sub(ct.lastSummary) < ct.summaryInterval {
+		return
+	}
+
+	ct.lastSummary = now
+	ct.logLockedFunds(ctx)
+}
+
+func (ct *closeTracker) logMilestone(ctx context.Context, channelPoint string, tracked *pendingClose, milestone string) {
+	if !ct.manager.logInsignificant {
+		return
+	}
+
+	nodeName := ct.manager.nc.getNodeName(ctx, tracked.pubkey)
+
+	event := &providers.Event{
+		Type:     providers.EventCloseMilestone,
+		Severity: providers.SeverityInfo,
+		Title:    "Force close of channel to " + nodeName + ": " + milestone,
+		Peer: &providers.Peer{
+			Pubkey: tracked.pubkey,
+			Alias:  nodeName,
+		},
+		Fields: []*providers.Field{
+			{Name: "Milestone", Value: milestone},
+			{Name: channelPointField, Value: channelPoint},
+			{Name: "Closing transaction", Value: tracked.closingTxid},
+		},
+	}
+
+	if tracked.chanId != 0 {
+		event.Channel = &providers.Channel{
+			ID: tracked.chanId,
+		}
+	}
+
+	if milestone == milestoneFundsSwept {
+		event.Fields = append(event.Fields, &providers.Field{
+			Name:  "Recovered balance",
+			Value: providers.FormatSats(tracked.recoveredBalance + tracked.limboBalance),
+		})
+	} else {
+		event.Fields = append(event.Fields, tracked.lockedFields()...)
+	}
+
+	_ = ct.manager.notificationProvider.SendEvent(event)
+}
+
+func (pc *pendingClose) lockedFields() []*providers.Field {
+	var fields []*providers.Field
+
+	if pc.limboBalance != 0 {
+		fields = append(fields, &providers.Field{Name: lockedBalanceField, Value: providers.FormatSats(pc.limboBalance)})
+	}
+
+	if pc.blocksTilMaturity > 0 {
+		fields = append(fields, &providers.Field{Name: "Blocks until maturity", Value: strconv.Itoa(int(pc.blocksTilMaturity))})
+	}
+
+	if pc.pendingHtlcs != 0 {
+		fields = append(fields, &providers.Field{Name: "Pending HTLCs", Value: strconv.Itoa(pc.pendingHtlcs)})
+	}
+
+	return fields
+}
+
+// logLockedFunds sends a summary of the funds that are locked in closing channels, if there are any
+func (ct *closeTracker) logLockedFunds(ctx context.Context) {
+	if !ct.manager.logInsignificant {
+		return
+	}
+
+	channelPoints := make([]string, 0, len(ct.pending))
+	total := int64(0)
+
+	for channelPoint, tracked := range ct.pending {
+		if tracked.limboBalance == 0 {
+			continue
+		}
+
+		channelPoints = append(channelPoints, channelPoint)
+		total += tracked.limboBalance
+	}
+
+	if total == 0 {
+		return
+	}
+
+	sort.Strings(channelPoints)
+
+	event := &providers.Event{
+		Type:     providers.EventLockedFunds,
+		Severity: providers.SeverityInfo,
+		Title:    providers.FormatSats(total) + " are locked in closing channels",
+		Fields: []*providers.Field{
+			{Name: lockedBalanceField, Value: providers.FormatSats(total)},
+		},
+	}
+
+	for _, channelPoint := range channelPoints {
+		tracked := ct.pending[channelPoint]
+
+		name := "Channel " + channelPoint
+		if tracked.chanId != 0 {
+			name = "Channel " + lnd.FormatChannelID(tracked.chanId)
+		}
+
+		value := providers.FormatSats(tracked.limboBalance) + " to " + ct.manager.nc.getNodeName(ctx, tracked.pubkey)
+
+		switch {
+		case !tracked.confirmed:
+			value += ", closing transaction unconfirmed"
+
+		case tracked.blocksTilMaturity > 0:
+			value += ", matures in " + strconv.Itoa(int(tracked.blocksTilMaturity)) + " blocks"
+
+		case tracked.pendingHtlcs != 0:
+			value += ", " + strconv.Itoa(tracked.pendingHtlcs) + " pending HTLCs"
+		}
+
+		event.Fields = append(event.Fields, &providers.Field{Name: name, Value: value})
+	}
+
+	_ = ct.manager.notificationProvider.SendEvent(event)
+}
@@ -0,0 +1,251 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func closingPendingChannel() *lnrpc.PendingChannelsResponse_PendingChannel {
+	return &lnrpc.PendingChannelsResponse_PendingChannel{
+		RemoteNodePub: "pubkey",
+		ChannelPoint:  activityChannelPoint,
+	}
+}
+
+func forceClosedChannel(limboBalance int64, blocksTilMaturity int32, htlcs int) *lnrpc.PendingChannelsResponse_ForceClosedChannel {
+	forceClosed := &lnrpc.PendingChannelsResponse_ForceClosedChannel{
+		Channel:           closingPendingChannel(),
+		ClosingTxid:       "closing",
+		LimboBalance:      limboBalance,
+		BlocksTilMaturity: blocksTilMaturity,
+	}
+
+	for i := 0; i < htlcs; i++ {
+		forceClosed.PendingHtlcs = append(forceClosed.PendingHtlcs, &lnrpc.PendingHTLC{Amount: 1000})
+	}
+
+	return forceClosed
+}
+
+func cleanUpClosingChannels() {
+	waitingCloseChannels = nil
+	forceClosingChannels = nil
+	cleanUp()
+}
+
+func TestForceCloseMilestones(t *testing.T) {
+	cleanUpClosingChannels()
+
+	manager := newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil, activityChannel())
+	ctx := context.Background()
+
+	waitingCloseChannels = []*lnrpc.PendingChannelsResponse_WaitingCloseChannel{
+		{Channel: closingPendingChannel(), ClosingTxid: "closing", LimboBalance: 100000},
+	}
+
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 0)
+	assert.Equal(t, uint64(1), manager.closes.pending[activityChannelPoint].chanId)
+
+	waitingCloseChannels = nil
+	forceClosingChannels = []*lnrpc.PendingChannelsResponse_ForceClosedChannel{forceClosedChannel(100000, 144, 1)}
+
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, providers.EventCloseMilestone, sentEvents[0].Type)
+	assert.Equal(t, "Force close of channel to node: close confirmed", sentEvents[0].Title)
+	assert.Equal(t, "Force close of channel `1` to `node`: **close confirmed**:\n"+
+		"  Closing transaction: `closing`\n"+
+		"  Locked balance: 100,000 sats\n"+
+		"  Blocks until maturity: 144\n"+
+		"  Pending HTLCs: 1", sentMessages[0])
+
+	// Nothing changed
+	manager.pollPendingChannels(ctx)
+	assert.Len(t, sentEvents, 1)
+
+	forceClosingChannels = []*lnrpc.PendingChannelsResponse_ForceClosedChannel{forceClosedChannel(99000, 0, 0)}
+
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 3)
+	assert.Equal(t, "Force close of channel to node: HTLCs resolved", sentEvents[1].Title)
+	assert.Equal(t, "Force close of channel to node: CSV matured", sentEvents[2].Title)
+
+	forceClosed := forceClosedChannel(0, 0, 0)
+	forceClosed.RecoveredBalance = 98000
+	forceClosingChannels = []*lnrpc.PendingChannelsResponse_ForceClosedChannel{forceClosed}
+
+	manager.pollPendingChannels(ctx)
+	assert.Len(t, sentEvents, 3)
+
+	forceClosingChannels = nil
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 4)
+	assert.Equal(t, "Force close of channel `1` to `node`: **funds swept**:\n"+
+		"  Closing transaction: `closing`\n"+
+		"  Recovered balance: 98,000 sats", sentMessages[3])
+	assert.Empty(t, manager.closes.pending)
+
+	cleanUpClosingChannels()
+}
+
+func TestCooperativeCloseNoMilestones(t *testing.T) {
+	cleanUpClosingChannels()
+
+	manager := newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil, activityChannel())
+	ctx := context.Background()
+
+	waitingCloseChannels = []*lnrpc.PendingChannelsResponse_WaitingCloseChannel{
+		{Channel: closingPendingChannel(), ClosingTxid: "closing", LimboBalance: 100000},
+	}
+	manager.pollPendingChannels(ctx)
+
+	waitingCloseChannels = nil
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 0)
+	assert.Empty(t, manager.closes.pending)
+
+	cleanUpClosingChannels()
+}
+
+func TestSyncClosingChannels(t *testing.T) {
+	cleanUpClosingChannels()
+
+	manager := newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil, activityChannel())
+	ctx := context.Background()
+
+	// Milestones that were reached before the start are not notified
+	forceClosingChannels = []*lnrpc.PendingChannelsResponse_ForceClosedChannel{forceClosedChannel(100000, 10, 0)}
+	manager.syncPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 0)
+	assert.True(t, manager.closes.pending[activityChannelPoint].confirmed)
+
+	forceClosingChannels = []*lnrpc.PendingChannelsResponse_ForceClosedChannel{forceClosedChannel(100000, 0, 0)}
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, "Force close of channel to node: CSV matured", sentEvents[0].Title)
+
+	cleanUpClosingChannels()
+}
+
+func TestHandleFullyResolvedForceClose(t *testing.T) {
+	cleanUpClosingChannels()
+
+	manager := newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil, activityChannel())
+	ctx := context.Background()
+
+	forceClosingChannels = []*lnrpc.PendingChannelsResponse_ForceClosedChannel{forceClosedChannel(100000, 0, 0)}
+	manager.syncPendingChannels(ctx)
+
+	manager.closes.handleClose(&lnrpc.ChannelCloseSummary{ChanId: 2, ChannelPoint: activityChannelPoint})
+	assert.Equal(t, uint64(2), manager.closes.pending[activityChannelPoint].chanId)
+
+	assert.True(t, manager.closes.handleFullyResolved(ctx, activityChannelPointRpc()))
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, "funds swept", sentEvents[0].Fields[0].Value)
+
+	// Untracked channels are notified about as fully resolved
+	assert.False(t, manager.closes.handleFullyResolved(ctx, activityChannelPointRpc()))
+
+	cleanUpClosingChannels()
+}
+
+func TestFullyResolvedAfterSwept(t *testing.T) {
+	cleanUpClosingChannels()
+
+	manager := newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil, activityChannel())
+	ctx := context.Background()
+
+	forceClosingChannels = []*lnrpc.PendingChannelsResponse_ForceClosedChannel{forceClosedChannel(100000, 0, 0)}
+	manager.syncPendingChannels(ctx)
+
+	forceClosingChannels = nil
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, "funds swept", sentEvents[0].Fields[0].Value)
+
+	// The swept channel is not notified about again as fully resolved
+	assert.True(t, manager.closes.handleFullyResolved(ctx, activityChannelPointRpc()))
+	assert.Len(t, sentEvents, 1)
+	assert.Empty(t, manager.closes.swept)
+
+	cleanUpClosingChannels()
+}
+
+func TestPruneSwept(t *testing.T) {
+	manager := newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil, activityChannel())
+
+	now := manager.sm.clock.Now()
+
+	manager.closes.swept[activityChannelPoint] = now.Add(-sweptRetention - time.Minute)
+	manager.closes.swept["recent"] = now
+
+	manager.closes.pruneSwept()
+
+	assert.Equal(t, map[string]time.Time{"recent": now}, manager.closes.swept)
+}
+
+func TestLockedFundsSummary(t *testing.T) {
+	cleanUpClosingChannels()
+
+	manager := newTestManager(
+		&ChannelManager{LockedFundsInterval: 24, logInsignificant: true, lnd: nodeLnd},
+		nil,
+		activityChannel(),
+	)
+	ctx := context.Background()
+
+	waitingCloseChannels = []*lnrpc.PendingChannelsResponse_WaitingCloseChannel{
+		{
+			Channel: &lnrpc.PendingChannelsResponse_PendingChannel{
+				RemoteNodePub: "other",
+				ChannelPoint:  "txid:1",
+			},
+			LimboBalance: 50000,
+		},
+	}
+	forceClosingChannels = []*lnrpc.PendingChannelsResponse_ForceClosedChannel{forceClosedChannel(100000, 144, 0)}
+
+	manager.syncPendingChannels(ctx)
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 0)
+
+	manager.sm.clock.MockTime = manager.sm.clock.MockTime.Add(24 * time.Hour)
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, providers.EventLockedFunds, sentEvents[0].Type)
+	assert.Equal(t, "150,000 sats are locked in closing channels", sentEvents[0].Title)
+	assert.Equal(t, ":lock: **150,000 sats** are locked in closing channels:\n"+
+		"  Channel 1: 100,000 sats to node, matures in 144 blocks\n"+
+		"  Channel txid:1: 50,000 sats to node, closing transaction unconfirmed", sentMessages[0])
+
+	// The next summary is only sent after the interval
+	manager.pollPendingChannels(ctx)
+	assert.Len(t, sentEvents, 1)
+
+	// No summary is sent when no funds are locked
+	cleanUpClosingChannels()
+	manager.pollPendingChannels(ctx)
+	cleanUp()
+
+	manager.sm.clock.MockTime = manager.sm.clock.MockTime.Add(24 * time.Hour)
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 0)
+
+	cleanUpClosingChannels()
+}
@@ -0,0 +1,233 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Condition is a custom alert that is sent when its expression evaluates to true for a channel.
+// It is sent again only after the expression evaluated to false in the meantime
+type Condition struct {
+	Name       string
+	Expression string
+	Message    string
+	Severity   string
+
+	program  *vm.Program
+	severity providers.Severity
+}
+
+// conditionEnv is the snapshot of a channel the expressions of conditions are evaluated against
+type conditionEnv struct {
+	ChanId       uint64 `expr:"chan_id"`
+	ChannelPoint string `expr:"channel_point"`
+	RemotePubkey string `expr:"remote_pubkey"`
+	PeerAlias    string `expr:"peer_alias"`
+
+	Active    bool `expr:"active"`
+	Private   bool `expr:"private"`
+	Initiator bool `expr:"initiator"`
+
+	Capacity         int64   `expr:"capacity"`
+	LocalBalance     int64   `expr:"local_balance"`
+	RemoteBalance    int64   `expr:"remote_balance"`
+	Ratio            float64 `expr:"ratio"`
+	CommitFee        int64   `expr:"commit_fee"`
+	UnsettledBalance int64   `expr:"unsettled_balance"`
+
+	SpendableBalance  int64 `expr:"spendable_balance"`
+	ReceivableBalance int64 `expr:"receivable_balance"`
+
+	LocalChanReserveSat  int64 `expr:"local_chan_reserve_sat"`
+	RemoteChanReserveSat int64 `expr:"remote_chan_reserve_sat"`
+
+	TotalSatoshisSent     int64 `expr:"total_satoshis_sent"`
+	TotalSatoshisReceived int64 `expr:"total_satoshis_received"`
+
+	NumUpdates               uint64 `expr:"num_updates"`
+	NumUpdatesSinceLastAlert uint64 `expr:"num_updates_since_last_alert"`
+	NumPendingHtlcs          int    `expr:"num_pending_htlcs"`
+
+	Lifetime int64 `expr:"lifetime"`
+	Uptime   int64 `expr:"uptime"`
+
+	Imbalanced bool `expr:"imbalanced"`
+}
+
+// ParseConditions validates the conditions and compiles their expressions
+func (manager *ChannelManager) ParseConditions() error {
+	names := map[string]bool{}
+
+	for i, condition := range manager.Conditions {
+		if condition.Name == "" {
+			condition.Name = "#" + strconv.Itoa(i+1)
+		}
+
+		if names[condition.Name] {
+			return errors.New("duplicate condition name: " + condition.Name)
+		}
+
+		names[condition.Name] = true
+
+		if err := condition.parse(); err != nil {
+			return errors.New(fmt.Sprint("invalid condition ", condition.Name, ": ", err))
+		}
+	}
+
+	return nil
+}
+
+func (condition *Condition) parse() (err error) {
+	condition.program, err = expr.Compile(condition.Expression, expr.Env(conditionEnv{}), expr.AsBool())
+	if err != nil {
+		return err
+	}
+
+	switch severity := providers.Severity(strings.ToLower(condition.Severity)); severity {
+	case "":
+		condition.severity = providers.SeverityWarning
+
+	case providers.SeverityInfo, providers.SeverityWarning, providers.SeverityCritical:
+		condition.severity = severity
+
+	default:
+		return errors.New("unknown severity: " + condition.Severity)
+	}
+
+	return nil
+}
+
+// checkConditions evaluates all conditions for the channel and notifies the ones that started to be met
+func (sm *stateManager) checkConditions(ctx context.Context, channel *lnrpc.Channel) {
+	if len(sm.manager.Conditions) == 0 {
+		return
+	}
+
+	state := sm.notifiedStates[channel.ChanId]
+	if state == nil {
+		state = &channelState{}
+	}
+
+	env := sm.conditionEnv(ctx, channel, state)
+	changed := false
+
+	for _, condition := range sm.manager.Conditions {
+		result, err := expr.Run(condition.program, env)
+		if err != nil {
+			logger.Warning("Could not evaluate condition " + condition.Name + ": " + err.Error())
+			continue
+		}
+
+		isMet := result.(bool)
+		wasMet := slices.Contains(state.MetConditions, condition.Name)
+
+		if isMet == wasMet {
+			continue
+		}
+
+		changed = true
+
+		if !isMet {
+			state.MetConditions = slices.DeleteFunc(state.MetConditions, func(name string) bool {
+				return name == condition.Name
+			})
+			continue
+		}
+
+		state.MetConditions = append(state.MetConditions, condition.Name)
+		state.AlertedAtUpdate = channel.NumUpdates
+
+		sm.manager.logCondition(channel, condition, env.PeerAlias, sm.significantChannel(channel))
+	}
+
+	if changed {
+		sm.notifiedStates[channel.ChanId] = state
+		sm.manager.store.saveChannelState(channel.ChanId, state)
+	}
+}
+
+func (sm *stateManager) conditionEnv(ctx context.Context, channel *lnrpc.Channel, state *channelState) *conditionEnv {
+	return &conditionEnv{
+		ChanId:       channel.ChanId,
+		ChannelPoint: channel.ChannelPoint,
+		RemotePubkey: channel.RemotePubkey,
+		PeerAlias:    sm.manager.nc.getNodeName(ctx, channel.RemotePubkey),
+
+		Active:    channel.Active,
+		Private:   channel.Private,
+		Initiator: channel.Initiator,
+
+		Capacity:         channel.Capacity,
+		LocalBalance:     channel.LocalBalance,
+		RemoteBalance:    channel.RemoteBalance,
+		Ratio:            getChannelRatio(channel),
+		CommitFee:        channel.CommitFee,
+		UnsettledBalance: channel.UnsettledBalance,
+
+		SpendableBalance:  spendableBalance(channel),
+		ReceivableBalance: receivableBalance(channel),
+
+		LocalChanReserveSat:  channel.LocalChanReserveSat,
+		RemoteChanReserveSat: channel.RemoteChanReserveSat,
+
+		TotalSatoshisSent:     channel.TotalSatoshisSent,
+		TotalSatoshisReceived: channel.TotalSatoshisReceived,
+
+		NumUpdates:               channel.NumUpdates,
+		NumUpdatesSinceLastAlert: channel.NumUpdates - min(state.AlertedAtUpdate, channel.NumUpdates),
+		NumPendingHtlcs:          len(channel.PendingHtlcs),
+
+		Lifetime: channel.Lifetime,
+		Uptime:   channel.Uptime,
+
+		Imbalanced: sm.imbalancedChannels[channel.ChanId],
+	}
+}
+
+func (manager *ChannelManager) logCondition(
+	channel *lnrpc.Channel,
+	condition *Condition,
+	nodeName string,
+	significant *SignificantChannel,
+) {
+	title := "Condition " + condition.Name + " is met"
+
+	if condition.Message != "" {
+		title = condition.Message
+	}
+
+	event := &providers.Event{
+		Type:     providers.EventCondition,
+		Severity: condition.severity,
+		Title:    title + " for channel to " + nodeName,
+		Channel: &providers.Channel{
+			ID:      channel.ChanId,
+			Private: channel.Private,
+		},
+		Peer: &providers.Peer{
+			Pubkey: channel.RemotePubkey,
+			Alias:  nodeName,
+		},
+		Balances: channelBalances(channel),
+		Fields: []*providers.Field{
+			{Name: "Alert", Value: title},
+			{Name: "Condition", Value: condition.Name},
+			{Name: "Expression", Value: condition.Expression},
+		},
+	}
+
+	if significant != nil {
+		event.Channel.Alias = significant.Alias
+	}
+
+	_ = manager.notificationProvider.SendEvent(event)
+}
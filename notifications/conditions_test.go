@@ -0,0 +1,179 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParseConditions(t *testing.T) {
+	manager := &ChannelManager{
+		Conditions: []*Condition{
+			{
+				Expression: "local_balance < 500000 && capacity > 5000000",
+			},
+			{
+				Name:       "busy",
+				Expression: "num_updates_since_last_alert > 1000",
+				Severity:   "Info",
+			},
+		},
+	}
+
+	assert.Nil(t, manager.ParseConditions())
+
+	assert.Equal(t, "#1", manager.Conditions[0].Name)
+	assert.NotNil(t, manager.Conditions[0].program)
+	assert.Equal(t, providers.SeverityWarning, manager.Conditions[0].severity)
+	assert.Equal(t, providers.SeverityInfo, manager.Conditions[1].severity)
+}
+
+func TestParseConditionsInvalid(t *testing.T) {
+	invalid := []*Condition{
+		{Name: "unknown field", Expression: "unknown > 1"},
+		{Name: "not bool", Expression: "local_balance + 1"},
+		{Name: "severity", Expression: "private", Severity: "fatal"},
+	}
+
+	for _, condition := range invalid {
+		manager := &ChannelManager{
+			Conditions: []*Condition{condition},
+		}
+
+		err := manager.ParseConditions()
+
+		assert.NotNil(t, err)
+		assert.True(t, strings.HasPrefix(err.Error(), "invalid condition "+condition.Name+": "))
+	}
+
+	manager := &ChannelManager{
+		Conditions: []*Condition{
+			{Name: "same", Expression: "private"},
+			{Name: "same", Expression: "active"},
+		},
+	}
+
+	assert.EqualError(t, manager.ParseConditions(), "duplicate condition name: same")
+}
+
+func TestCheckConditions(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	manager := &ChannelManager{
+		lnd: &MockLndClient{nodeAlias: "node"},
+		Conditions: []*Condition{
+			{
+				Name:       "low",
+				Expression: "local_balance < 500000 && capacity > 5000000 && peer_alias == \"node\"",
+				Message:    "Local balance is low",
+				Severity:   "critical",
+			},
+			{
+				Name:       "busy",
+				Expression: "num_updates_since_last_alert > 1000",
+			},
+		},
+	}
+
+	assert.Nil(t, manager.ParseConditions())
+
+	newTestManager(manager, nil)
+
+	channel := &lnrpc.Channel{
+		ChanId:        1,
+		RemotePubkey:  "pubkey",
+		Private:       true,
+		Capacity:      10000000,
+		LocalBalance:  400000,
+		RemoteBalance: 9600000,
+		NumUpdates:    10,
+	}
+
+	manager.sm.checkConditions(context.Background(), channel)
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, providers.EventCondition, sentEvents[0].Type)
+	assert.Equal(t, providers.SeverityCritical, sentEvents[0].Severity)
+	assert.Equal(t, "Local balance is low for channel to node", sentEvents[0].Title)
+	assert.Equal(t, ":rotating_light: Local balance is low: channel `1` to `node`:\n  Local: 400000\n  Remote: 9600000", sentMessages[0])
+
+	// Conditions that are still met are not notified again
+	channel.NumUpdates = 500
+	manager.sm.checkConditions(context.Background(), channel)
+
+	assert.Len(t, sentEvents, 1)
+
+	// The updates are counted since the last alert of the channel
+	channel.NumUpdates = 1011
+	manager.sm.checkConditions(context.Background(), channel)
+
+	assert.Len(t, sentEvents, 2)
+	assert.Equal(t, "Condition busy is met for channel to node", sentEvents[1].Title)
+	assert.Equal(t, []*providers.Field{
+		{Name: "Alert", Value: "Condition busy is met"},
+		{Name: "Condition", Value: "busy"},
+		{Name: "Expression", Value: "num_updates_since_last_alert > 1000"},
+	}, sentEvents[1].Fields)
+	assert.Equal(t, ":warning: Condition busy is met: channel `1` to `node`:\n  Local: 400000\n  Remote: 9600000", sentMessages[1])
+
+	// Conditions are notified again once they were not met in the meantime
+	channel.LocalBalance = 600000
+	manager.sm.checkConditions(context.Background(), channel)
+
+	// The busy condition is not met anymore either, because it was just notified
+	assert.Empty(t, manager.sm.notifiedStates[1].MetConditions)
+
+	channel.LocalBalance = 400000
+	manager.sm.checkConditions(context.Background(), channel)
+
+	assert.Len(t, sentEvents, 3)
+	assert.Equal(t, "Local balance is low for channel to node", sentEvents[2].Title)
+
+	cleanUp()
+}
+
+func TestConditionsSeeEvents(t *testing.T) {
+	cleanUp()
+
+	manager := &ChannelManager{
+		InactiveGracePeriod: 600,
+		lnd:                 nodeLnd,
+		Conditions: []*Condition{
+			{Name: "inactive", Expression: "!active"},
+			{Name: "updated", Expression: "num_updates_since_last_alert > 0"},
+		},
+	}
+	assert.Nil(t, manager.ParseConditions())
+
+	newTestManager(manager, nil, activityChannel())
+
+	ctx := context.Background()
+	channel := manager.sm.channels[1]
+	channel.Active = true
+
+	// The activity of the channel is applied before the next reconcile
+	manager.activity.handleInactive(ctx, activityChannelPointRpc())
+
+	assert.False(t, channel.Active)
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, "Condition inactive is met for channel to node", sentEvents[0].Title)
+
+	manager.activity.handleActive(ctx, activityChannelPointRpc())
+	assert.True(t, channel.Active)
+
+	// Settled HTLCs count as updates of the channel
+	manager.sm.handleHtlc(ctx, 1, 0, true, 1000000)
+
+	assert.Equal(t, uint64(1), channel.NumUpdates)
+	assert.Len(t, sentEvents, 2)
+	assert.Equal(t, "Condition updated is met for channel to node", sentEvents[1].Title)
+
+	cleanUp()
+}
@@ -0,0 +1,55 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+)
+
+func (manager *ChannelManager) handleSubscriptionError(subscription string, err error) {
+	logger.Warning("LND " + subscription + " subscription errored: " + err.Error())
+
+	wasConnected := len(manager.brokenSubscriptions) == 0
+	manager.brokenSubscriptions[subscription] = true
+
+	if wasConnected {
+		manager.logConnectionLost(err)
+	}
+}
+
+func (manager *ChannelManager) handleSubscriptionRestored(ctx context.Context, subscription string) {
+	logger.Info("LND " + subscription + " subscription restored")
+
+	if !manager.brokenSubscriptions[subscription] {
+		return
+	}
+
+	delete(manager.brokenSubscriptions, subscription)
+
+	if len(manager.brokenSubscriptions) != 0 {
+		return
+	}
+
+	// Events could have been missed while the connection was lost
+	manager.recoverMissedEvents(ctx)
+	manager.logConnectionRestored()
+}
+
+func (manager *ChannelManager) logConnectionLost(err error) {
+	_ = manager.notificationProvider.SendEvent(&providers.Event{
+		Type:     providers.EventConnectionLost,
+		Severity: providers.SeverityCritical,
+		Title:    "LND connection lost",
+		Fields: []*providers.Field{
+			{Name: "Error", Value: err.Error()},
+		},
+	})
+}
+
+func (manager *ChannelManager) logConnectionRestored() {
+	_ = manager.notificationProvider.SendEvent(&providers.Event{
+		Type:     providers.EventConnectionRestored,
+		Severity: providers.SeverityInfo,
+		Title:    "LND connection restored",
+	})
+}
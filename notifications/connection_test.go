@@ -0,0 +1,83 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestConnectionLostRestored(t *testing.T) {
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	channels = []*lnrpc.Channel{}
+
+	channelManager := newTestManager(&ChannelManager{InactiveGracePeriod: 600}, nil)
+
+	cleanUp()
+
+	err := errors.New("connection refused")
+
+	channelManager.handleSubscriptionError(channelEventsSubscription, err)
+	channelManager.handleSubscriptionError(htlcEventsSubscription, err)
+
+	// Only the first broken subscription should cause a notification
+	assert.Len(t, sentMessages, 1)
+	assert.Equal(t, ":rotating_light: LND connection lost: `connection refused`", sentMessages[0])
+
+	// Restoring a subscription that was never broken should not do anything
+	channelManager.handleSubscriptionRestored(context.Background(), invoicesSubscription)
+	channelManager.handleSubscriptionRestored(context.Background(), channelEventsSubscription)
+
+	assert.Len(t, sentMessages, 1)
+
+	channelManager.handleSubscriptionRestored(context.Background(), htlcEventsSubscription)
+
+	assert.Len(t, sentMessages, 2)
+	assert.Equal(t, ":zap: LND connection restored", sentMessages[1])
+	assert.Len(t, channelManager.brokenSubscriptions, 0)
+
+	cleanUp()
+}
+
+func TestRecoverMissedEvents(t *testing.T) {
+	cleanUp()
+
+	manager := newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil, activityChannel())
+
+	ctx := context.Background()
+
+	// The tracked channel 1 was closed and channel 2 opened while the connection was lost
+	channels = []*lnrpc.Channel{
+		{ChanId: 2, ChannelPoint: "txid:2", RemotePubkey: "pubkey", Capacity: 100, LocalBalance: 50, RemoteBalance: 50},
+	}
+	closedChannels = []*lnrpc.ChannelCloseSummary{
+		{ChanId: 1, ChannelPoint: activityChannelPoint, RemotePubkey: "pubkey", CloseType: lnrpc.ChannelCloseSummary_COOPERATIVE_CLOSE},
+	}
+
+	manager.handleSubscriptionError(channelEventsSubscription, errors.New("connection refused"))
+	manager.handleSubscriptionRestored(ctx, channelEventsSubscription)
+
+	assert.Len(t, sentEvents, 4)
+	assert.Equal(t, providers.EventOpened, sentEvents[1].Type)
+	assert.True(t, sentEvents[1].CatchUp)
+	assert.Equal(t, uint64(2), sentEvents[1].Channel.ID)
+	assert.Equal(t, providers.EventClosed, sentEvents[2].Type)
+	assert.True(t, sentEvents[2].CatchUp)
+	assert.Equal(t, uint64(1), sentEvents[2].Channel.ID)
+	assert.Equal(t, providers.EventConnectionRestored, sentEvents[3].Type)
+
+	assert.Nil(t, manager.sm.channels[1])
+	assert.NotNil(t, manager.sm.channels[2])
+
+	// The activity of the channels is synced
+	assert.Contains(t, manager.activity.inactive, "txid:2")
+
+	channels = nil
+	closedChannels = nil
+	cleanUp()
+}
@@ -1,74 +1,150 @@
 package notifications
 
 import (
-	"github.com/BoltzExchange/channel-bot/lnd"
+	"context"
 	"github.com/BoltzExchange/channel-bot/notifications/providers"
-	"github.com/google/logger"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"strconv"
 )
 
-func (sc *SignificantChannel) logBalance(notificationProvider providers.NotificationProvider, channel *lnrpc.Channel, isImbalanced bool) {
-	var info string
-	var emoji string
+const channelPointField = "Channel point"
+
+func (sc *SignificantChannel) logBalance(
+	notificationProvider providers.NotificationProvider,
+	channel *lnrpc.Channel,
+	isImbalanced bool,
+	suppressedFlips int,
+) {
+	_ = notificationProvider.SendEvent(&providers.Event{
+		Type:     balanceEventType(isImbalanced),
+		Severity: balanceSeverity(isImbalanced),
+		Title:    "Channel " + sc.Alias + " is " + balanceInfo(isImbalanced),
+		Channel: &providers.Channel{
+			ID:      channel.ChanId,
+			Alias:   sc.Alias,
+			Private: channel.Private,
+		},
+		Peer: &providers.Peer{
+			Pubkey: channel.RemotePubkey,
+		},
+		Balances:   channelBalances(channel),
+		Thresholds: sc.ratios.thresholds(channel.Capacity),
+		Fields:     balanceFields(sc.ratios, channel, isImbalanced, suppressedFlips),
+	})
+}
+
+func (manager *ChannelManager) logBalance(
+	ctx context.Context,
+	channel *lnrpc.Channel,
+	rule *Rule,
+	isImbalanced bool,
+	suppressedFlips int,
+) {
+	if !manager.logInsignificant {
+		return
+	}
+
+	nodeName := manager.nc.getNodeName(ctx, channel.RemotePubkey)
+
+	severity := balanceSeverity(isImbalanced)
 
 	if isImbalanced {
-		info = "imbalanced"
-		emoji = ":rotating_light:"
-	} else {
-		info = "balanced again"
-		emoji = ":zap:"
+		severity = rule.severity
 	}
 
-	message := emoji + " Channel **" + sc.Alias + "** `" + lnd.FormatChannelID(channel.ChanId) + "` is **" + info + "** " + emoji + " :\n"
+	var fields []*providers.Field
 
-	localBalance, remoteBalance := formatChannelBalances(channel)
-	message += localBalance + "\n"
-	message += "    Minimal: " + formatFloat(float64(channel.Capacity)*sc.ratios.min) + "\n"
-	message += "    Maximal: " + formatFloat(float64(channel.Capacity)*sc.ratios.max) + "\n"
-	message += remoteBalance
+	if rule.Name != defaultRuleName {
+		fields = append(fields, &providers.Field{Name: "Rule", Value: rule.Name})
+	}
 
-	logger.Info(message)
-	_ = notificationProvider.SendMessage(message)
+	_ = manager.notificationProvider.SendEvent(&providers.Event{
+		Type:     balanceEventType(isImbalanced),
+		Severity: severity,
+		Title:    "Channel to " + nodeName + " is " + balanceInfo(isImbalanced),
+		Channel: &providers.Channel{
+			ID:      channel.ChanId,
+			Private: channel.Private,
+		},
+		Peer: &providers.Peer{
+			Pubkey: channel.RemotePubkey,
+			Alias:  nodeName,
+		},
+		Balances:   channelBalances(channel),
+		Thresholds: rule.ratios.thresholds(channel.Capacity),
+		Fields:     append(fields, balanceFields(rule.ratios, channel, isImbalanced, suppressedFlips)...),
+	})
 }
 
-func (manager *ChannelManager) logBalance(channel *lnrpc.Channel, isImbalanced bool) {
-	if !manager.logInsignificant {
-		return
+func (sc *SignificantChannel) logSignificantNotFound(notificationProvider providers.NotificationProvider) {
+	event := &providers.Event{
+		Type:     providers.EventSignificantNotFound,
+		Severity: providers.SeverityCritical,
+		Title:    "Channel " + sc.Alias + " couldn't be found",
+		Channel: &providers.Channel{
+			ID:    sc.chanId,
+			Alias: sc.Alias,
+		},
+	}
+
+	if sc.Pubkey != "" {
+		event.Peer = &providers.Peer{Pubkey: sc.Pubkey}
+	}
+
+	if sc.ChannelPoint != "" {
+		event.Fields = []*providers.Field{{Name: channelPointField, Value: sc.ChannelPoint}}
 	}
 
-	var info string
+	_ = notificationProvider.SendEvent(event)
+}
 
+func balanceInfo(isImbalanced bool) string {
 	if isImbalanced {
-		info = "imbalanced"
-	} else {
-		info = "balanced again"
+		return "imbalanced"
 	}
 
-	message := "Channel `" + lnd.FormatChannelID(channel.ChanId) + "` to `" + manager.nc.getNodeName(channel.RemotePubkey) + "` is **" + info + "**:\n"
+	return "balanced again"
+}
 
-	localBalance, remoteBalance := formatChannelBalances(channel)
-	message += localBalance + "\n" + remoteBalance
+func balanceEventType(isImbalanced bool) providers.EventType {
+	if isImbalanced {
+		return providers.EventImbalanced
+	}
 
-	logger.Info(message)
-	_ = manager.notificationProvider.SendMessage(message)
+	return providers.EventBalanced
 }
 
-func (sc *SignificantChannel) logSignificantNotFound(notificationProvider providers.NotificationProvider) {
-	emoji := ":rotating_light:"
-	message := emoji + " Channel **" + sc.Alias + "** `" + lnd.FormatChannelID(sc.ChannelID) + "` couldn't be found " + emoji
+func balanceSeverity(isImbalanced bool) providers.Severity {
+	if isImbalanced {
+		return providers.SeverityWarning
+	}
 
-	logger.Info(message)
-	_ = notificationProvider.SendMessage(message)
+	return providers.SeverityInfo
 }
 
-func formatChannelBalances(channel *lnrpc.Channel) (local string, remote string) {
-	local = "  Local: " + strconv.FormatInt(channel.LocalBalance, 10)
-	remote = "  Remote: " + strconv.FormatInt(channel.RemoteBalance, 10)
+// balanceFields returns the fields that explain the balances in balance notifications
+func balanceFields(r ratios, channel *lnrpc.Channel, isImbalanced bool, suppressedFlips int) []*providers.Field {
+	fields := breachedLimitFields(r, channel, isImbalanced)
+	fields = append(fields, unsettledFields(channel)...)
+	fields = append(fields, r.model.fields()...)
 
-	return local, remote
+	return append(fields, suppressedFlipsFields(suppressedFlips)...)
 }
 
-func formatFloat(float float64) string {
-	return strconv.FormatFloat(float, 'f', 0, 64)
+func suppressedFlipsFields(suppressedFlips int) []*providers.Field {
+	if suppressedFlips == 0 {
+		return nil
+	}
+
+	return []*providers.Field{
+		{Name: "Suppressed flips", Value: strconv.Itoa(suppressedFlips)},
+	}
+}
+
+func channelBalances(channel *lnrpc.Channel) *providers.Balances {
+	return &providers.Balances{
+		Local:    channel.LocalBalance,
+		Remote:   channel.RemoteBalance,
+		Capacity: channel.Capacity,
+	}
 }
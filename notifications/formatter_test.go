@@ -1,7 +1,8 @@
 package notifications
 
 import (
-	"github.com/BoltzExchange/channel-bot/utils"
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
 	"github.com/google/logger"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/stretchr/testify/assert"
@@ -38,17 +39,22 @@ func TestLogSignificantBalance(t *testing.T) {
 
 	// Imbalanced
 	message := ":rotating_light: Channel **Boltz** `123` is **imbalanced** :rotating_light: :\n  Local: 32120398448\n    Minimal: 31088304354\n    Maximal: 124353217415\n  Remote: 123321123321"
-	significantChannel.logBalance(&MockDiscordClient{}, channel, true)
+	significantChannel.logBalance(mockProvider(), channel, true, 0)
 
 	checkLogs(t, message)
 
+	assert.Equal(t, providers.EventImbalanced, sentEvents[0].Type)
+	assert.Equal(t, providers.SeverityWarning, sentEvents[0].Severity)
+	assert.Equal(t, "Channel Boltz is imbalanced", sentEvents[0].Title)
+	assert.Equal(t, &providers.Thresholds{Min: 31088304354, Max: 124353217415}, sentEvents[0].Thresholds)
+
 	cleanUp()
 
 	// Balanced
 	message = strings.Replace(message, "imbalanced", "balanced again", 1)
 	message = strings.Replace(message, ":rotating_light:", ":zap:", 2)
 
-	significantChannel.logBalance(&MockDiscordClient{}, channel, false)
+	significantChannel.logBalance(mockProvider(), channel, false, 0)
 
 	checkLogs(t, message)
 
@@ -68,24 +74,19 @@ func TestLogBalance(t *testing.T) {
 	mockWriter := &MockWriter{}
 	logger.Init("", false, false, mockWriter)
 
-	cm := &ChannelManager{
-		logInsignificant:     true,
-		lnd:                  &MockLndClient{},
-		notificationProvider: &MockDiscordClient{},
-		nc:                   initNodeCache(&MockLndClient{}, &utils.Clock{}),
-	}
+	cm := newTestManager(&ChannelManager{logInsignificant: true}, nil)
 
 	// Imbalanced
 	message := "Channel `123` to `pubkey` is **imbalanced**:\n  Local: 32120398448\n  Remote: 123321123321"
-	cm.logBalance(channel, true)
+	cm.logBalance(context.Background(), channel, defaultRule(ratios{min: 0.3, max: 0.7}), true, 0)
 
-	checkLogs(t, message)
+	checkLogs(t, message+"\n  Breached limit: Maximal ratio of 0.7")
 
 	cleanUp()
 
 	// Balanced
 	message = strings.Replace(message, "imbalanced", "balanced again", 1)
-	cm.logBalance(channel, false)
+	cm.logBalance(context.Background(), channel, defaultRule(ratios{min: 0.3, max: 0.7}), false, 0)
 
 	checkLogs(t, message)
 
@@ -98,6 +99,7 @@ func TestLogSignificantNotFound(t *testing.T) {
 	significantChannel := &SignificantChannel{
 		Alias:     "Boltz",
 		ChannelID: 123,
+		chanId:    123,
 		ratios: ratios{
 			min: 0.2,
 			max: 0.8,
@@ -105,28 +107,20 @@ func TestLogSignificantNotFound(t *testing.T) {
 	}
 
 	message := ":rotating_light: Channel **Boltz** `123` couldn't be found :rotating_light:"
-	significantChannel.logSignificantNotFound(&MockDiscordClient{})
+	significantChannel.logSignificantNotFound(mockProvider())
 
 	checkLogs(t, message)
 
 	cleanUp()
-}
-
-func TestFormatChannelBalances(t *testing.T) {
-	channel := &lnrpc.Channel{
-		LocalBalance:  321,
-		RemoteBalance: 123,
-	}
 
-	local, remote := formatChannelBalances(channel)
+	// Significant channels without ID show the peer or channel point they are identified by
+	(&SignificantChannel{Alias: "Boltz", Pubkey: "pubkey"}).logSignificantNotFound(mockProvider())
+	checkLogs(t, ":rotating_light: Channel **Boltz** to `pubkey` couldn't be found :rotating_light:")
 
-	assert.Equal(t, local, "  Local: 321")
-	assert.Equal(t, remote, "  Remote: 123")
-}
+	cleanUp()
 
-func TestFormatFloat(t *testing.T) {
-	assert.Equal(t, formatFloat(230948), "230948")
+	(&SignificantChannel{Alias: "Boltz", ChannelPoint: "txid:1"}).logSignificantNotFound(mockProvider())
+	checkLogs(t, ":rotating_light: Channel **Boltz** `txid:1` couldn't be found :rotating_light:")
 
-	// Should ignore decimals
-	assert.Equal(t, formatFloat(0.1), "0")
+	cleanUp()
 }
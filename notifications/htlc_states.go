@@ -1,32 +1,43 @@
 package notifications
 
 import (
+	"context"
 	"fmt"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"strconv"
 )
 
 type htlcHandler interface {
-	handleHtlc(channelId uint64, isIncoming bool, amtMsat uint64)
+	handleHtlc(ctx context.Context, channelId uint64, htlcId uint64, isIncoming bool, amtMsat uint64)
+	handleFailedHtlc(ctx context.Context, channelId uint64, htlcId uint64, isIncoming bool)
 }
 
+// htlcStates tracks the HTLCs that are in flight. They are only persisted on reconcile and shutdown, because
+// writing to the database for every forwarded HTLC is too slow for busy nodes. HTLCs that were not persisted
+// because the bot crashed are added back from the channels of LND when it recovers the missed events on startup
 type htlcStates struct {
 	sm           htlcHandler
+	store        *stateStore
 	pendingHtlcs map[string]*routerrpc.ForwardEvent
 }
 
-func initHtlcStates(sm htlcHandler) *htlcStates {
+func initHtlcStates(sm htlcHandler, store *stateStore) *htlcStates {
 	return &htlcStates{
 		sm:           sm,
-		pendingHtlcs: map[string]*routerrpc.ForwardEvent{},
+		store:        store,
+		pendingHtlcs: store.loadPendingHtlcs(),
 	}
 }
 
-func (s *htlcStates) handleEvent(event *routerrpc.HtlcEvent) {
-	s.handleHtlcSide(event, true, event.IncomingChannelId, event.IncomingHtlcId)
-	s.handleHtlcSide(event, false, event.OutgoingChannelId, event.OutgoingHtlcId)
+func (s *htlcStates) handleEvent(ctx context.Context, event *routerrpc.HtlcEvent) {
+	s.handleHtlcSide(ctx, event, true, event.IncomingChannelId, event.IncomingHtlcId)
+	s.handleHtlcSide(ctx, event, false, event.OutgoingChannelId, event.OutgoingHtlcId)
 }
 
 func (s *htlcStates) handleHtlcSide(
+	ctx context.Context,
 	event *routerrpc.HtlcEvent,
 	isIncoming bool,
 	channelId, htlcId uint64,
@@ -36,7 +47,9 @@ func (s *htlcStates) handleHtlcSide(
 	}
 
 	if fe := event.GetForwardEvent(); fe != nil {
-		s.pendingHtlcs[concatChanIdHtlcId(channelId, htlcId)] = fe
+		id := concatChanIdHtlcId(channelId, htlcId)
+
+		s.pendingHtlcs[id] = fe
 		return
 	}
 
@@ -58,13 +71,70 @@ func (s *htlcStates) handleHtlcSide(
 			amount = htlc.Info.OutgoingAmtMsat
 		}
 
-		s.sm.handleHtlc(channelId, isIncoming, amount)
+		s.sm.handleHtlc(ctx, channelId, htlcId, isIncoming, amount)
 
 		return
 	}
 
 	// If it is not a new HTLC or a known HTLC settling, delete the HTLC id (in case we have it)
 	delete(s.pendingHtlcs, concatChanIdHtlcId(channelId, htlcId))
+	s.sm.handleFailedHtlc(ctx, channelId, htlcId, isIncoming)
+}
+
+// reconcile makes the pending HTLCs match the ones of the channels in LND. HTLCs that were resolved
+// without an event being received are dropped and the ones that were missed are added
+func (s *htlcStates) reconcile(channels []*lnrpc.Channel) {
+	pending := map[string]bool{}
+	added := 0
+
+	for _, channel := range channels {
+		for _, htlc := range channel.PendingHtlcs {
+			id := concatChanIdHtlcId(channel.ChanId, htlc.HtlcIndex)
+			pending[id] = true
+
+			if s.pendingHtlcs[id] != nil {
+				continue
+			}
+
+			fe := forwardEventFromHtlc(htlc)
+
+			s.pendingHtlcs[id] = fe
+			added++
+		}
+	}
+
+	removed := 0
+
+	for id := range s.pendingHtlcs {
+		if !pending[id] {
+			delete(s.pendingHtlcs, id)
+			removed++
+		}
+	}
+
+	if added != 0 || removed != 0 {
+		logger.Info("Reconciled pending HTLCs: added " + strconv.Itoa(added) + " and removed " + strconv.Itoa(removed))
+	}
+
+	s.persist()
+}
+
+// persist writes the pending HTLCs to the database
+func (s *htlcStates) persist() {
+	s.store.savePendingHtlcs(s.pendingHtlcs)
+}
+
+func forwardEventFromHtlc(htlc *lnrpc.HTLC) *routerrpc.ForwardEvent {
+	amountMsat := uint64(htlc.Amount) * 1000
+
+	return &routerrpc.ForwardEvent{
+		Info: &routerrpc.HtlcInfo{
+			IncomingTimelock: htlc.ExpirationHeight,
+			OutgoingTimelock: htlc.ExpirationHeight,
+			IncomingAmtMsat:  amountMsat,
+			OutgoingAmtMsat:  amountMsat,
+		},
+	}
 }
 
 func concatChanIdHtlcId(channelId, htlcId uint64) string {
@@ -1,6 +1,8 @@
 package notifications
 
 import (
+	"context"
+	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -14,9 +16,14 @@ type handledHtlc struct {
 
 type mockHtlcHandler struct {
 	handledHtlcs []*handledHtlc
+	failedHtlcs  []string
 }
 
-func (m *mockHtlcHandler) handleHtlc(channelId uint64, isIncoming bool, amtMsat uint64) {
+func (m *mockHtlcHandler) handleFailedHtlc(_ context.Context, channelId uint64, htlcId uint64, _ bool) {
+	m.failedHtlcs = append(m.failedHtlcs, concatChanIdHtlcId(channelId, htlcId))
+}
+
+func (m *mockHtlcHandler) handleHtlc(_ context.Context, channelId uint64, _ uint64, isIncoming bool, amtMsat uint64) {
 	m.handledHtlcs = append(m.handledHtlcs, &handledHtlc{
 		channelId:  channelId,
 		isIncoming: isIncoming,
@@ -25,7 +32,7 @@ func (m *mockHtlcHandler) handleHtlc(channelId uint64, isIncoming bool, amtMsat
 }
 
 var hc = &mockHtlcHandler{}
-var hs = initHtlcStates(hc)
+var hs = initHtlcStates(hc, nil)
 
 var event = &routerrpc.HtlcEvent{
 	IncomingChannelId: 987,
@@ -51,7 +58,7 @@ func TestConcatChanIdHtlcId(t *testing.T) {
 }
 
 func TestHandleEventForward(t *testing.T) {
-	hs.handleEvent(event)
+	hs.handleEvent(context.Background(), event)
 
 	assert.Len(t, hs.pendingHtlcs, 2)
 	assert.Equal(
@@ -76,7 +83,7 @@ func TestHandleEventSettle(t *testing.T) {
 		},
 	}
 
-	hs.handleEvent(settleEvent)
+	hs.handleEvent(context.Background(), settleEvent)
 
 	assert.Len(t, hs.pendingHtlcs, 1)
 	assert.Equal(
@@ -101,7 +108,7 @@ func TestHandleEventSettle(t *testing.T) {
 		},
 	}
 
-	hs.handleEvent(settleEvent)
+	hs.handleEvent(context.Background(), settleEvent)
 
 	assert.Len(t, hs.pendingHtlcs, 0)
 
@@ -114,7 +121,7 @@ func TestHandleEventSettle(t *testing.T) {
 }
 
 func TestHandleEventFailure(t *testing.T) {
-	hs.handleEvent(event)
+	hs.handleEvent(context.Background(), event)
 
 	failEvent := &routerrpc.HtlcEvent{
 		IncomingChannelId: 987,
@@ -125,8 +132,11 @@ func TestHandleEventFailure(t *testing.T) {
 
 	assert.Len(t, hs.pendingHtlcs, 2)
 
-	hs.handleEvent(failEvent)
+	hs.handleEvent(context.Background(), failEvent)
 	assert.Len(t, hs.pendingHtlcs, 0)
+
+	// Failed HTLCs are removed from the pending ones of the channels
+	assert.Equal(t, []string{"987/56", "123/3"}, hc.failedHtlcs[len(hc.failedHtlcs)-2:])
 }
 
 func TestIgnoreUnknownSettle(t *testing.T) {
@@ -141,13 +151,13 @@ func TestIgnoreUnknownSettle(t *testing.T) {
 		},
 	}
 
-	hs.handleEvent(settleEvent)
+	hs.handleEvent(context.Background(), settleEvent)
 	assert.Equal(t, htlcsHandled, hc.handledHtlcs)
 }
 
 func TestHandleEventSideUnpopulated(t *testing.T) {
 	hc := &mockHtlcHandler{}
-	hs := initHtlcStates(hc)
+	hs := initHtlcStates(hc, nil)
 
 	event := &routerrpc.HtlcEvent{
 		OutgoingChannelId: 123,
@@ -163,7 +173,7 @@ func TestHandleEventSideUnpopulated(t *testing.T) {
 		},
 	}
 
-	hs.handleEvent(event)
+	hs.handleEvent(context.Background(), event)
 
 	assert.Len(t, hs.pendingHtlcs, 1)
 	assert.Equal(
@@ -172,3 +182,65 @@ func TestHandleEventSideUnpopulated(t *testing.T) {
 		hs.pendingHtlcs[concatChanIdHtlcId(event.OutgoingChannelId, event.OutgoingHtlcId)],
 	)
 }
+
+func TestReconcile(t *testing.T) {
+	hc := &mockHtlcHandler{}
+	hs := initHtlcStates(hc, nil)
+
+	hs.handleEvent(context.Background(), event)
+	assert.Len(t, hs.pendingHtlcs, 2)
+
+	hs.reconcile([]*lnrpc.Channel{
+		{
+			ChanId: event.OutgoingChannelId,
+			PendingHtlcs: []*lnrpc.HTLC{
+				{
+					Amount:           65,
+					HtlcIndex:        event.OutgoingHtlcId,
+					ExpirationHeight: 753113,
+				},
+			},
+		},
+		{
+			ChanId: 321,
+			PendingHtlcs: []*lnrpc.HTLC{
+				{
+					Incoming:         true,
+					Amount:           21,
+					HtlcIndex:        7,
+					ExpirationHeight: 753200,
+				},
+			},
+		},
+	})
+
+	// The HTLC of the incoming channel was resolved without an event
+	assert.Len(t, hs.pendingHtlcs, 2)
+	assert.Nil(t, hs.pendingHtlcs[concatChanIdHtlcId(event.IncomingChannelId, event.IncomingHtlcId)])
+
+	// Known HTLCs are kept as they are
+	assert.Equal(
+		t,
+		event.GetForwardEvent(),
+		hs.pendingHtlcs[concatChanIdHtlcId(event.OutgoingChannelId, event.OutgoingHtlcId)],
+	)
+
+	// Missed HTLCs are added and can be settled
+	hs.handleEvent(context.Background(), &routerrpc.HtlcEvent{
+		IncomingChannelId: 321,
+		IncomingHtlcId:    7,
+		EventType:         routerrpc.HtlcEvent_FORWARD,
+		Event: &routerrpc.HtlcEvent_SettleEvent{
+			SettleEvent: &routerrpc.SettleEvent{},
+		},
+	})
+
+	assert.Len(t, hs.pendingHtlcs, 1)
+	assert.Equal(t, []*handledHtlc{
+		{
+			channelId:  321,
+			isIncoming: true,
+			amtMsat:    21000,
+		},
+	}, hc.handledHtlcs)
+}
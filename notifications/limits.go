@@ -0,0 +1,101 @@
+package notifications
+
+import (
+	"errors"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"math"
+	"strconv"
+)
+
+const breachedLimitField = "Breached limit"
+
+// disableRatios makes the ratios never be breached, so that only the absolute limits are checked
+func (r *ratios) disableRatios() {
+	r.min = math.Inf(-1)
+	r.max = math.Inf(1)
+}
+
+func (r ratios) hasBalanceLimits() bool {
+	return r.minLocal != 0 || r.maxLocal != 0 || r.minInbound != 0
+}
+
+func (r ratios) validateBalanceLimits() error {
+	if r.minLocal < 0 || r.maxLocal < 0 || r.minInbound < 0 {
+		return errors.New("balance limits cannot be negative")
+	}
+
+	if r.maxLocal != 0 && r.minLocal >= r.maxLocal {
+		return errors.New("min local balance has to be less than max local balance")
+	}
+
+	return nil
+}
+
+// breachedLimit returns a description of the limit the channel breaches or an empty string if it is balanced.
+// Channels that are imbalanced have to be within the limits by the hysteresis to be considered balanced again
+func (r ratios) breachedLimit(channel *lnrpc.Channel, wasImbalanced bool) string {
+	band := 0.0
+
+	if wasImbalanced {
+		band = r.hysteresis
+	}
+
+	channelRatio := r.model.ratio(channel)
+
+	if r.isImbalanced(channelRatio, wasImbalanced) {
+		if channelRatio >= r.max-band {
+			return "Maximal ratio of " + strconv.FormatFloat(r.max, 'f', -1, 64)
+		}
+
+		return "Minimal ratio of " + strconv.FormatFloat(r.min, 'f', -1, 64)
+	}
+
+	balanceBand := int64(math.Round(float64(channel.Capacity) * band))
+
+	switch {
+	case r.minLocal != 0 && channel.LocalBalance < r.minLocal+balanceBand:
+		return "Minimal local balance of " + providers.FormatSats(r.minLocal)
+
+	case r.maxLocal != 0 && channel.LocalBalance > r.maxLocal-balanceBand:
+		return "Maximal local balance of " + providers.FormatSats(r.maxLocal)
+
+	case r.minInbound != 0 && channel.RemoteBalance < r.minInbound+balanceBand:
+		return "Minimal inbound of " + providers.FormatSats(r.minInbound)
+	}
+
+	return ""
+}
+
+// thresholds returns the local balances between which the channel is balanced according to all limits
+func (r ratios) thresholds(capacity int64) *providers.Thresholds {
+	thresholds := &providers.Thresholds{
+		Min: int64(math.Round(float64(capacity) * math.Max(r.min, 0))),
+		Max: int64(math.Round(float64(capacity) * math.Min(r.max, 1))),
+	}
+
+	thresholds.Min = max(thresholds.Min, r.minLocal)
+
+	if r.maxLocal != 0 {
+		thresholds.Max = min(thresholds.Max, r.maxLocal)
+	}
+
+	if r.minInbound != 0 {
+		thresholds.Max = min(thresholds.Max, capacity-r.minInbound)
+	}
+
+	return thresholds
+}
+
+func breachedLimitFields(r ratios, channel *lnrpc.Channel, isImbalanced bool) []*providers.Field {
+	if !isImbalanced {
+		return nil
+	}
+
+	breached := r.breachedLimit(channel, false)
+	if breached == "" {
+		return nil
+	}
+
+	return []*providers.Field{{Name: breachedLimitField, Value: breached}}
+}
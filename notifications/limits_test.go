@@ -0,0 +1,131 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func limitsChannel(localBalance int64, remoteBalance int64) *lnrpc.Channel {
+	return &lnrpc.Channel{
+		ChanId:        1,
+		LocalBalance:  localBalance,
+		RemoteBalance: remoteBalance,
+		Capacity:      1000000,
+	}
+}
+
+func TestBreachedLimit(t *testing.T) {
+	r := ratios{min: 0.1, max: 0.9, minLocal: 200000, maxLocal: 700000, minInbound: 400000}
+
+	assert.Equal(t, "", r.breachedLimit(limitsChannel(500000, 500000), false))
+
+	// Ratios are checked before the absolute limits
+	assert.Equal(t, "Minimal ratio of 0.1", r.breachedLimit(limitsChannel(50000, 950000), false))
+	assert.Equal(t, "Maximal ratio of 0.9", r.breachedLimit(limitsChannel(950000, 50000), false))
+
+	assert.Equal(t, "Minimal local balance of 200,000 sats", r.breachedLimit(limitsChannel(150000, 850000), false))
+	assert.Equal(t, "Maximal local balance of 700,000 sats", r.breachedLimit(limitsChannel(750000, 250000), false))
+	assert.Equal(t, "Minimal inbound of 400,000 sats", r.breachedLimit(limitsChannel(650000, 350000), false))
+
+	// The hysteresis applies to the absolute limits too
+	r.hysteresis = 0.02
+
+	assert.Equal(t, "", r.breachedLimit(limitsChannel(210000, 790000), false))
+	assert.Equal(t, "Minimal local balance of 200,000 sats", r.breachedLimit(limitsChannel(210000, 790000), true))
+	assert.Equal(t, "", r.breachedLimit(limitsChannel(230000, 770000), true))
+
+	// Absolute limits can be used alone
+	alone := ratios{minLocal: 100000}
+	alone.disableRatios()
+
+	assert.Equal(t, "", alone.breachedLimit(limitsChannel(1000000, 0), false))
+	assert.Equal(t, "Minimal local balance of 100,000 sats", alone.breachedLimit(limitsChannel(0, 1000000), false))
+}
+
+func TestThresholds(t *testing.T) {
+	assert.Equal(t, &providers.Thresholds{Min: 300000, Max: 700000}, ratios{min: 0.3, max: 0.7}.thresholds(1000000))
+
+	assert.Equal(t,
+		&providers.Thresholds{Min: 500000, Max: 600000},
+		ratios{min: 0.3, max: 0.7, minLocal: 500000, minInbound: 400000}.thresholds(1000000),
+	)
+
+	assert.Equal(t,
+		&providers.Thresholds{Min: 0, Max: 800000},
+		ratios{min: math.Inf(-1), max: math.Inf(1), maxLocal: 800000}.thresholds(1000000),
+	)
+}
+
+func TestValidateBalanceLimits(t *testing.T) {
+	assert.Nil(t, ratios{}.validateBalanceLimits())
+	assert.Nil(t, ratios{minLocal: 1, maxLocal: 2, minInbound: 3}.validateBalanceLimits())
+
+	assert.EqualError(t, ratios{minLocal: -1}.validateBalanceLimits(), "balance limits cannot be negative")
+	assert.EqualError(t, ratios{minLocal: 2, maxLocal: 2}.validateBalanceLimits(), "min local balance has to be less than max local balance")
+}
+
+func TestParseBalanceLimits(t *testing.T) {
+	manager := &ChannelManager{
+		Rules: []*Rule{
+			{Name: "alone", MinLocal: 100000},
+			{Name: "combined", MinRatio: "0.1", MinInbound: 200000},
+		},
+	}
+
+	assert.Nil(t, manager.ParseRules())
+
+	// Ratios are not checked when only absolute limits are set
+	assert.Equal(t, math.Inf(-1), manager.Rules[0].ratios.min)
+	assert.Equal(t, math.Inf(1), manager.Rules[0].ratios.max)
+	assert.Equal(t, int64(100000), manager.Rules[0].ratios.minLocal)
+
+	assert.Equal(t, 0.1, manager.Rules[1].ratios.min)
+	assert.Equal(t, defaultMaxRatio, manager.Rules[1].ratios.max)
+	assert.Equal(t, int64(200000), manager.Rules[1].ratios.minInbound)
+
+	sm := newTestManager(&ChannelManager{}, []*SignificantChannel{
+		{ChannelID: 1, MaxLocal: 500000},
+	}).sm
+
+	significant := sm.significantChannel(&lnrpc.Channel{ChanId: 1})
+
+	assert.Equal(t, math.Inf(-1), significant.ratios.min)
+	assert.Equal(t, math.Inf(1), significant.ratios.max)
+	assert.Equal(t, int64(500000), significant.ratios.maxLocal)
+
+	assert.EqualError(t, (&ChannelManager{}).ParseSignificantChannels([]*SignificantChannel{
+		{Alias: "test", ChannelID: 1, MinLocal: 2, MaxLocal: 1},
+	}), "invalid significant channel test: min local balance has to be less than max local balance")
+}
+
+func TestCheckChannelBalanceLimits(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	channelManager := newTestManager(&ChannelManager{}, []*SignificantChannel{
+		{Alias: "Boltz", ChannelID: 1, MinRatio: "0.1", MaxRatio: "0.9", MinInbound: 400000},
+	})
+
+	channelManager.sm.checkChannel(context.Background(), limitsChannel(650000, 350000))
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, &providers.Thresholds{Min: 100000, Max: 600000}, sentEvents[0].Thresholds)
+	assert.Equal(t, []*providers.Field{
+		{Name: "Breached limit", Value: "Minimal inbound of 400,000 sats"},
+	}, sentEvents[0].Fields)
+	assert.Equal(t, ":rotating_light: Channel **Boltz** `1` is **imbalanced** :rotating_light: :\n"+
+		"  Local: 650000\n"+
+		"    Minimal: 100000\n"+
+		"    Maximal: 600000\n"+
+		"  Remote: 350000\n"+
+		"  Breached limit: Minimal inbound of 400,000 sats", sentMessages[0])
+
+	cleanUp()
+}
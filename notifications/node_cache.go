@@ -1,6 +1,7 @@
 package notifications
 
 import (
+	"context"
 	"github.com/BoltzExchange/channel-bot/lnd"
 	"github.com/BoltzExchange/channel-bot/utils"
 	"time"
@@ -16,27 +17,30 @@ type nodeInfo struct {
 type nodeCache struct {
 	clock *utils.Clock
 	lnd   lnd.LightningClient
+	store *stateStore
 
 	cache map[string]*nodeInfo
 }
 
-func initNodeCache(lnd lnd.LightningClient, clock *utils.Clock) *nodeCache {
+func initNodeCache(lnd lnd.LightningClient, clock *utils.Clock, store *stateStore) *nodeCache {
 	return &nodeCache{
 		clock: clock,
 		lnd:   lnd,
-		cache: map[string]*nodeInfo{},
+		store: store,
+		cache: store.loadNodes(),
 	}
 }
 
-func (nc *nodeCache) getNodeName(pubkey string) string {
+func (nc *nodeCache) getNodeName(ctx context.Context, pubkey string) string {
 	c := nc.cache[pubkey]
 
 	if c == nil || time.Since(c.fetchedAt) > nodeCacheExpiration {
 		c = &nodeInfo{
-			name:      lnd.GetNodeName(nc.lnd, pubkey),
+			name:      lnd.GetNodeName(ctx, nc.lnd, pubkey),
 			fetchedAt: nc.clock.Now(),
 		}
 		nc.cache[pubkey] = c
+		nc.store.saveNode(pubkey, c)
 	}
 
 	return c.name
@@ -1,6 +1,7 @@
 package notifications
 
 import (
+	"context"
 	"github.com/BoltzExchange/channel-bot/utils"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -13,11 +14,11 @@ func TestGetNodeName(t *testing.T) {
 		MockTime: time.Now(),
 	}
 
-	nc := initNodeCache(lnd, clock)
+	nc := initNodeCache(lnd, clock, nil)
 
 	assert.Len(t, nc.cache, 0)
 
-	assert.Equal(t, "pubkey", nc.getNodeName("pubkey"))
+	assert.Equal(t, "pubkey", nc.getNodeName(context.Background(), "pubkey"))
 
 	assert.Len(t, nc.cache, 1)
 	assert.Equal(t, "pubkey", nc.cache["pubkey"].name)
@@ -28,8 +29,8 @@ func TestGetNodeName(t *testing.T) {
 
 	assert.Equal(t, "pubkey", nc.cache["pubkey"].name)
 
-	assert.Equal(t, lnd.nodeAlias, nc.getNodeName("otherPubkey"))
+	assert.Equal(t, lnd.nodeAlias, nc.getNodeName(context.Background(), "otherPubkey"))
 
 	lnd.nodeAlias = "someNewName"
-	assert.Equal(t, lnd.nodeAlias, nc.getNodeName("otherPubkey"))
+	assert.Equal(t, lnd.nodeAlias, nc.getNodeName(context.Background(), "otherPubkey"))
 }
@@ -1,95 +1,285 @@
 package notifications
 
 import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/database"
 	"github.com/BoltzExchange/channel-bot/lnd"
 	"github.com/BoltzExchange/channel-bot/notifications/providers"
 	"github.com/BoltzExchange/channel-bot/utils"
 	"github.com/google/logger"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"time"
+)
+
+const (
+	channelEventsSubscription = "channel events"
+	htlcEventsSubscription    = "HTLC events"
+	invoicesSubscription      = "invoices"
 )
 
 type subscriptionChannels struct {
-	htlcEvents  <-chan *routerrpc.HtlcEvent
-	htlcErrChan <-chan error
+	channelEvents         <-chan *lnrpc.ChannelEventUpdate
+	channelEventsErrChan  <-chan error
+	channelEventsRestored <-chan struct{}
 
-	invoices        <-chan *lnrpc.Invoice
-	invoicesErrChan <-chan error
+	htlcEvents   <-chan *routerrpc.HtlcEvent
+	htlcErrChan  <-chan error
+	htlcRestored <-chan struct{}
+
+	invoices         <-chan *lnrpc.Invoice
+	invoicesErrChan  <-chan error
+	invoicesRestored <-chan struct{}
 }
 
 type ChannelManager struct {
+	Interval int `long:"notifications.interval" description:"Interval in seconds at which the tracked channel balances should be reconciled with LND. Set to 0 to disable this feature"`
+
+	Hysteresis float64 `long:"notifications.hysteresis" description:"Ratio by which imbalanced channels have to be within the thresholds to be considered balanced again"`
+	MinDwell   int     `long:"notifications.mindwell" description:"Time in seconds a channel has to stay imbalanced or balanced before the change is notified"`
+	Cooldown   int     `long:"notifications.cooldown" description:"Minimal time in seconds between two balance notifications of a channel"`
+
+	UnsettledTimeout int `long:"notifications.unsettledtimeout" description:"Time in seconds after which channels with pending HTLCs are notified when any outcome of the HTLCs breaches a limit. Set to 0 to disable this feature"`
+
+	FundingConfirmations int `long:"notifications.fundingconfirmations" description:"Confirmations of funding transactions after which channels are usable. Shown as the required confirmations of pending opens, because LND does not expose the number a channel needs"`
+
+	LockedFundsInterval int `long:"notifications.lockedfundsinterval" description:"Interval in hours at which a summary of the funds locked in closing channels is sent. Set to 0 to disable this feature"`
+
+	InactiveGracePeriod int `long:"notifications.inactivegraceperiod" description:"Time in seconds a channel has to be inactive before it is notified"`
+
+	AggregatePeers bool `long:"notifications.aggregatepeers" description:"Whether the balances of all channels to a peer should be checked combined"`
+
+	BalanceModel string `long:"notifications.balancemodel" description:"Balances that are checked: \"raw\", \"spendable\" or \"receivable\""`
+
+	// These options are only parsed in the TOML config file
+	Rules []*Rule
+	// Names of tags mapped to the pubkeys of peers and channel IDs they are set for
+	Tags             map[string][]string
+	Conditions       []*Condition
+	SignificantPeers []*SignificantPeer
+
 	lnd                  lnd.LightningClient
 	notificationProvider providers.NotificationProvider
 
 	logInsignificant bool
+	balanceModel     balanceModel
 
-	nc *nodeCache
-	sm *stateManager
+	nc    *nodeCache
+	sm    *stateManager
+	hs    *htlcStates
+	store *stateStore
+
+	activity *channelActivity
+	opens    *openTracker
+	closes   *closeTracker
 
 	subs *subscriptionChannels
+
+	// Names of the subscriptions to LND that are currently broken
+	brokenSubscriptions map[string]bool
 }
 
 type ratios struct {
 	min float64
 	max float64
+
+	// Absolute limits in satoshis that are not checked when they are 0
+	minLocal   int64
+	maxLocal   int64
+	minInbound int64
+
+	hysteresis float64
+	minDwell   time.Duration
+	model      balanceModel
 }
 
 type SignificantChannel struct {
-	Alias     string
-	ChannelID uint64
+	Alias string
+
+	// Exactly one of these has to be set to identify the channel. Channel IDs and short channel IDs
+	// match both the alias and the confirmed SCIDs of a channel and pubkeys match all channels to the peer
+	ChannelID      uint64
+	ShortChannelID string
+	ChannelPoint   string
+	Pubkey         string
 
 	// These values are just for parsing
-	MinRatio string
-	MaxRatio string
+	MinRatio   string
+	MaxRatio   string
+	Hysteresis string
+
+	// Absolute limits in satoshis which can be used alone or combined with the ratios
+	MinLocal   int64
+	MaxLocal   int64
+	MinInbound int64
+
+	// Overrides the default minimal time in seconds before a change of the balance is notified
+	MinDwell int
 
-	// This struct is actually used for comparisons
+	// These values are actually used for matching and comparisons
+	chanId uint64
 	ratios ratios
 }
 
 func (manager *ChannelManager) Init(
+	ctx context.Context,
 	significantChannels []*SignificantChannel,
 	logInsignificant bool,
 	lnd lnd.LightningClient,
 	notificationProvider providers.NotificationProvider,
+	db *database.Database,
 ) {
 	logger.Info("Starting notification bot")
 
 	manager.lnd = lnd
 	manager.logInsignificant = logInsignificant
 	manager.notificationProvider = notificationProvider
-	manager.nc = initNodeCache(manager.lnd, &utils.Clock{})
+	manager.store = initStateStore(db)
+	manager.nc = initNodeCache(manager.lnd, &utils.Clock{}, manager.store)
 	manager.sm = initStateManager(manager, significantChannels)
+	manager.hs = initHtlcStates(manager.sm, manager.store)
+	manager.activity = initChannelActivity(manager.sm, manager.InactiveGracePeriod)
+	manager.opens = initOpenTracker(manager, manager.FundingConfirmations)
+	manager.closes = initCloseTracker(manager, manager.LockedFundsInterval)
+	manager.brokenSubscriptions = map[string]bool{}
 
+	manager.subscribe(ctx)
+	manager.prepareBalanceCheck(ctx)
+
+	var reconcile <-chan time.Time
+
+	if manager.Interval > 0 {
+		ticker := time.NewTicker(time.Duration(manager.Interval) * time.Second)
+		defer ticker.Stop()
+
+		reconcile = ticker.C
+	}
+
+	checks := time.NewTicker(checkInterval)
+	defer checks.Stop()
+
+	manager.handleEvents(ctx, reconcile, checks.C)
+}
+
+func (manager *ChannelManager) subscribe(ctx context.Context) {
 	logger.Info("Subscribing to channel events")
 
-	errChan := make(chan error)
-	eventsChan := make(chan *lnrpc.ChannelEventUpdate)
+	channelEvents := make(chan *lnrpc.ChannelEventUpdate)
+	channelEventsErrChan := make(chan error)
+	channelEventsRestored := make(chan struct{})
+
+	manager.lnd.SubscribeChannelEvents(ctx, channelEvents, channelEventsErrChan, channelEventsRestored)
+
+	logger.Info("Subscribing to HTLC events")
+
+	htlcEvents := make(chan *routerrpc.HtlcEvent)
+	htlcErrChan := make(chan error)
+	htlcRestored := make(chan struct{})
 
-	manager.lnd.SubscribeChannelEvents(eventsChan, errChan)
+	manager.lnd.SubscribeHtlcEvents(ctx, htlcEvents, htlcErrChan, htlcRestored)
 
-	manager.subscribeHtlcEvents()
-	manager.prepareBalanceCheck()
+	logger.Info("Subscribing to invoices")
 
-	openedChannels := make(chan *lnrpc.Channel)
-	closedChannels := make(chan *lnrpc.ChannelCloseSummary)
+	invoices := make(chan *lnrpc.Invoice)
+	invoicesErrChan := make(chan error)
+	invoicesRestored := make(chan struct{})
 
-	go manager.handleHtlcEvents(openedChannels, closedChannels)
+	manager.lnd.SubscribeInvoices(ctx, invoices, invoicesErrChan, invoicesRestored)
 
+	manager.subs = &subscriptionChannels{
+		channelEvents:         channelEvents,
+		channelEventsErrChan:  channelEventsErrChan,
+		channelEventsRestored: channelEventsRestored,
+
+		htlcEvents:   htlcEvents,
+		htlcErrChan:  htlcErrChan,
+		htlcRestored: htlcRestored,
+
+		invoices:         invoices,
+		invoicesErrChan:  invoicesErrChan,
+		invoicesRestored: invoicesRestored,
+	}
+}
+
+func (manager *ChannelManager) handleEvents(ctx context.Context, reconcile <-chan time.Time, checks <-chan time.Time) {
 	for {
 		select {
-		case event := <-eventsChan:
+		case <-ctx.Done():
+			logger.Info("Stopping notification bot")
+			manager.hs.persist()
+			return
+
+		case event := <-manager.subs.channelEvents:
 			switch event.Type {
 			case lnrpc.ChannelEventUpdate_OPEN_CHANNEL:
-				openedChannels <- event.GetOpenChannel()
+				manager.handleOpen(ctx, event.GetOpenChannel())
 
 			case lnrpc.ChannelEventUpdate_CLOSED_CHANNEL:
-				closedChannels <- event.GetClosedChannel()
+				manager.sm.handleClose(ctx, event.GetClosedChannel())
+				manager.activity.forgetChannel(event.GetClosedChannel().ChannelPoint)
+				manager.closes.handleClose(event.GetClosedChannel())
+
+			case lnrpc.ChannelEventUpdate_ACTIVE_CHANNEL:
+				manager.activity.handleActive(ctx, event.GetActiveChannel())
+
+			case lnrpc.ChannelEventUpdate_INACTIVE_CHANNEL:
+				manager.activity.handleInactive(ctx, event.GetInactiveChannel())
+
+			case lnrpc.ChannelEventUpdate_PENDING_OPEN_CHANNEL:
+				manager.opens.handlePendingOpen(ctx, event.GetPendingOpenChannel())
+
+			case lnrpc.ChannelEventUpdate_FULLY_RESOLVED_CHANNEL:
+				if !manager.closes.handleFullyResolved(ctx, event.GetFullyResolvedChannel()) {
+					manager.logFullyResolvedChannel(ctx, event.GetFullyResolvedChannel())
+				}
+			}
+			break
+
+		case event := <-manager.subs.htlcEvents:
+			if event.EventType == routerrpc.HtlcEvent_SEND || event.EventType == routerrpc.HtlcEvent_FORWARD {
+				manager.hs.handleEvent(ctx, event)
+			}
+			break
+
+		case invoice := <-manager.subs.invoices:
+			if invoice.State != lnrpc.Invoice_SETTLED {
+				break
 			}
 
+			manager.sm.handleSettledInvoice(ctx, invoice)
+			break
+
+		case <-reconcile:
+			manager.reconcile(ctx)
+			break
+
+		case <-checks:
+			manager.activity.checkInactive(ctx)
+			manager.pollPendingChannels(ctx)
+			break
+
+		case err := <-manager.subs.channelEventsErrChan:
+			manager.handleSubscriptionError(channelEventsSubscription, err)
+			break
+
+		case err := <-manager.subs.htlcErrChan:
+			manager.handleSubscriptionError(htlcEventsSubscription, err)
+			break
+
+		case err := <-manager.subs.invoicesErrChan:
+			manager.handleSubscriptionError(invoicesSubscription, err)
+			break
+
+		case <-manager.subs.channelEventsRestored:
+			manager.handleSubscriptionRestored(ctx, channelEventsSubscription)
+			break
+
+		case <-manager.subs.htlcRestored:
+			manager.handleSubscriptionRestored(ctx, htlcEventsSubscription)
 			break
 
-		case err := <-errChan:
-			logger.Fatal("LND channel event subscription errored: " + err.Error())
+		case <-manager.subs.invoicesRestored:
+			manager.handleSubscriptionRestored(ctx, invoicesSubscription)
 			break
 		}
 	}
@@ -1,8 +1,14 @@
 package notifications
 
 import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/BoltzExchange/channel-bot/notifications/templates"
+	"github.com/BoltzExchange/channel-bot/utils"
+	"github.com/google/logger"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"time"
 )
 
 type MockWriter struct{}
@@ -17,6 +23,7 @@ func (m *MockWriter) Write(p []byte) (n int, err error) {
 type MockDiscordClient struct{}
 
 var sentMessages []string
+var sentEvents []*providers.Event
 
 func (m MockDiscordClient) Name() string {
 	return "Mocked Discord"
@@ -26,13 +33,68 @@ func (m MockDiscordClient) Init() error {
 	return nil
 }
 
+func (m MockDiscordClient) Close() error {
+	return nil
+}
+
+func (m MockDiscordClient) SendEvent(event *providers.Event) error {
+	sentEvents = append(sentEvents, event)
+	return m.SendMessage(event.Message)
+}
+
 func (m MockDiscordClient) SendMessage(message string) error {
 	sentMessages = append(sentMessages, message)
 	return nil
 }
 
+// mockProvider renders events with the default templates like the bot does
+func mockProvider() providers.NotificationProvider {
+	return templates.NewRenderer(&MockDiscordClient{}, templates.Default())
+}
+
+// newTestManager initializes the manager like Init does, but with the mocked LND client and notification provider
+// and a frozen clock. Options like the hysteresis or the grace period have to be set on the manager that is passed.
+// The tracked channels are known to the state manager without being checked
+func newTestManager(
+	manager *ChannelManager,
+	significantChannels []*SignificantChannel,
+	tracked ...*lnrpc.Channel,
+) *ChannelManager {
+	logger.Init("", false, false, &MockWriter{})
+
+	if manager.lnd == nil {
+		manager.lnd = &MockLndClient{}
+	}
+
+	manager.notificationProvider = mockProvider()
+	manager.nc = initNodeCache(manager.lnd, &utils.Clock{}, manager.store)
+
+	if err := manager.ParseSignificantChannels(significantChannels); err != nil {
+		panic(err)
+	}
+
+	if err := manager.ParseSignificantPeers(); err != nil {
+		panic(err)
+	}
+
+	manager.sm = initStateManager(manager, significantChannels)
+	manager.sm.clock.MockTime = time.Now()
+	manager.hs = initHtlcStates(manager.sm, manager.store)
+	manager.activity = initChannelActivity(manager.sm, manager.InactiveGracePeriod)
+	manager.opens = initOpenTracker(manager, manager.FundingConfirmations)
+	manager.closes = initCloseTracker(manager, manager.LockedFundsInterval)
+	manager.brokenSubscriptions = map[string]bool{}
+
+	for _, channel := range tracked {
+		manager.sm.channels[channel.ChanId] = channel
+	}
+
+	return manager
+}
+
 func cleanUp() {
 	sentMessages = sentMessages[:0]
+	sentEvents = sentEvents[:0]
 	loggedMessages = loggedMessages[:0]
 }
 
@@ -40,17 +102,23 @@ type MockLndClient struct {
 	nodeAlias string
 }
 
+// nodeLnd resolves the alias of every node to "node"
+var nodeLnd = &MockLndClient{nodeAlias: "node"}
+
 const blockHeight uint32 = 534
 
-func (m MockLndClient) GetInfo() (*lnrpc.GetInfoResponse, error) {
+var bestHeaderTimestamp int64
+
+func (m MockLndClient) GetInfo(context.Context) (*lnrpc.GetInfoResponse, error) {
 	return &lnrpc.GetInfoResponse{
-		BlockHeight: blockHeight,
+		BlockHeight:         blockHeight,
+		BestHeaderTimestamp: bestHeaderTimestamp,
 	}, nil
 }
 
 var channels []*lnrpc.Channel
 
-func (m MockLndClient) ListChannels() (*lnrpc.ListChannelsResponse, error) {
+func (m MockLndClient) ListChannels(context.Context) (*lnrpc.ListChannelsResponse, error) {
 	return &lnrpc.ListChannelsResponse{
 		Channels: channels,
 	}, nil
@@ -58,13 +126,60 @@ func (m MockLndClient) ListChannels() (*lnrpc.ListChannelsResponse, error) {
 
 var closedChannels []*lnrpc.ChannelCloseSummary
 
-func (m MockLndClient) ClosedChannels() (*lnrpc.ClosedChannelsResponse, error) {
+func (m MockLndClient) ClosedChannels(context.Context) (*lnrpc.ClosedChannelsResponse, error) {
 	return &lnrpc.ClosedChannelsResponse{
 		Channels: closedChannels,
 	}, nil
 }
 
-func (m MockLndClient) GetNodeInfo(string) (*lnrpc.NodeInfo, error) {
+var pendingOpenChannels []*lnrpc.PendingChannelsResponse_PendingOpenChannel
+var waitingCloseChannels []*lnrpc.PendingChannelsResponse_WaitingCloseChannel
+var forceClosingChannels []*lnrpc.PendingChannelsResponse_ForceClosedChannel
+
+func (m MockLndClient) PendingChannels(context.Context) (*lnrpc.PendingChannelsResponse, error) {
+	return &lnrpc.PendingChannelsResponse{
+		PendingOpenChannels:         pendingOpenChannels,
+		WaitingCloseChannels:        waitingCloseChannels,
+		PendingForceClosingChannels: forceClosingChannels,
+	}, nil
+}
+
+var forwardingEvents []*lnrpc.ForwardingEvent
+var forwardingStartTimes []uint64
+
+// ForwardingHistory returns the events since the start time in pages of two
+func (m MockLndClient) ForwardingHistory(
+	_ context.Context,
+	startTime uint64,
+	indexOffset uint32,
+) (*lnrpc.ForwardingHistoryResponse, error) {
+	forwardingStartTimes = append(forwardingStartTimes, startTime)
+
+	var events []*lnrpc.ForwardingEvent
+
+	for _, event := range forwardingEvents {
+		if event.Timestamp >= startTime {
+			events = append(events, event)
+		}
+	}
+
+	end := min(int(indexOffset)+2, len(events))
+
+	return &lnrpc.ForwardingHistoryResponse{
+		ForwardingEvents: events[min(int(indexOffset), end):end],
+		LastOffsetIndex:  uint32(end),
+	}, nil
+}
+
+var walletTransactions []*lnrpc.Transaction
+
+func (m MockLndClient) GetTransactions(context.Context, int32) (*lnrpc.TransactionDetails, error) {
+	return &lnrpc.TransactionDetails{
+		Transactions: walletTransactions,
+	}, nil
+}
+
+func (m MockLndClient) GetNodeInfo(context.Context, string) (*lnrpc.NodeInfo, error) {
 	return &lnrpc.NodeInfo{
 		Node: &lnrpc.LightningNode{
 			Alias: m.nodeAlias,
@@ -72,26 +187,38 @@ func (m MockLndClient) GetNodeInfo(string) (*lnrpc.NodeInfo, error) {
 	}, nil
 }
 
-func (m MockLndClient) GetChannelInfo(uint64) (*lnrpc.ChannelEdge, error) {
+func (m MockLndClient) GetChannelInfo(context.Context, uint64) (*lnrpc.ChannelEdge, error) {
+	panic("")
+}
+
+func (m MockLndClient) ListInactiveChannels(context.Context) (*lnrpc.ListChannelsResponse, error) {
+	panic("")
+}
+
+func (m MockLndClient) ForceCloseChannel(context.Context, string) (lnrpc.Lightning_CloseChannelClient, error) {
+	panic("")
+}
+
+func (m *MockLndClient) ListPeers(context.Context) (*lnrpc.ListPeersResponse, error) {
 	panic("")
 }
 
-func (m MockLndClient) ListInactiveChannels() (*lnrpc.ListChannelsResponse, error) {
+func (m *MockLndClient) ConnectPeer(context.Context, string, string) error {
 	panic("")
 }
 
-func (m MockLndClient) ForceCloseChannel(string) (lnrpc.Lightning_CloseChannelClient, error) {
+func (m *MockLndClient) CloseChannel(context.Context, string, uint64, int32) (lnrpc.Lightning_CloseChannelClient, error) {
 	panic("")
 }
 
-func (m MockLndClient) SubscribeInvoices(chan<- *lnrpc.Invoice, chan<- error) {
+func (m MockLndClient) SubscribeInvoices(context.Context, chan<- *lnrpc.Invoice, chan<- error, chan<- struct{}) {
 	panic("implement me")
 }
 
-func (m MockLndClient) SubscribeHtlcEvents(chan<- *routerrpc.HtlcEvent, chan<- error) {
+func (m MockLndClient) SubscribeHtlcEvents(context.Context, chan<- *routerrpc.HtlcEvent, chan<- error, chan<- struct{}) {
 	panic("implement me")
 }
 
-func (m MockLndClient) SubscribeChannelEvents(chan<- *lnrpc.ChannelEventUpdate, chan<- error) {
+func (m MockLndClient) SubscribeChannelEvents(context.Context, chan<- *lnrpc.ChannelEventUpdate, chan<- error, chan<- struct{}) {
 	panic("implement me")
 }
@@ -0,0 +1,336 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/lnd"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"strconv"
+	"strings"
+)
+
+const defaultFundingConfirmations = 3
+
+const confirmationUpdatesField = "Confirmation updates"
+
+// pendingOpen is a channel whose funding transaction was broadcast, but which is not usable yet
+type pendingOpen struct {
+	// Confirmations of the funding transaction that were notified last
+	confirmations int32
+
+	// Funding transactions of channels opened by the peer are not in the wallet of LND, which is why their
+	// confirmations cannot be tracked
+	remote bool
+}
+
+// openTracker polls the pending channels of LND to notify about the progress of the funding transactions
+type openTracker struct {
+	manager *ChannelManager
+
+	// LND does not expose how many confirmations a channel needs, which is why the configured number is shown
+	requiredConfirmations int32
+
+	// Pending opens keyed by their channel point
+	pending map[string]*pendingOpen
+}
+
+func initOpenTracker(manager *ChannelManager, requiredConfirmations int) *openTracker {
+	if requiredConfirmations <= 0 {
+		requiredConfirmations = defaultFundingConfirmations
+	}
+
+	return &openTracker{
+		manager:               manager,
+		requiredConfirmations: int32(requiredConfirmations),
+		pending:               map[string]*pendingOpen{},
+	}
+}
+
+// sync starts tracking the channels that are already pending open without notifying about them
+func (ot *openTracker) sync(ctx context.Context, pendingChannels *lnrpc.PendingChannelsResponse) {
+	if len(pendingChannels.PendingOpenChannels) == 0 {
+		return
+	}
+
+	confirmations := ot.fundingConfirmations(ctx)
+
+	for _, pending := range pendingChannels.PendingOpenChannels {
+		ot.pending[pending.Channel.ChannelPoint] = &pendingOpen{
+			confirmations: min(confirmations[fundingTxid(pending.Channel.ChannelPoint)], ot.requiredConfirmations),
+			remote:        isRemoteOpen(pending.Channel),
+		}
+	}
+}
+
+func (ot *openTracker) handlePendingOpen(ctx context.Context, update *lnrpc.PendingUpdate) {
+	channelPoint := lnd.FormatChannelPoint(&lnrpc.ChannelPoint{
+		FundingTxid: &lnrpc.ChannelPoint_FundingTxidBytes{
+			FundingTxidBytes: update.Txid,
+		},
+		OutputIndex: update.OutputIndex,
+	})
+
+	if ot.pending[channelPoint] != nil {
+		return
+	}
+
+	tracked := &pendingOpen{}
+	ot.pending[channelPoint] = tracked
+
+	var channel *lnrpc.PendingChannelsResponse_PendingChannel
+
+	pendingChannels, err := ot.manager.lnd.PendingChannels(ctx)
+
+	if err != nil {
+		logger.Warning("Could not get pending channels: " + err.Error())
+	} else {
+		for _, pending := range pendingChannels.PendingOpenChannels {
+			if pending.Channel.ChannelPoint == channelPoint {
+				channel = pending.Channel
+				break
+			}
+		}
+	}
+
+	tracked.remote = channel != nil && isRemoteOpen(channel)
+
+	ot.manager.logPendingOpenChannel(ctx, channelPoint, channel)
+}
+
+// update notifies about new confirmations of the funding transactions of the tracked pending opens
+func (ot *openTracker) update(ctx context.Context, pendingChannels *lnrpc.PendingChannelsResponse) {
+	if len(ot.pending) == 0 {
+		return
+	}
+
+	stillPending := map[string]*lnrpc.PendingChannelsResponse_PendingChannel{}
+
+	for _, pending := range pendingChannels.PendingOpenChannels {
+		stillPending[pending.Channel.ChannelPoint] = pending.Channel
+	}
+
+	var confirmations map[string]int32
+
+	for channelPoint, tracked := range ot.pending {
+		channel := stillPending[channelPoint]
+
+		// Channels that are usable are forgotten when they are opened
+		if channel == nil {
+			logger.Info("Channel " + channelPoint + " is not pending open anymore")
+			delete(ot.pending, channelPoint)
+			continue
+		}
+
+		if tracked.remote {
+			continue
+		}
+
+		if confirmations == nil {
+			confirmations = ot.fundingConfirmations(ctx)
+		}
+
+		// Funding transactions that are not in the wallet of LND were published by the peer
+		confirmed, isKnown := confirmations[fundingTxid(channelPoint)]
+		confirmed = min(confirmed, ot.requiredConfirmations)
+
+		if !isKnown || confirmed <= tracked.confirmations {
+			continue
+		}
+
+		tracked.confirmations = confirmed
+		ot.manager.logFundingConfirmations(ctx, channel, confirmed, ot.requiredConfirmations)
+	}
+}
+
+func (ot *openTracker) forgetChannel(channelPoint string) {
+	delete(ot.pending, channelPoint)
+}
+
+// fundingConfirmations returns the confirmations of the recent and unconfirmed transactions of the wallet keyed by their ID
+func (ot *openTracker) fundingConfirmations(ctx context.Context) map[string]int32 {
+	confirmations := map[string]int32{}
+
+	info, err := ot.manager.lnd.GetInfo(ctx)
+
+	if err != nil {
+		logger.Warning("Could not get info: " + err.Error())
+		return confirmations
+	}
+
+	transactions, err := ot.manager.lnd.GetTransactions(ctx, int32(info.BlockHeight)-ot.requiredConfirmations)
+
+	if err != nil {
+		logger.Warning("Could not get transactions: " + err.Error())
+		return confirmations
+	}
+
+	for _, transaction := range transactions.Transactions {
+		confirmations[transaction.TxHash] = transaction.NumConfirmations
+	}
+
+	return confirmations
+}
+
+func isRemoteOpen(channel *lnrpc.PendingChannelsResponse_PendingChannel) bool {
+	return channel.Initiator == lnrpc.Initiator_INITIATOR_REMOTE
+}
+
+func fundingTxid(channelPoint string) string {
+	return strings.Split(channelPoint, ":")[0]
+}
+
+// handleOpen notifies that the channel is usable before its balance is checked
+func (manager *ChannelManager) handleOpen(ctx context.Context, channel *lnrpc.Channel) {
+	manager.opens.forgetChannel(channel.ChannelPoint)
+	manager.logOpenedChannel(ctx, channel, false)
+
+	manager.sm.handleOpen(ctx, channel)
+}
+
+func (manager *ChannelManager) logPendingOpenChannel(
+	ctx context.Context,
+	channelPoint string,
+	channel *lnrpc.PendingChannelsResponse_PendingChannel,
+) {
+	if !manager.logInsignificant {
+		return
+	}
+
+	event := &providers.Event{
+		Type:     providers.EventPendingOpen,
+		Severity: providers.SeverityInfo,
+		Title:    "Funding transaction of channel " + channelPoint + " was broadcast",
+		Fields: []*providers.Field{
+			{Name: channelPointField, Value: channelPoint},
+		},
+	}
+
+	if channel != nil {
+		manager.addPendingChannel(ctx, event, channel)
+
+		if isRemoteOpen(channel) {
+			event.Fields = append(event.Fields, &providers.Field{
+				Name:  confirmationUpdatesField,
+				Value: "not sent, because the funding transaction of the peer is not in the wallet",
+			})
+		}
+	}
+
+	_ = manager.notificationProvider.SendEvent(event)
+}
+
+func (manager *ChannelManager) logFundingConfirmations(
+	ctx context.Context,
+	channel *lnrpc.PendingChannelsResponse_PendingChannel,
+	confirmations int32,
+	requiredConfirmations int32,
+) {
+	if !manager.logInsignificant {
+		return
+	}
+
+	event := &providers.Event{
+		Type:     providers.EventFundingConfirmation,
+		Severity: providers.SeverityInfo,
+		Fields: []*providers.Field{
+			{Name: channelPointField, Value: channel.ChannelPoint},
+			{
+				Name:  "Confirmations",
+				Value: strconv.Itoa(int(confirmations)) + "/" + strconv.Itoa(int(requiredConfirmations)),
+			},
+		},
+	}
+
+	manager.addPendingChannel(ctx, event, channel)
+
+	_ = manager.notificationProvider.SendEvent(event)
+}
+
+// addPendingChannel adds the peer and the balances of the pending channel to the event
+func (manager *ChannelManager) addPendingChannel(
+	ctx context.Context,
+	event *providers.Event,
+	channel *lnrpc.PendingChannelsResponse_PendingChannel,
+) {
+	nodeName := manager.nc.getNodeName(ctx, channel.RemoteNodePub)
+
+	if event.Type == providers.EventPendingOpen {
+		event.Title = "Funding transaction of channel to " + nodeName + " was broadcast"
+	} else {
+		event.Title = "Funding transaction of channel to " + nodeName + " was confirmed"
+	}
+
+	event.Peer = &providers.Peer{
+		Pubkey: channel.RemoteNodePub,
+		Alias:  nodeName,
+	}
+	event.Balances = &providers.Balances{
+		Local:    channel.LocalBalance,
+		Remote:   channel.RemoteBalance,
+		Capacity: channel.Capacity,
+	}
+	event.Fields = append(event.Fields,
+		&providers.Field{Name: "Initiator", Value: formatInitiator(channel.Initiator == lnrpc.Initiator_INITIATOR_LOCAL)},
+		&providers.Field{Name: "Visibility", Value: formatVisibility(channel.Private)},
+		&providers.Field{Name: "Commitment type", Value: formatEnum(channel.CommitmentType.String())},
+	)
+}
+
+func (manager *ChannelManager) logOpenedChannel(ctx context.Context, channel *lnrpc.Channel, catchUp bool) {
+	if !manager.logInsignificant {
+		return
+	}
+
+	nodeName := manager.nc.getNodeName(ctx, channel.RemotePubkey)
+	title := "Channel to " + nodeName + " was opened"
+
+	if catchUp {
+		title += " while the bot was offline"
+	} else {
+		title += " and is usable"
+	}
+
+	_ = manager.notificationProvider.SendEvent(&providers.Event{
+		Type:     providers.EventOpened,
+		Severity: providers.SeverityInfo,
+		Title:    title,
+		CatchUp:  catchUp,
+		Channel: &providers.Channel{
+			ID:      channel.ChanId,
+			Private: channel.Private,
+		},
+		Peer: &providers.Peer{
+			Pubkey: channel.RemotePubkey,
+			Alias:  nodeName,
+		},
+		Balances: channelBalances(channel),
+		Fields: []*providers.Field{
+			{Name: "Initiator", Value: formatInitiator(channel.Initiator)},
+			{Name: "Visibility", Value: formatVisibility(channel.Private)},
+			{Name: "Commitment type", Value: formatEnum(channel.CommitmentType.String())},
+			{Name: channelPointField, Value: channel.ChannelPoint},
+		},
+	})
+}
+
+func formatInitiator(isLocal bool) string {
+	if isLocal {
+		return initiatorLocal
+	}
+
+	return initiatorRemote
+}
+
+func formatVisibility(isPrivate bool) string {
+	if isPrivate {
+		return "private"
+	}
+
+	return "public"
+}
+
+// formatEnum formats the name of a value of an enum of LND, like "SIMPLE_TAPROOT", in lowercase with spaces
+func formatEnum(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", " "))
+}
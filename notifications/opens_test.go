@@ -0,0 +1,226 @@
+package notifications
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"testing"
+)
+
+const openTxid = "446b399af44adbcddf85205d52438356437469fa7d44b0402a03e403318dc0a3"
+
+func openPendingUpdate() *lnrpc.PendingUpdate {
+	txid, _ := hex.DecodeString(openTxid)
+
+	// The bytes of transaction IDs are in reverse order
+	slices.Reverse(txid)
+
+	return &lnrpc.PendingUpdate{Txid: txid}
+}
+
+func openPendingChannel() *lnrpc.PendingChannelsResponse_PendingOpenChannel {
+	return &lnrpc.PendingChannelsResponse_PendingOpenChannel{
+		Channel: &lnrpc.PendingChannelsResponse_PendingChannel{
+			RemoteNodePub:  "pubkey",
+			ChannelPoint:   activityChannelPoint,
+			Capacity:       1000000,
+			LocalBalance:   990000,
+			Initiator:      lnrpc.Initiator_INITIATOR_LOCAL,
+			CommitmentType: lnrpc.CommitmentType_ANCHORS,
+		},
+	}
+}
+
+func TestHandlePendingOpen(t *testing.T) {
+	cleanUp()
+
+	manager := newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil)
+	ctx := context.Background()
+
+	// The details are missing when the channel cannot be found
+	manager.opens.handlePendingOpen(ctx, openPendingUpdate())
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, providers.EventPendingOpen, sentEvents[0].Type)
+	assert.Equal(t, "Funding transaction of channel was broadcast:\n"+
+		"  Channel point: `"+activityChannelPoint+"`", sentMessages[0])
+
+	// Pending opens are only notified once
+	manager.opens.handlePendingOpen(ctx, openPendingUpdate())
+	assert.Len(t, sentEvents, 1)
+
+	cleanUp()
+
+	pendingOpenChannels = []*lnrpc.PendingChannelsResponse_PendingOpenChannel{openPendingChannel()}
+	manager = newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil)
+
+	manager.opens.handlePendingOpen(ctx, openPendingUpdate())
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, "Funding transaction of channel to node was broadcast", sentEvents[0].Title)
+	assert.Equal(t, &providers.Balances{Local: 990000, Capacity: 1000000}, sentEvents[0].Balances)
+	assert.Equal(t, "Funding transaction of channel to `node` was broadcast:\n"+
+		"  Capacity: 1,000,000 sats\n"+
+		"  Initiator: local\n"+
+		"  Visibility: public\n"+
+		"  Commitment type: anchors\n"+
+		"  Channel point: `"+activityChannelPoint+"`", sentMessages[0])
+
+	pendingOpenChannels = nil
+	cleanUp()
+}
+
+func TestPollPendingOpens(t *testing.T) {
+	cleanUp()
+
+	pendingOpenChannels = []*lnrpc.PendingChannelsResponse_PendingOpenChannel{openPendingChannel()}
+	walletTransactions = []*lnrpc.Transaction{{TxHash: openTxid}}
+
+	manager := newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil)
+	ctx := context.Background()
+
+	manager.opens.handlePendingOpen(ctx, openPendingUpdate())
+	cleanUp()
+
+	// Nothing is sent while the funding transaction is unconfirmed
+	manager.pollPendingChannels(ctx)
+	assert.Len(t, sentEvents, 0)
+
+	walletTransactions[0].NumConfirmations = 1
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, providers.EventFundingConfirmation, sentEvents[0].Type)
+	assert.Equal(t, "Funding transaction of channel to node was confirmed", sentEvents[0].Title)
+	assert.Equal(t, "Funding transaction of channel to `node` has **1/3** confirmations:\n"+
+		"  Capacity: 1,000,000 sats\n"+
+		"  Initiator: local\n"+
+		"  Visibility: public\n"+
+		"  Commitment type: anchors\n"+
+		"  Channel point: `"+activityChannelPoint+"`", sentMessages[0])
+
+	// Confirmations are only sent when they change and up to the required ones
+	manager.pollPendingChannels(ctx)
+	assert.Len(t, sentEvents, 1)
+
+	walletTransactions[0].NumConfirmations = 5
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 2)
+	assert.Equal(t, "3/3", sentEvents[1].Fields[1].Value)
+
+	walletTransactions[0].NumConfirmations = 6
+	manager.pollPendingChannels(ctx)
+	assert.Len(t, sentEvents, 2)
+
+	// Channels that are not pending anymore are forgotten
+	pendingOpenChannels = nil
+	manager.pollPendingChannels(ctx)
+
+	assert.Empty(t, manager.opens.pending)
+
+	walletTransactions = nil
+	cleanUp()
+}
+
+func TestRemotePendingOpen(t *testing.T) {
+	cleanUp()
+
+	remoteChannel := openPendingChannel()
+	remoteChannel.Channel.Initiator = lnrpc.Initiator_INITIATOR_REMOTE
+
+	pendingOpenChannels = []*lnrpc.PendingChannelsResponse_PendingOpenChannel{remoteChannel}
+	walletTransactions = []*lnrpc.Transaction{{TxHash: openTxid}}
+
+	manager := newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil)
+	ctx := context.Background()
+
+	manager.opens.handlePendingOpen(ctx, openPendingUpdate())
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, "Funding transaction of channel to `node` was broadcast:\n"+
+		"  Capacity: 1,000,000 sats\n"+
+		"  Initiator: remote\n"+
+		"  Visibility: public\n"+
+		"  Commitment type: anchors\n"+
+		"  Channel point: `"+activityChannelPoint+"`\n"+
+		"  Confirmation updates: not sent, because the funding transaction of the peer is not in the wallet",
+		sentMessages[0])
+
+	cleanUp()
+
+	// The confirmations of funding transactions of the peer are not tracked
+	walletTransactions[0].NumConfirmations = 1
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 0)
+	assert.True(t, manager.opens.pending[activityChannelPoint].remote)
+
+	pendingOpenChannels = nil
+	walletTransactions = nil
+	cleanUp()
+}
+
+func TestSyncPendingOpens(t *testing.T) {
+	cleanUp()
+
+	pendingOpenChannels = []*lnrpc.PendingChannelsResponse_PendingOpenChannel{openPendingChannel()}
+	walletTransactions = []*lnrpc.Transaction{{TxHash: openTxid, NumConfirmations: 2}}
+
+	manager := newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil)
+	ctx := context.Background()
+
+	// Channels that were pending before the start are not notified about again
+	manager.syncPendingChannels(ctx)
+	manager.opens.handlePendingOpen(ctx, openPendingUpdate())
+	manager.pollPendingChannels(ctx)
+
+	assert.Len(t, sentEvents, 0)
+	assert.Equal(t, int32(2), manager.opens.pending[activityChannelPoint].confirmations)
+
+	pendingOpenChannels = nil
+	walletTransactions = nil
+	cleanUp()
+}
+
+func TestHandleUsableOpen(t *testing.T) {
+	cleanUp()
+
+	pendingOpenChannels = []*lnrpc.PendingChannelsResponse_PendingOpenChannel{openPendingChannel()}
+
+	manager := newTestManager(&ChannelManager{logInsignificant: true, lnd: nodeLnd}, nil)
+	ctx := context.Background()
+
+	manager.opens.handlePendingOpen(ctx, openPendingUpdate())
+	cleanUp()
+
+	manager.handleOpen(ctx, &lnrpc.Channel{
+		ChanId:         2,
+		ChannelPoint:   activityChannelPoint,
+		RemotePubkey:   "pubkey",
+		Capacity:       1000000,
+		LocalBalance:   500000,
+		RemoteBalance:  500000,
+		Private:        true,
+		CommitmentType: lnrpc.CommitmentType_SIMPLE_TAPROOT,
+	})
+
+	assert.Empty(t, manager.opens.pending)
+	assert.NotNil(t, manager.sm.channels[2])
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, providers.EventOpened, sentEvents[0].Type)
+	assert.Equal(t, "Channel to node was opened and is usable", sentEvents[0].Title)
+	assert.Equal(t, "Channel `2` to `node` was opened and is usable:\n"+
+		"  Capacity: 1,000,000 sats\n"+
+		"  Initiator: remote\n"+
+		"  Visibility: private\n"+
+		"  Commitment type: simple taproot\n"+
+		"  Channel point: `"+activityChannelPoint+"`", sentMessages[0])
+
+	pendingOpenChannels = nil
+	cleanUp()
+}
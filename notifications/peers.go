@@ -0,0 +1,241 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"sort"
+)
+
+// SignificantPeer is like a significant channel, but all channels to the peer are checked combined
+type SignificantPeer struct {
+	Alias  string
+	Pubkey string
+
+	// Ratios of the summed local balance to the summed capacity. Ratios that are not set are not checked
+	MinRatio string
+	MaxRatio string
+
+	// Override the defaults of the manager for the peer
+	Hysteresis string
+	MinDwell   int
+
+	// Absolute limits in satoshis for the summed balances
+	MinLocal   int64
+	MaxLocal   int64
+	MinInbound int64
+
+	// Parsed from the thresholds above
+	ratios ratios
+}
+
+// ParseSignificantPeers parses the thresholds of the significant peers
+func (manager *ChannelManager) ParseSignificantPeers() (err error) {
+	for _, significant := range manager.SignificantPeers {
+		significant.ratios, err = manager.parseSignificantRatios(
+			significant.MinRatio,
+			significant.MaxRatio,
+			significant.Hysteresis,
+			significant.MinDwell,
+			ratios{
+				minLocal:   significant.MinLocal,
+				maxLocal:   significant.MaxLocal,
+				minInbound: significant.MinInbound,
+			},
+		)
+
+		if err != nil {
+			return errors.New(fmt.Sprint("invalid significant peer ", significant.Alias, ": ", err))
+		}
+	}
+
+	return nil
+}
+
+func (sm *stateManager) aggregatesPeer(pubkey string) bool {
+	return sm.manager.AggregatePeers || sm.significantPeers[pubkey] != nil
+}
+
+// peerChannels returns the channels to the peer that are checked combined sorted by their IDs
+func (sm *stateManager) peerChannels(pubkey string) []*lnrpc.Channel {
+	var channels []*lnrpc.Channel
+
+	for _, channel := range sm.channels {
+		if sm.significantChannel(channel) != nil {
+			continue
+		}
+
+		if channel.RemotePubkey == pubkey {
+			channels = append(channels, channel)
+		}
+	}
+
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].ChanId < channels[j].ChanId
+	})
+
+	return channels
+}
+
+// checkPeer checks the summed balances of all channels to the peer
+func (sm *stateManager) checkPeer(ctx context.Context, pubkey string) {
+	channels := sm.peerChannels(pubkey)
+
+	if len(channels) == 0 {
+		return
+	}
+
+	aggregate := aggregateChannels(pubkey, channels)
+	signi := sm.significantPeers[pubkey]
+
+	var rule *Rule
+	var checkRatio ratios
+
+	if signi != nil {
+		checkRatio = signi.ratios
+	} else {
+		rule = sm.matchRule(aggregate)
+
+		if rule == nil || !rule.notify {
+			return
+		}
+
+		checkRatio = rule.ratios
+	}
+
+	wasImbalanced := sm.imbalancedPeers[pubkey]
+	modeledChannels := make([]*lnrpc.Channel, len(channels))
+
+	for i, channel := range channels {
+		modeledChannels[i] = checkRatio.model.apply(channel)
+	}
+
+	unsettledTooLong := isUnsettledTooLong(sm.unsettledPeers, pubkey, aggregate, sm.clock.Now(), sm.unsettledTimeout)
+	isImbalanced, modeled := checkRatio.checkOutcomes(aggregateChannels(pubkey, modeledChannels), wasImbalanced, unsettledTooLong)
+
+	state := sm.peerStates[pubkey]
+
+	if state == nil {
+		state = &channelState{
+			Imbalanced: wasImbalanced,
+		}
+	}
+
+	notify, modified := sm.evaluateChange(state, wasImbalanced, isImbalanced, checkRatio.minDwell)
+
+	if !notify {
+		if modified {
+			sm.peerStates[pubkey] = state
+			sm.manager.store.savePeerState(pubkey, state)
+		}
+
+		return
+	}
+
+	if signi != nil || sm.manager.logInsignificant {
+		sm.manager.logPeerBalance(ctx, signi, checkRatio, rule, modeled, modeledChannels, isImbalanced, state.SuppressedFlips)
+	}
+
+	sm.setPeerImbalanced(aggregate, isImbalanced)
+}
+
+func (sm *stateManager) setPeerImbalanced(aggregate *lnrpc.Channel, isImbalanced bool) {
+	if isImbalanced {
+		sm.imbalancedPeers[aggregate.RemotePubkey] = true
+	} else {
+		delete(sm.imbalancedPeers, aggregate.RemotePubkey)
+	}
+
+	state := &channelState{
+		Imbalanced:    isImbalanced,
+		LocalBalance:  aggregate.LocalBalance,
+		RemoteBalance: aggregate.RemoteBalance,
+		NotifiedAt:    sm.clock.Now(),
+	}
+
+	sm.peerStates[aggregate.RemotePubkey] = state
+	sm.manager.store.savePeerState(aggregate.RemotePubkey, state)
+}
+
+func (sm *stateManager) forgetPeer(pubkey string) {
+	delete(sm.imbalancedPeers, pubkey)
+	delete(sm.peerStates, pubkey)
+	delete(sm.unsettledPeers, pubkey)
+
+	sm.manager.store.deletePeerState(pubkey)
+}
+
+func (manager *ChannelManager) logPeerBalance(
+	ctx context.Context,
+	signi *SignificantPeer,
+	checkRatio ratios,
+	rule *Rule,
+	aggregate *lnrpc.Channel,
+	channels []*lnrpc.Channel,
+	isImbalanced bool,
+	suppressedFlips int,
+) {
+	nodeName := manager.nc.getNodeName(ctx, aggregate.RemotePubkey)
+	severity := balanceSeverity(isImbalanced)
+
+	var fields []*providers.Field
+
+	if signi != nil {
+		nodeName = signi.Alias
+	} else {
+		if isImbalanced {
+			severity = rule.severity
+		}
+
+		if rule.Name != defaultRuleName {
+			fields = append(fields, &providers.Field{Name: "Rule", Value: rule.Name})
+		}
+	}
+
+	breakdown := make([]*providers.ChannelBalance, len(channels))
+
+	for i, channel := range channels {
+		breakdown[i] = &providers.ChannelBalance{
+			ID:       channel.ChanId,
+			Balances: *channelBalances(channel),
+		}
+	}
+
+	_ = manager.notificationProvider.SendEvent(&providers.Event{
+		Type:     balanceEventType(isImbalanced),
+		Severity: severity,
+		Title:    "Peer " + nodeName + " is " + balanceInfo(isImbalanced),
+		Peer: &providers.Peer{
+			Pubkey: aggregate.RemotePubkey,
+			Alias:  nodeName,
+		},
+		Balances:   channelBalances(aggregate),
+		Thresholds: checkRatio.thresholds(aggregate.Capacity),
+		Breakdown:  breakdown,
+		Fields:     append(fields, balanceFields(checkRatio, aggregate, isImbalanced, suppressedFlips)...),
+	})
+}
+
+// aggregateChannels sums the balances of the channels into one channel
+func aggregateChannels(pubkey string, channels []*lnrpc.Channel) *lnrpc.Channel {
+	aggregate := &lnrpc.Channel{
+		RemotePubkey: pubkey,
+		Private:      true,
+	}
+
+	for _, channel := range channels {
+		aggregate.Capacity += channel.Capacity
+		aggregate.LocalBalance += channel.LocalBalance
+		aggregate.RemoteBalance += channel.RemoteBalance
+		aggregate.UnsettledBalance += channel.UnsettledBalance
+		aggregate.PendingHtlcs = append(aggregate.PendingHtlcs, channel.PendingHtlcs...)
+
+		// The peer is considered public if any of its channels is
+		aggregate.Private = aggregate.Private && channel.Private
+		aggregate.Initiator = aggregate.Initiator || channel.Initiator
+	}
+
+	return aggregate
+}
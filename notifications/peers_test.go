@@ -0,0 +1,185 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func peerChannel(chanId uint64, pubkey string, localBalance int64) *lnrpc.Channel {
+	return &lnrpc.Channel{
+		ChanId:        chanId,
+		RemotePubkey:  pubkey,
+		LocalBalance:  localBalance,
+		RemoteBalance: 100 - localBalance,
+		Capacity:      100,
+	}
+}
+
+func TestAggregateChannels(t *testing.T) {
+	aggregate := aggregateChannels("pubkey", []*lnrpc.Channel{
+		{
+			Capacity:      100,
+			LocalBalance:  10,
+			RemoteBalance: 90,
+			Private:       true,
+		},
+		{
+			Capacity:         200,
+			LocalBalance:     150,
+			RemoteBalance:    40,
+			UnsettledBalance: 10,
+			Initiator:        true,
+		},
+	})
+
+	assert.Equal(t, &lnrpc.Channel{
+		RemotePubkey:     "pubkey",
+		Capacity:         300,
+		LocalBalance:     160,
+		RemoteBalance:    130,
+		UnsettledBalance: 10,
+		Initiator:        true,
+	}, aggregate)
+}
+
+func TestCheckPeer(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	sm := newTestManager(&ChannelManager{AggregatePeers: true, logInsignificant: true}, nil).sm
+
+	// One of the channels is imbalanced, but the combined balance is fine
+	sm.refreshChannels(context.Background(), &lnrpc.ListChannelsResponse{
+		Channels: []*lnrpc.Channel{
+			peerChannel(1, "pubkey", 10),
+			peerChannel(2, "pubkey", 70),
+		},
+	})
+
+	assert.Len(t, sentEvents, 0)
+	assert.False(t, sm.imbalancedChannels[1])
+
+	sm.handleOpen(context.Background(), peerChannel(3, "pubkey", 0))
+
+	assert.Len(t, sentEvents, 1)
+	assert.True(t, sm.imbalancedPeers["pubkey"])
+
+	assert.Equal(t, providers.EventImbalanced, sentEvents[0].Type)
+	assert.Equal(t, "Peer pubkey is imbalanced", sentEvents[0].Title)
+	assert.Nil(t, sentEvents[0].Channel)
+	assert.Equal(t, &providers.Balances{Local: 80, Remote: 220, Capacity: 300}, sentEvents[0].Balances)
+	assert.Equal(t, &providers.Thresholds{Min: 90, Max: 210}, sentEvents[0].Thresholds)
+	assert.Len(t, sentEvents[0].Breakdown, 3)
+	assert.Equal(t, ":rotating_light: Peer **pubkey** is **imbalanced** :rotating_light: :\n"+
+		"  Local: 80\n"+
+		"    Minimal: 90\n"+
+		"    Maximal: 210\n"+
+		"  Remote: 220\n"+
+		"  Channel `1`: 10 local, 90 remote\n"+
+		"  Channel `2`: 70 local, 30 remote\n"+
+		"  Channel `3`: 0 local, 100 remote\n"+
+		"  Breached limit: Minimal ratio of 0.3", sentMessages[0])
+
+	cleanUp()
+
+	// Closing the channel that made the peer imbalanced makes it balanced again
+	sm.handleClose(context.Background(), &lnrpc.ChannelCloseSummary{
+		ChanId:       3,
+		RemotePubkey: "pubkey",
+		CloseType:    lnrpc.ChannelCloseSummary_COOPERATIVE_CLOSE,
+	})
+
+	assert.Len(t, sentEvents, 2)
+	assert.Equal(t, providers.EventBalanced, sentEvents[1].Type)
+	assert.False(t, sm.imbalancedPeers["pubkey"])
+
+	cleanUp()
+
+	// The state of peers without channels is dropped
+	sm.refreshChannels(context.Background(), &lnrpc.ListChannelsResponse{})
+
+	assert.Len(t, sm.peerStates, 0)
+
+	cleanUp()
+}
+
+func TestParseSignificantPeers(t *testing.T) {
+	manager := &ChannelManager{
+		SignificantPeers: []*SignificantPeer{
+			{Alias: "Boltz", Pubkey: "boltz", MinRatio: "0.1", MaxRatio: "0.9"},
+		},
+	}
+
+	assert.Nil(t, manager.ParseSignificantPeers())
+	assert.Equal(t, 0.1, manager.SignificantPeers[0].ratios.min)
+	assert.Equal(t, 0.9, manager.SignificantPeers[0].ratios.max)
+
+	invalid := map[string]*SignificantPeer{
+		"invalid significant peer min: min ratio is not a number": {
+			Alias:    "min",
+			MinRatio: "0,1",
+		},
+		"invalid significant peer hysteresis: hysteresis is not a number": {
+			Alias:      "hysteresis",
+			Hysteresis: "five",
+		},
+		"invalid significant peer limits: min local balance has to be less than max local balance": {
+			Alias:    "limits",
+			MinLocal: 2,
+			MaxLocal: 1,
+		},
+	}
+
+	for expected, significant := range invalid {
+		manager := &ChannelManager{SignificantPeers: []*SignificantPeer{significant}}
+		assert.EqualError(t, manager.ParseSignificantPeers(), expected)
+	}
+}
+
+func TestCheckSignificantPeer(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	sm := newTestManager(&ChannelManager{
+		SignificantPeers: []*SignificantPeer{
+			{
+				Alias:    "Boltz",
+				Pubkey:   "boltz",
+				MinRatio: "0.1",
+				MaxRatio: "0.9",
+			},
+		},
+		logInsignificant: true,
+	}, nil).sm
+
+	// Channels to other peers are still checked on their own
+	sm.handleOpen(context.Background(), peerChannel(1, "other", 10))
+
+	assert.Len(t, sentEvents, 1)
+	assert.True(t, sm.imbalancedChannels[1])
+
+	cleanUp()
+
+	sm.refreshChannels(context.Background(), &lnrpc.ListChannelsResponse{
+		Channels: []*lnrpc.Channel{
+			peerChannel(1, "other", 10),
+			peerChannel(2, "boltz", 5),
+			peerChannel(3, "boltz", 10),
+		},
+	})
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, "Peer Boltz is imbalanced", sentEvents[0].Title)
+	assert.Equal(t, providers.SeverityWarning, sentEvents[0].Severity)
+	assert.Equal(t, &providers.Thresholds{Min: 20, Max: 180}, sentEvents[0].Thresholds)
+
+	cleanUp()
+}
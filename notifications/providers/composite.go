@@ -0,0 +1,115 @@
+package providers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/google/logger"
+)
+
+// Route configures which types of events are sent to a provider.
+// All events are sent to the provider if no types are configured
+type Route struct {
+	Provider NotificationProvider
+	Events   []string
+}
+
+type route struct {
+	provider NotificationProvider
+	events   map[EventType]bool
+}
+
+// Composite sends notifications to every provider that could be initialized
+type Composite struct {
+	routes []*Route
+
+	active []*route
+}
+
+func NewComposite(routes []*Route) *Composite {
+	return &Composite{
+		routes: routes,
+	}
+}
+
+func (c *Composite) Name() string {
+	var names []string
+
+	for _, active := range c.active {
+		names = append(names, active.provider.Name())
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Init rejects invalid routes and initializes all providers.
+// Providers that cannot be initialized are skipped
+func (c *Composite) Init() error {
+	var parsed []*route
+
+	for _, r := range c.routes {
+		events, err := ParseEventTypes(r.Events)
+		if err != nil {
+			return errors.New("invalid events of " + r.Provider.Name() + ": " + err.Error())
+		}
+
+		parsed = append(parsed, &route{
+			provider: r.Provider,
+			events:   events,
+		})
+	}
+
+	for _, r := range parsed {
+		err := r.provider.Init()
+		if err != nil {
+			logger.Warningf("Could not init %s: %s\n", r.provider.Name(), err.Error())
+			continue
+		}
+
+		c.active = append(c.active, r)
+	}
+
+	if len(c.active) == 0 {
+		logger.Warning("No notification provider could be initialized")
+	}
+
+	return nil
+}
+
+func (c *Composite) SendMessage(message string) error {
+	var errs []error
+
+	for _, r := range c.active {
+		errs = append(errs, r.provider.SendMessage(message))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Composite) SendEvent(event *Event) error {
+	var errs []error
+
+	for _, r := range c.active {
+		if !r.accepts(event.Type) {
+			continue
+		}
+
+		errs = append(errs, r.provider.SendEvent(event))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Composite) Close() error {
+	var errs []error
+
+	for _, r := range c.active {
+		errs = append(errs, r.provider.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *route) accepts(eventType EventType) bool {
+	return len(r.events) == 0 || r.events[eventType]
+}
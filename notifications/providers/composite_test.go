@@ -0,0 +1,107 @@
+package providers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockWriter struct{}
+
+func (m *MockWriter) Write([]byte) (n int, err error) {
+	return 0, nil
+}
+
+type mockProvider struct {
+	name    string
+	initErr error
+
+	closed   bool
+	messages []string
+}
+
+func (m *mockProvider) Name() string {
+	return m.name
+}
+
+func (m *mockProvider) Init() error {
+	return m.initErr
+}
+
+func (m *mockProvider) SendMessage(message string) error {
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+func (m *mockProvider) SendEvent(event *Event) error {
+	return m.SendMessage(event.Message)
+}
+
+func (m *mockProvider) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestCompositeInit(t *testing.T) {
+	logger.Init("", false, false, &MockWriter{})
+
+	working := &mockProvider{name: "Working"}
+	failing := &mockProvider{name: "Failing", initErr: errors.New("no token configured")}
+
+	composite := NewComposite([]*Route{
+		{Provider: failing},
+		{Provider: working},
+	})
+
+	assert.Nil(t, composite.Init())
+	assert.Len(t, composite.active, 1)
+	assert.Equal(t, working.name, composite.Name())
+
+	invalid := NewComposite([]*Route{
+		{Provider: working, Events: []string{"not_an_event"}},
+	})
+
+	assert.Equal(t, "invalid events of Working: unknown event type: not_an_event", invalid.Init().Error())
+}
+
+func TestCompositeRouting(t *testing.T) {
+	logger.Init("", false, false, &MockWriter{})
+
+	everything := &mockProvider{name: "Everything"}
+	closes := &mockProvider{name: "Closes"}
+
+	composite := NewComposite([]*Route{
+		{Provider: everything},
+		{Provider: closes, Events: []string{"force_closed", " Closed "}},
+	})
+	assert.Nil(t, composite.Init())
+
+	assert.Nil(t, composite.SendEvent(&Event{Type: EventImbalanced, Message: "imbalanced"}))
+	assert.Nil(t, composite.SendEvent(&Event{Type: EventForceClosed, Message: "force closed"}))
+	assert.Nil(t, composite.SendEvent(&Event{Type: EventClosed, Message: "closed"}))
+
+	assert.Equal(t, []string{"imbalanced", "force closed", "closed"}, everything.messages)
+	assert.Equal(t, []string{"force closed", "closed"}, closes.messages)
+
+	// Untyped messages should be sent to every provider
+	assert.Nil(t, composite.SendMessage("message"))
+
+	assert.Equal(t, "message", everything.messages[3])
+	assert.Equal(t, "message", closes.messages[2])
+
+	assert.Nil(t, composite.Close())
+	assert.True(t, everything.closed)
+	assert.True(t, closes.closed)
+}
+
+func TestParseEventTypes(t *testing.T) {
+	types, err := ParseEventTypes([]string{"imbalanced", "BALANCED"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[EventType]bool{EventImbalanced: true, EventBalanced: true}, types)
+
+	_, err = ParseEventTypes([]string{"imbalanced", "unknown"})
+	assert.NotNil(t, err)
+}
@@ -14,6 +14,10 @@ type Discord struct {
 	Channel string `long:"discord.channel" description:"Name of the channel to which messages should be sent"`
 	Prefix  string `long:"discord.prefix" description:"Prefix for every message"`
 
+	RateLimit int `long:"discord.ratelimit" description:"Maximal number of messages sent to Discord per minute"`
+
+	Events []string `long:"discord.events" description:"Types of events that should be sent to Discord. All events are sent if none are configured"`
+
 	api       *discordgo.Session
 	channelID string
 }
@@ -77,6 +81,43 @@ func (d *Discord) Init() (err error) {
 	return nil
 }
 
+func (d *Discord) Close() error {
+	if d.api == nil {
+		return nil
+	}
+
+	return d.api.Close()
+}
+
+// SendEvent sends structured events as embed that is colored according to the severity of the event
+func (d *Discord) SendEvent(event *providers.Event) error {
+	if !event.IsStructured() {
+		return d.SendMessage(event.Message)
+	}
+
+	if d.api == nil {
+		return nil
+	}
+
+	_, err := d.api.ChannelMessageSendEmbed(d.channelID, d.buildEmbed(event))
+
+	if err != nil {
+		logger.Warning("Could not send event " + event.Title + " to Discord: " + fmt.Sprint(err))
+	}
+
+	return checkError(err)
+}
+
+// buildEmbed uses the rendered message of the event as description, which can be changed with templates.
+// The fields of the event are not added, because the message already shows them
+func (d *Discord) buildEmbed(event *providers.Event) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       providers.AddPrefix(d.Prefix, event.Title),
+		Description: event.Message,
+		Color:       providers.SeverityColor(event.Severity),
+	}
+}
+
 func (d *Discord) SendMessage(message string) error {
 	if d.api == nil {
 		return nil
@@ -88,5 +129,16 @@ func (d *Discord) SendMessage(message string) error {
 		logger.Warning("Could not send " + message + " to Discord: " + fmt.Sprint(err))
 	}
 
+	return checkError(err)
+}
+
+// checkError marks messages that were rejected by Discord as permanent failures
+func checkError(err error) error {
+	var restErr *discordgo.RESTError
+
+	if errors.As(err, &restErr) && restErr.Response != nil {
+		return providers.CheckStatusCode(restErr.Response.StatusCode, err)
+	}
+
 	return err
 }
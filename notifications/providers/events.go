@@ -0,0 +1,150 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+)
+
+type EventType string
+
+const (
+	EventStarted             EventType = "started"
+	EventStopped             EventType = "stopped"
+	EventConnectionLost      EventType = "connection_lost"
+	EventConnectionRestored  EventType = "connection_restored"
+	EventImbalanced          EventType = "imbalanced"
+	EventBalanced            EventType = "balanced"
+	EventSignificantNotFound EventType = "significant_not_found"
+	EventPendingOpen         EventType = "pending_open"
+	EventFundingConfirmation EventType = "funding_confirmation"
+	EventOpened              EventType = "opened"
+	EventClosed              EventType = "closed"
+	EventForceClosed         EventType = "force_closed"
+	EventCloseMilestone      EventType = "close_milestone"
+	EventFullyResolved       EventType = "fully_resolved"
+	EventLockedFunds         EventType = "locked_funds"
+	EventInactive            EventType = "inactive"
+	EventActive              EventType = "active"
+	EventZombieClose         EventType = "zombie_close"
+	EventZombieCloseUpdate   EventType = "zombie_close_update"
+	EventZombieReconnect     EventType = "zombie_reconnect"
+	EventCondition           EventType = "condition"
+)
+
+var EventTypes = []EventType{
+	EventStarted,
+	EventStopped,
+	EventConnectionLost,
+	EventConnectionRestored,
+	EventImbalanced,
+	EventBalanced,
+	EventSignificantNotFound,
+	EventPendingOpen,
+	EventFundingConfirmation,
+	EventOpened,
+	EventClosed,
+	EventForceClosed,
+	EventCloseMilestone,
+	EventFullyResolved,
+	EventLockedFunds,
+	EventInactive,
+	EventActive,
+	EventZombieClose,
+	EventZombieCloseUpdate,
+	EventZombieReconnect,
+	EventCondition,
+}
+
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Event is a notification with structured data that providers can render natively.
+// Message is the rendering as plain message and used by providers that cannot render events
+type Event struct {
+	Type     EventType `json:"type"`
+	Severity Severity  `json:"severity"`
+	Title    string    `json:"title"`
+	Message  string    `json:"message"`
+
+	// Whether the event happened while the bot was offline and is only reported now
+	CatchUp bool `json:"catchUp,omitempty"`
+
+	Channel    *Channel    `json:"channel,omitempty"`
+	Peer       *Peer       `json:"peer,omitempty"`
+	Balances   *Balances   `json:"balances,omitempty"`
+	Thresholds *Thresholds `json:"thresholds,omitempty"`
+
+	// Balances of the single channels of events about all channels to a peer
+	Breakdown []*ChannelBalance `json:"breakdown,omitempty"`
+
+	// Additional information that does not fit into the other fields
+	Fields []*Field `json:"fields,omitempty"`
+}
+
+type Channel struct {
+	ID uint64 `json:"id"`
+
+	// Alias of significant channels
+	Alias   string `json:"alias,omitempty"`
+	Private bool   `json:"private"`
+}
+
+type Peer struct {
+	Pubkey string `json:"pubkey"`
+	Alias  string `json:"alias,omitempty"`
+}
+
+// Balances in satoshis
+type Balances struct {
+	Local    int64 `json:"local"`
+	Remote   int64 `json:"remote"`
+	Capacity int64 `json:"capacity"`
+}
+
+type ChannelBalance struct {
+	ID uint64 `json:"id"`
+	Balances
+}
+
+// Thresholds of the local balance in satoshis
+type Thresholds struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ParseEventTypes validates the configured names of event types
+func ParseEventTypes(names []string) (map[EventType]bool, error) {
+	types := map[EventType]bool{}
+
+	for _, name := range names {
+		eventType := EventType(strings.ToLower(strings.TrimSpace(name)))
+
+		if !isEventType(eventType) {
+			return nil, fmt.Errorf("unknown event type: %s", name)
+		}
+
+		types[eventType] = true
+	}
+
+	return types, nil
+}
+
+func isEventType(eventType EventType) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,64 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+)
+
+// File writes notifications as plain text to a file, which is useful for log aggregation
+type File struct {
+	Path string `long:"file.path" description:"Path to a file to which notifications should be written as plain text"`
+
+	Events []string `long:"file.events" description:"Types of events that should be written to the file. All events are written if none are configured"`
+
+	lock sync.Mutex
+	file *os.File
+}
+
+func (f *File) Name() string {
+	return "File"
+}
+
+func (f *File) Init() (err error) {
+	if f.Path == "" {
+		return errors.New("no path configured")
+	}
+
+	f.file, err = os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Initialized file notifications")
+	return nil
+}
+
+func (f *File) SendEvent(event *providers.Event) error {
+	return f.SendMessage(providers.RenderText(event))
+}
+
+func (f *File) SendMessage(message string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	_, err := f.file.WriteString(time.Now().Format(time.RFC3339) + " " + message + "\n")
+	return err
+}
+
+func (f *File) Close() error {
+	if f.file == nil {
+		return nil
+	}
+
+	return f.file.Close()
+}
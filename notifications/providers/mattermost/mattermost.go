@@ -15,6 +15,10 @@ type Mattermost struct {
 	Channel string `long:"mattermost.channel" description:"Name of the channel to which messages should be sent"`
 	Prefix  string `long:"mattermost.prefix" description:"Prefix for every message"`
 
+	RateLimit int `long:"mattermost.ratelimit" description:"Maximal number of messages sent to Mattermost per minute"`
+
+	Events []string `long:"mattermost.events" description:"Types of events that should be sent to Mattermost. All events are sent if none are configured"`
+
 	channelId string
 	client    *model.Client4
 }
@@ -56,12 +60,51 @@ func (m *Mattermost) Init() error {
 	return errors.New("could not find channel")
 }
 
+func (m *Mattermost) Close() error {
+	return nil
+}
+
+// SendEvent sends structured events as message attachment that is colored according to the severity of the event
+func (m *Mattermost) SendEvent(event *providers.Event) error {
+	if !event.IsStructured() {
+		return m.SendMessage(event.Message)
+	}
+
+	if m.channelId == "" || m.client == nil {
+		return nil
+	}
+
+	post := &model.Post{
+		ChannelId: m.channelId,
+	}
+	post.AddProp("attachments", []*model.SlackAttachment{m.buildAttachment(event)})
+
+	_, response, err := m.client.CreatePost(context.Background(), post)
+
+	if err != nil {
+		logger.Warning("Could not send event " + event.Title + " to Mattermost: " + fmt.Sprint(err))
+	}
+
+	return checkError(response, err)
+}
+
+// buildAttachment uses the rendered message of the event as text, which can be changed with templates.
+// The fields of the event are not added, because the message already shows them
+func (m *Mattermost) buildAttachment(event *providers.Event) *model.SlackAttachment {
+	return &model.SlackAttachment{
+		Fallback: providers.AddPrefix(m.Prefix, event.Message),
+		Color:    fmt.Sprintf("#%06x", providers.SeverityColor(event.Severity)),
+		Title:    providers.AddPrefix(m.Prefix, event.Title),
+		Text:     event.Message,
+	}
+}
+
 func (m *Mattermost) SendMessage(message string) error {
 	if m.channelId == "" || m.client == nil {
 		return nil
 	}
 
-	_, _, err := m.client.CreatePost(context.Background(), &model.Post{
+	_, response, err := m.client.CreatePost(context.Background(), &model.Post{
 		ChannelId: m.channelId,
 		Message:   providers.AddPrefix(m.Prefix, message),
 	})
@@ -70,5 +113,14 @@ func (m *Mattermost) SendMessage(message string) error {
 		logger.Warning("Could not send " + message + " to Mattermost: " + fmt.Sprint(err))
 	}
 
-	return err
+	return checkError(response, err)
+}
+
+// checkError marks posts that were rejected by Mattermost as permanent failures
+func checkError(response *model.Response, err error) error {
+	if response == nil {
+		return err
+	}
+
+	return providers.CheckStatusCode(response.StatusCode, err)
 }
@@ -0,0 +1,36 @@
+package mattermost
+
+import (
+	"testing"
+
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/BoltzExchange/channel-bot/notifications/templates"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildAttachmentTemplateOverride(t *testing.T) {
+	tmpls, err := templates.Parse(map[string]string{
+		"closed": "Goodbye {{alias .Peer}}",
+	})
+	assert.Nil(t, err)
+
+	event := &providers.Event{
+		Type:     providers.EventClosed,
+		Severity: providers.SeverityInfo,
+		Title:    "Channel to node was closed",
+		Peer:     &providers.Peer{Pubkey: "pubkey", Alias: "node"},
+		Fields:   []*providers.Field{{Name: "Close type", Value: "cooperative close"}},
+	}
+
+	event.Message, err = tmpls.Render(event)
+	assert.Nil(t, err)
+
+	attachment := (&Mattermost{}).buildAttachment(event)
+
+	assert.Equal(t, "Channel to node was closed", attachment.Title)
+	assert.Equal(t, "Goodbye node", attachment.Text)
+
+	// The fields are only shown when the template renders them
+	assert.Empty(t, attachment.Fields)
+	assert.Equal(t, "Goodbye node", attachment.Fallback)
+}
@@ -0,0 +1,361 @@
+package outbox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BoltzExchange/channel-bot/database"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+)
+
+const (
+	defaultDedupeWindow  = 60
+	defaultMaxRetryDelay = 300
+	defaultMaxAge        = 24
+	defaultDrainTimeout  = 10
+
+	defaultRateLimit = 30
+)
+
+var initialRetryDelay = time.Second
+
+type Config struct {
+	DedupeWindow  int `long:"outbox.dedupewindow" description:"Time in seconds in which identical notifications are sent only once"`
+	MaxRetryDelay int `long:"outbox.maxretrydelay" description:"Maximal time in seconds between attempts to send a notification"`
+	MaxAge        int `long:"outbox.maxage" description:"Time in hours after which notifications that could not be sent are dropped"`
+	DrainTimeout  int `long:"outbox.draintimeout" description:"Time in seconds for which queued notifications are sent on shutdown"`
+}
+
+type entry struct {
+	key []byte
+
+	Message string           `json:"message,omitempty"`
+	Event   *providers.Event `json:"event,omitempty"`
+
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Outbox persists notifications before they are sent to the provider. Notifications that could
+// not be sent are retried with exponential backoff, also after a restart of the bot
+type Outbox struct {
+	provider providers.NotificationProvider
+	db       *database.Database
+	bucket   string
+
+	dedupeWindow  time.Duration
+	maxRetryDelay time.Duration
+	maxAge        time.Duration
+	drainTimeout  time.Duration
+
+	// Minimal time between two notifications to respect the rate limit of the provider
+	interval time.Duration
+
+	lock   sync.Mutex
+	queue  []*entry
+	recent map[string]time.Time
+
+	wake    chan struct{}
+	closing chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// New wraps the provider in an outbox that sends at most rateLimit notifications per minute
+func New(provider providers.NotificationProvider, db *database.Database, config *Config, rateLimit int) *Outbox {
+	if rateLimit <= 0 {
+		rateLimit = defaultRateLimit
+	}
+
+	return &Outbox{
+		provider: provider,
+		db:       db,
+		bucket:   "outbox_" + strings.ToLower(provider.Name()),
+
+		dedupeWindow:  getOrDefault(config.DedupeWindow, defaultDedupeWindow, time.Second),
+		maxRetryDelay: getOrDefault(config.MaxRetryDelay, defaultMaxRetryDelay, time.Second),
+		maxAge:        getOrDefault(config.MaxAge, defaultMaxAge, time.Hour),
+		drainTimeout:  getOrDefault(config.DrainTimeout, defaultDrainTimeout, time.Second),
+
+		interval: time.Minute / time.Duration(rateLimit),
+
+		recent: map[string]time.Time{},
+
+		wake:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (o *Outbox) Name() string {
+	return o.provider.Name()
+}
+
+// Init initializes the provider and starts sending the notifications that were queued before the last shutdown
+func (o *Outbox) Init() error {
+	err := o.provider.Init()
+	if err != nil {
+		return err
+	}
+
+	err = o.db.ForEach(o.bucket, func(key []byte, value []byte) error {
+		e := &entry{
+			key: append([]byte{}, key...),
+		}
+
+		if err := json.Unmarshal(value, e); err != nil {
+			return err
+		}
+
+		o.queue = append(o.queue, e)
+		o.recent[e.fingerprint()] = e.CreatedAt
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if len(o.queue) != 0 {
+		logger.Infof("Loaded %d queued notifications for %s", len(o.queue), o.Name())
+	}
+
+	go o.run()
+
+	return nil
+}
+
+func (o *Outbox) SendMessage(message string) error {
+	return o.enqueue(&entry{
+		Message: message,
+	})
+}
+
+func (o *Outbox) SendEvent(event *providers.Event) error {
+	return o.enqueue(&entry{
+		Event: event,
+	})
+}
+
+// Close tries to send the queued notifications until the drain timeout and closes the provider afterwards.
+// Notifications that could not be sent stay queued for the next start
+func (o *Outbox) Close() error {
+	close(o.closing)
+
+	select {
+	case <-o.done:
+		break
+
+	case <-time.After(o.drainTimeout):
+		close(o.stop)
+		<-o.done
+
+		logger.Warningf("Could not send %d queued notifications to %s before shutting down", o.queued(), o.Name())
+	}
+
+	return o.provider.Close()
+}
+
+func (o *Outbox) enqueue(e *entry) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	now := time.Now()
+	fingerprint := e.fingerprint()
+
+	for key, sentAt := range o.recent {
+		if now.Sub(sentAt) > o.dedupeWindow {
+			delete(o.recent, key)
+		}
+	}
+
+	if _, isDuplicate := o.recent[fingerprint]; isDuplicate {
+		logger.Info("Dropping duplicate notification for " + o.Name() + ": " + e.text())
+		return nil
+	}
+
+	e.CreatedAt = now
+
+	key, err := o.db.Append(o.bucket, e)
+	if err != nil {
+		return err
+	}
+
+	e.key = key
+
+	o.queue = append(o.queue, e)
+	o.recent[fingerprint] = now
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (o *Outbox) run() {
+	defer close(o.done)
+
+	retryDelay := initialRetryDelay
+	var lastSent time.Time
+
+	for {
+		next := o.next()
+
+		if next == nil {
+			select {
+			case <-o.wake:
+				continue
+
+			case <-o.closing:
+				return
+			}
+		}
+
+		if !sleep(o.interval-time.Since(lastSent), o.stop) {
+			return
+		}
+
+		if time.Since(next.CreatedAt) > o.maxAge {
+			logger.Warning("Dropping notification for " + o.Name() + " that could not be sent in time: " + next.text())
+			o.remove(next)
+			continue
+		}
+
+		err := next.deliver(o.provider)
+		lastSent = time.Now()
+
+		if err == nil {
+			o.remove(next)
+			retryDelay = initialRetryDelay
+			continue
+		}
+
+		// Notifications that are rejected by the provider would hold back all the following ones until they are too old
+		if providers.IsPermanent(err) {
+			logger.Error("Dropping notification for " + o.Name() + " that was rejected: " + err.Error() + ": " + next.text())
+			o.remove(next)
+			continue
+		}
+
+		o.recordAttempt(next)
+
+		// Failed notifications are retried after the next start instead of delaying the shutdown
+		if !sleep(retryDelay, o.closing) {
+			return
+		}
+
+		retryDelay *= 2
+
+		if retryDelay > o.maxRetryDelay {
+			retryDelay = o.maxRetryDelay
+		}
+	}
+}
+
+func (o *Outbox) next() *entry {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if len(o.queue) == 0 {
+		return nil
+	}
+
+	return o.queue[0]
+}
+
+func (o *Outbox) remove(e *entry) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	// Only the head of the queue is delivered, but nothing else must be dropped should that ever not be the case
+	if len(o.queue) != 0 && o.queue[0] == e {
+		o.queue = o.queue[1:]
+	} else {
+		logger.Warning("Removed notification for " + o.Name() + " is not the head of the queue")
+		o.queue = slices.DeleteFunc(o.queue, func(queued *entry) bool {
+			return queued == e
+		})
+	}
+
+	if err := o.db.Delete(o.bucket, e.key); err != nil {
+		logger.Warning("Could not delete queued notification: " + err.Error())
+	}
+}
+
+func (o *Outbox) recordAttempt(e *entry) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	e.Attempts++
+
+	if err := o.db.Put(o.bucket, e.key, e); err != nil {
+		logger.Warning("Could not update queued notification: " + err.Error())
+	}
+}
+
+func (o *Outbox) queued() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return len(o.queue)
+}
+
+func (e *entry) deliver(provider providers.NotificationProvider) error {
+	if e.Event != nil {
+		return provider.SendEvent(e.Event)
+	}
+
+	return provider.SendMessage(e.Message)
+}
+
+func (e *entry) text() string {
+	if e.Event != nil {
+		return e.Event.Message
+	}
+
+	return e.Message
+}
+
+func (e *entry) fingerprint() string {
+	var eventType providers.EventType
+
+	if e.Event != nil {
+		eventType = e.Event.Type
+	}
+
+	hash := sha256.Sum256([]byte(string(eventType) + "/" + e.text()))
+	return hex.EncodeToString(hash[:])
+}
+
+// sleep returns false if it was interrupted
+func sleep(duration time.Duration, interrupt <-chan struct{}) bool {
+	if duration <= 0 {
+		return true
+	}
+
+	select {
+	case <-time.After(duration):
+		return true
+
+	case <-interrupt:
+		return false
+	}
+}
+
+func getOrDefault(value int, defaultValue int, unit time.Duration) time.Duration {
+	if value <= 0 {
+		value = defaultValue
+	}
+
+	return time.Duration(value) * unit
+}
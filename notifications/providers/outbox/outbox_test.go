@@ -0,0 +1,239 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BoltzExchange/channel-bot/database"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockWriter struct{}
+
+func (m *MockWriter) Write([]byte) (n int, err error) {
+	return 0, nil
+}
+
+type mockProvider struct {
+	lock sync.Mutex
+
+	failures int
+	rejected string
+	sent     []string
+	closed   bool
+}
+
+func (m *mockProvider) Name() string {
+	return "Mock"
+}
+
+func (m *mockProvider) Init() error {
+	return nil
+}
+
+func (m *mockProvider) SendMessage(message string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if message == m.rejected {
+		return &providers.PermanentError{Err: errors.New("too many fields")}
+	}
+
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("provider unavailable")
+	}
+
+	m.sent = append(m.sent, message)
+	return nil
+}
+
+func (m *mockProvider) SendEvent(event *providers.Event) error {
+	return m.SendMessage(event.Message)
+}
+
+func (m *mockProvider) Close() error {
+	m.closed = true
+	return nil
+}
+
+func (m *mockProvider) sentMessages() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return append([]string{}, m.sent...)
+}
+
+func connect(t *testing.T, path string) *database.Database {
+	db := &database.Database{
+		Path: path,
+	}
+
+	assert.Nil(t, db.Connect())
+
+	return db
+}
+
+func TestOutboxRetry(t *testing.T) {
+	logger.Init("", false, false, &MockWriter{})
+	initialRetryDelay = time.Millisecond
+
+	db := connect(t, filepath.Join(t.TempDir(), "outbox.db"))
+	defer db.Close()
+
+	provider := &mockProvider{failures: 2}
+	o := New(provider, db, &Config{}, 6000)
+
+	assert.Nil(t, o.Init())
+
+	assert.Nil(t, o.SendEvent(&providers.Event{Type: providers.EventForceClosed, Message: "force closed"}))
+	assert.Nil(t, o.SendMessage("message"))
+
+	assert.Eventually(t, func() bool {
+		return len(provider.sentMessages()) == 2
+	}, time.Second, time.Millisecond)
+
+	assert.Equal(t, []string{"force closed", "message"}, provider.sentMessages())
+	assert.Nil(t, o.Close())
+	assert.True(t, provider.closed)
+
+	// Sent notifications should be removed from the database
+	count := 0
+	assert.Nil(t, db.ForEach(o.bucket, func([]byte, []byte) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 0, count)
+}
+
+func TestOutboxRejected(t *testing.T) {
+	logger.Init("", false, false, &MockWriter{})
+	initialRetryDelay = time.Hour
+
+	db := connect(t, filepath.Join(t.TempDir(), "outbox.db"))
+	defer db.Close()
+
+	provider := &mockProvider{rejected: "locked funds"}
+	o := New(provider, db, &Config{}, 6000)
+
+	assert.Nil(t, o.Init())
+
+	// Rejected notifications are dropped instead of holding back the following ones
+	assert.Nil(t, o.SendEvent(&providers.Event{Type: providers.EventLockedFunds, Message: "locked funds"}))
+	assert.Nil(t, o.SendMessage("message"))
+
+	assert.Eventually(t, func() bool {
+		return o.queued() == 0
+	}, time.Second, time.Millisecond)
+
+	assert.Nil(t, o.Close())
+	assert.Equal(t, []string{"message"}, provider.sentMessages())
+}
+
+func TestOutboxDeduplication(t *testing.T) {
+	logger.Init("", false, false, &MockWriter{})
+
+	db := connect(t, filepath.Join(t.TempDir(), "outbox.db"))
+	defer db.Close()
+
+	provider := &mockProvider{}
+	o := New(provider, db, &Config{}, 6000)
+
+	assert.Nil(t, o.Init())
+
+	event := &providers.Event{Type: providers.EventImbalanced, Message: "imbalanced"}
+
+	assert.Nil(t, o.SendEvent(event))
+	assert.Nil(t, o.SendEvent(event))
+
+	// The same text with a different type is not a duplicate
+	assert.Nil(t, o.SendEvent(&providers.Event{Type: providers.EventBalanced, Message: "imbalanced"}))
+
+	assert.Nil(t, o.Close())
+	assert.Equal(t, []string{"imbalanced", "imbalanced"}, provider.sentMessages())
+
+	o.recent[(&entry{Event: event}).fingerprint()] = time.Now().Add(-o.dedupeWindow - time.Second)
+
+	assert.Nil(t, o.SendEvent(event))
+	assert.Len(t, o.queue, 1)
+}
+
+func TestOutboxPersistence(t *testing.T) {
+	logger.Init("", false, false, &MockWriter{})
+	initialRetryDelay = time.Hour
+
+	path := filepath.Join(t.TempDir(), "outbox.db")
+	db := connect(t, path)
+
+	// The provider is down until the bot is stopped
+	provider := &mockProvider{failures: 1}
+	o := New(provider, db, &Config{}, 6000)
+
+	assert.Nil(t, o.Init())
+	assert.Nil(t, o.SendMessage("first"))
+	assert.Nil(t, o.SendMessage("second"))
+
+	assert.Eventually(t, func() bool {
+		o.lock.Lock()
+		defer o.lock.Unlock()
+
+		return o.queue[0].Attempts == 1
+	}, time.Second, time.Millisecond)
+
+	assert.Nil(t, o.Close())
+	assert.Nil(t, db.Close())
+
+	assert.Len(t, provider.sentMessages(), 0)
+
+	db = connect(t, path)
+	defer db.Close()
+
+	provider = &mockProvider{}
+	o = New(provider, db, &Config{}, 6000)
+
+	// The outbox starts sending once it is initialized, so the persisted queue is checked before
+	var persisted []*entry
+
+	assert.Nil(t, db.ForEach(o.bucket, func(_ []byte, value []byte) error {
+		e := &entry{}
+		persisted = append(persisted, e)
+
+		return json.Unmarshal(value, e)
+	}))
+	assert.Len(t, persisted, 2)
+	assert.Equal(t, 1, persisted[0].Attempts)
+
+	assert.Nil(t, o.Init())
+
+	assert.Nil(t, o.Close())
+	assert.Equal(t, []string{"first", "second"}, provider.sentMessages())
+}
+
+func TestRemoveNotHead(t *testing.T) {
+	logger.Init("", false, false, &MockWriter{})
+
+	db := connect(t, filepath.Join(t.TempDir(), "outbox.db"))
+	defer db.Close()
+
+	o := New(&mockProvider{}, db, &Config{}, 6000)
+
+	first := &entry{key: []byte("first")}
+	second := &entry{key: []byte("second")}
+	o.queue = []*entry{first, second}
+
+	// Entries that are not the head are removed without dropping the head
+	o.remove(second)
+	assert.Equal(t, []*entry{first}, o.queue)
+
+	o.remove(first)
+	assert.Empty(t, o.queue)
+
+	o.remove(first)
+	assert.Empty(t, o.queue)
+}
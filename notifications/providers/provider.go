@@ -1,10 +1,19 @@
 package providers
 
+import (
+	"errors"
+	"net/http"
+)
+
 type NotificationProvider interface {
 	Name() string
 
 	Init() error
 	SendMessage(message string) error
+	SendEvent(event *Event) error
+
+	// Close is called on shutdown after the last message was sent
+	Close() error
 }
 
 func AddPrefix(prefix string, message string) string {
@@ -14,3 +23,33 @@ func AddPrefix(prefix string, message string) string {
 
 	return prefix + ": " + message
 }
+
+// PermanentError is returned for notifications that the provider will never accept, which are not retried
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// CheckStatusCode marks errors of requests that were rejected by the provider as permanent.
+// Rate limited requests can be retried
+func CheckStatusCode(statusCode int, err error) error {
+	if err == nil || statusCode < http.StatusBadRequest || statusCode >= http.StatusInternalServerError ||
+		statusCode == http.StatusTooManyRequests {
+		return err
+	}
+
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent returns whether sending the notification failed permanently
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
@@ -0,0 +1,25 @@
+package providers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckStatusCode(t *testing.T) {
+	err := errors.New("request failed")
+
+	assert.Nil(t, CheckStatusCode(http.StatusBadRequest, nil))
+
+	assert.True(t, IsPermanent(CheckStatusCode(http.StatusBadRequest, err)))
+	assert.True(t, IsPermanent(CheckStatusCode(http.StatusRequestEntityTooLarge, err)))
+
+	// Rate limits and errors of the server are retried
+	assert.False(t, IsPermanent(CheckStatusCode(http.StatusTooManyRequests, err)))
+	assert.False(t, IsPermanent(CheckStatusCode(http.StatusBadGateway, err)))
+	assert.False(t, IsPermanent(CheckStatusCode(0, err)))
+
+	assert.ErrorIs(t, CheckStatusCode(http.StatusBadRequest, err), err)
+}
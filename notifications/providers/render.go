@@ -0,0 +1,121 @@
+package providers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// IsStructured returns whether the event has information beyond its plain message
+func (event *Event) IsStructured() bool {
+	return event.Title != ""
+}
+
+// RenderFields returns the structured information of the event as list of fields
+func (event *Event) RenderFields() []*Field {
+	var fields []*Field
+
+	if event.Channel != nil {
+		value := strconv.FormatUint(event.Channel.ID, 10)
+
+		// Significant channels that are not identified by their ID have none until they are found
+		if event.Channel.ID == 0 {
+			value = event.Channel.Alias
+		} else if event.Channel.Alias != "" {
+			value = event.Channel.Alias + " (" + value + ")"
+		}
+
+		if event.Channel.Private {
+			value += ", private"
+		}
+
+		fields = append(fields, &Field{Name: "Channel", Value: value})
+	}
+
+	if event.Peer != nil {
+		value := event.Peer.Pubkey
+
+		if event.Peer.Alias != "" && event.Peer.Alias != event.Peer.Pubkey {
+			value = event.Peer.Alias + " (" + event.Peer.Pubkey + ")"
+		}
+
+		fields = append(fields, &Field{Name: "Peer", Value: value})
+	}
+
+	if event.Balances != nil {
+		fields = append(fields, &Field{Name: "Local", Value: FormatSats(event.Balances.Local)})
+
+		if event.Thresholds != nil {
+			fields = append(fields,
+				&Field{Name: "Minimal", Value: FormatSats(event.Thresholds.Min)},
+				&Field{Name: "Maximal", Value: FormatSats(event.Thresholds.Max)},
+			)
+		}
+
+		fields = append(fields, &Field{Name: "Remote", Value: FormatSats(event.Balances.Remote)})
+
+		if event.Balances.Capacity != 0 {
+			fields = append(fields, &Field{Name: "Capacity", Value: FormatSats(event.Balances.Capacity)})
+		}
+	}
+
+	for _, channel := range event.Breakdown {
+		fields = append(fields, &Field{
+			Name:  "Channel " + strconv.FormatUint(channel.ID, 10),
+			Value: FormatSats(channel.Local) + " local, " + FormatSats(channel.Remote) + " remote",
+		})
+	}
+
+	fields = append(fields, event.Fields...)
+
+	if event.CatchUp {
+		fields = append(fields, &Field{Name: "Catch-up", Value: "happened while the bot was offline"})
+	}
+
+	return fields
+}
+
+// RenderText renders the event as plain text without any markup
+func RenderText(event *Event) string {
+	if !event.IsStructured() {
+		return event.Message
+	}
+
+	lines := []string{"[" + strings.ToUpper(string(event.Severity)) + "] " + event.Title}
+
+	for _, field := range event.RenderFields() {
+		lines = append(lines, "  "+field.Name+": "+field.Value)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// SeverityColor returns the RGB color with which events of the severity should be highlighted
+func SeverityColor(severity Severity) int {
+	switch severity {
+	case SeverityCritical:
+		return 0xe74c3c
+
+	case SeverityWarning:
+		return 0xf39c12
+
+	default:
+		return 0x2ecc71
+	}
+}
+
+// FormatSats formats an amount of satoshis with thousands separators
+func FormatSats(amount int64) string {
+	formatted := strconv.FormatInt(amount, 10)
+	sign := ""
+
+	if amount < 0 {
+		sign = "-"
+		formatted = formatted[1:]
+	}
+
+	for i := len(formatted) - 3; i > 0; i -= 3 {
+		formatted = formatted[:i] + "," + formatted[i:]
+	}
+
+	return sign + formatted + " sats"
+}
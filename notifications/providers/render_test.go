@@ -0,0 +1,108 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var imbalancedEvent = &Event{
+	Type:     EventImbalanced,
+	Severity: SeverityWarning,
+	Title:    "Channel Boltz is imbalanced",
+	Message:  "fallback",
+	Channel: &Channel{
+		ID:      123,
+		Alias:   "Boltz",
+		Private: true,
+	},
+	Peer: &Peer{
+		Pubkey: "pubkey",
+		Alias:  "node",
+	},
+	Balances: &Balances{
+		Local:    100000,
+		Remote:   9900000,
+		Capacity: 10000000,
+	},
+	Thresholds: &Thresholds{
+		Min: 1000000,
+		Max: 9000000,
+	},
+	Fields: []*Field{
+		{Name: "Extra", Value: "info"},
+	},
+}
+
+func TestRenderFields(t *testing.T) {
+	assert.Equal(t, []*Field{
+		{Name: "Channel", Value: "Boltz (123), private"},
+		{Name: "Peer", Value: "node (pubkey)"},
+		{Name: "Local", Value: "100,000 sats"},
+		{Name: "Minimal", Value: "1,000,000 sats"},
+		{Name: "Maximal", Value: "9,000,000 sats"},
+		{Name: "Remote", Value: "9,900,000 sats"},
+		{Name: "Capacity", Value: "10,000,000 sats"},
+		{Name: "Extra", Value: "info"},
+	}, imbalancedEvent.RenderFields())
+
+	// The pubkey should not be repeated if no alias could be found
+	peerOnly := &Event{
+		Peer: &Peer{Pubkey: "pubkey", Alias: "pubkey"},
+	}
+
+	assert.Equal(t, []*Field{{Name: "Peer", Value: "pubkey"}}, peerOnly.RenderFields())
+
+	// Channels without ID are shown by their alias
+	assert.Equal(t, []*Field{{Name: "Channel", Value: "Boltz"}}, (&Event{Channel: &Channel{Alias: "Boltz"}}).RenderFields())
+
+	// Events that happened while the bot was offline are marked
+	peerOnly.CatchUp = true
+
+	assert.Equal(t, []*Field{
+		{Name: "Peer", Value: "pubkey"},
+		{Name: "Catch-up", Value: "happened while the bot was offline"},
+	}, peerOnly.RenderFields())
+
+	// The balances of the single channels are listed for aggregated peers
+	peerOnly.CatchUp = false
+	peerOnly.Breakdown = []*ChannelBalance{
+		{ID: 1, Balances: Balances{Local: 1000, Remote: 2000}},
+		{ID: 2, Balances: Balances{Local: 0, Remote: 500}},
+	}
+
+	assert.Equal(t, []*Field{
+		{Name: "Peer", Value: "pubkey"},
+		{Name: "Channel 1", Value: "1,000 sats local, 2,000 sats remote"},
+		{Name: "Channel 2", Value: "0 sats local, 500 sats remote"},
+	}, peerOnly.RenderFields())
+}
+
+func TestRenderText(t *testing.T) {
+	assert.Equal(t, "[WARNING] Channel Boltz is imbalanced\n"+
+		"  Channel: Boltz (123), private\n"+
+		"  Peer: node (pubkey)\n"+
+		"  Local: 100,000 sats\n"+
+		"  Minimal: 1,000,000 sats\n"+
+		"  Maximal: 9,000,000 sats\n"+
+		"  Remote: 9,900,000 sats\n"+
+		"  Capacity: 10,000,000 sats\n"+
+		"  Extra: info", RenderText(imbalancedEvent))
+
+	// Events without structured data fall back to their message
+	assert.Equal(t, "message", RenderText(&Event{Message: "message"}))
+}
+
+func TestSeverityColor(t *testing.T) {
+	assert.Equal(t, 0xe74c3c, SeverityColor(SeverityCritical))
+	assert.Equal(t, 0xf39c12, SeverityColor(SeverityWarning))
+	assert.Equal(t, 0x2ecc71, SeverityColor(SeverityInfo))
+}
+
+func TestFormatSats(t *testing.T) {
+	assert.Equal(t, "0 sats", FormatSats(0))
+	assert.Equal(t, "999 sats", FormatSats(999))
+	assert.Equal(t, "1,000 sats", FormatSats(1000))
+	assert.Equal(t, "155,441,521,769 sats", FormatSats(155441521769))
+	assert.Equal(t, "-12,345 sats", FormatSats(-12345))
+}
@@ -0,0 +1,219 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	initiatorLocal  = "local"
+	initiatorRemote = "remote"
+
+	defaultRuleName = "default"
+)
+
+// Rule sets the thresholds of the channels it matches. All conditions that are set have to match
+// and the first rule that matches a channel is used for it
+type Rule struct {
+	Name string
+
+	// Conditions
+	Pubkeys     []string
+	MinCapacity int64
+	MaxCapacity int64
+	Private     *bool
+	// Either "local" or "remote"
+	Initiator string
+	// Names of tags of which at least one has to be set for the channel
+	Tags []string
+
+	// Thresholds that override the defaults of the manager for the channels of the rule
+	MinRatio   string
+	MaxRatio   string
+	Hysteresis string
+	MinDwell   int
+	// Either "info", "warning" or "critical"
+	Severity string
+	// Channels of rules with notify set to false are not notified about
+	Notify *bool
+
+	// Absolute limits in satoshis. When they are set without ratios, the ratios are not checked
+	MinLocal   int64
+	MaxLocal   int64
+	MinInbound int64
+
+	// Parsed from the thresholds, the severity and notify
+	ratios   ratios
+	severity providers.Severity
+	notify   bool
+}
+
+// ParseRules validates the rules and parses their thresholds
+func (manager *ChannelManager) ParseRules() error {
+	for i, rule := range manager.Rules {
+		if rule.Name == "" {
+			rule.Name = "#" + strconv.Itoa(i+1)
+		}
+
+		if err := rule.parse(manager); err != nil {
+			return errors.New(fmt.Sprint("invalid rule ", rule.Name, ": ", err))
+		}
+	}
+
+	return nil
+}
+
+func (rule *Rule) parse(manager *ChannelManager) (err error) {
+	rule.ratios = ratios{
+		min:        defaultMinRatio,
+		max:        defaultMaxRatio,
+		minLocal:   rule.MinLocal,
+		maxLocal:   rule.MaxLocal,
+		minInbound: rule.MinInbound,
+		hysteresis: manager.Hysteresis,
+		minDwell:   time.Duration(manager.MinDwell) * time.Second,
+		model:      manager.balanceModel,
+	}
+
+	if err := rule.ratios.validateBalanceLimits(); err != nil {
+		return err
+	}
+
+	if rule.MinRatio == "" && rule.MaxRatio == "" && rule.ratios.hasBalanceLimits() {
+		rule.ratios.disableRatios()
+	}
+
+	if rule.MinRatio != "" {
+		if rule.ratios.min, err = strconv.ParseFloat(rule.MinRatio, 64); err != nil {
+			return errors.New("min ratio is not a number")
+		}
+	}
+
+	if rule.MaxRatio != "" {
+		if rule.ratios.max, err = strconv.ParseFloat(rule.MaxRatio, 64); err != nil {
+			return errors.New("max ratio is not a number")
+		}
+	}
+
+	if rule.ratios.min >= rule.ratios.max {
+		return errors.New("min ratio has to be less than max ratio")
+	}
+
+	if rule.Hysteresis != "" {
+		if rule.ratios.hysteresis, err = strconv.ParseFloat(rule.Hysteresis, 64); err != nil {
+			return errors.New("hysteresis is not a number")
+		}
+	}
+
+	if rule.MinDwell != 0 {
+		rule.ratios.minDwell = time.Duration(rule.MinDwell) * time.Second
+	}
+
+	if rule.MaxCapacity != 0 && rule.MinCapacity > rule.MaxCapacity {
+		return errors.New("min capacity has to be less than max capacity")
+	}
+
+	switch rule.Initiator {
+	case "", initiatorLocal, initiatorRemote:
+		break
+
+	default:
+		return errors.New("unknown initiator: " + rule.Initiator)
+	}
+
+	switch severity := providers.Severity(strings.ToLower(rule.Severity)); severity {
+	case "":
+		rule.severity = providers.SeverityWarning
+
+	case providers.SeverityInfo, providers.SeverityWarning, providers.SeverityCritical:
+		rule.severity = severity
+
+	default:
+		return errors.New("unknown severity: " + rule.Severity)
+	}
+
+	rule.notify = rule.Notify == nil || *rule.Notify
+
+	return nil
+}
+
+func (rule *Rule) matches(channel *lnrpc.Channel, tags map[string]bool) bool {
+	if len(rule.Pubkeys) != 0 && !slices.Contains(rule.Pubkeys, channel.RemotePubkey) {
+		return false
+	}
+
+	if channel.Capacity < rule.MinCapacity || (rule.MaxCapacity != 0 && channel.Capacity > rule.MaxCapacity) {
+		return false
+	}
+
+	if rule.Private != nil && *rule.Private != channel.Private {
+		return false
+	}
+
+	if (rule.Initiator == initiatorLocal && !channel.Initiator) || (rule.Initiator == initiatorRemote && channel.Initiator) {
+		return false
+	}
+
+	if len(rule.Tags) == 0 {
+		return true
+	}
+
+	for _, tag := range rule.Tags {
+		if tags[tag] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// defaultRule is used for channels that no configured rule matches
+func defaultRule(defaultRatios ratios) *Rule {
+	private := false
+
+	return &Rule{
+		Name:     defaultRuleName,
+		Private:  &private,
+		ratios:   defaultRatios,
+		severity: providers.SeverityWarning,
+		notify:   true,
+	}
+}
+
+// matchRule returns the first rule that matches the channel or nil if none does
+func (sm *stateManager) matchRule(channel *lnrpc.Channel) *Rule {
+	tags := map[string]bool{}
+
+	for _, key := range []string{channel.RemotePubkey, strconv.FormatUint(channel.ChanId, 10)} {
+		for _, tag := range sm.tags[key] {
+			tags[tag] = true
+		}
+	}
+
+	for _, rule := range sm.rules {
+		if rule.matches(channel, tags) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// invertTags maps the pubkeys and channel IDs to the names of the tags that are set for them
+func invertTags(tags map[string][]string) map[string][]string {
+	inverted := map[string][]string{}
+
+	for tag, keys := range tags {
+		for _, key := range keys {
+			inverted[key] = append(inverted[key], tag)
+		}
+	}
+
+	return inverted
+}
@@ -0,0 +1,198 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func boolPointer(value bool) *bool {
+	return &value
+}
+
+func TestParseRules(t *testing.T) {
+	manager := &ChannelManager{
+		Hysteresis: 0.01,
+		MinDwell:   10,
+		Rules: []*Rule{
+			{
+				MinRatio: "0.1",
+				Severity: "Critical",
+			},
+			{
+				Name:       "big",
+				MaxRatio:   "0.9",
+				Hysteresis: "0.05",
+				MinDwell:   60,
+				Notify:     boolPointer(false),
+			},
+		},
+	}
+
+	assert.Nil(t, manager.ParseRules())
+
+	assert.Equal(t, "#1", manager.Rules[0].Name)
+	assert.Equal(t, ratios{min: 0.1, max: 0.7, hysteresis: 0.01, minDwell: 10 * time.Second}, manager.Rules[0].ratios)
+	assert.Equal(t, providers.SeverityCritical, manager.Rules[0].severity)
+	assert.True(t, manager.Rules[0].notify)
+
+	assert.Equal(t, ratios{min: 0.3, max: 0.9, hysteresis: 0.05, minDwell: time.Minute}, manager.Rules[1].ratios)
+	assert.Equal(t, providers.SeverityWarning, manager.Rules[1].severity)
+	assert.False(t, manager.Rules[1].notify)
+}
+
+func TestParseRulesInvalid(t *testing.T) {
+	invalid := map[string]*Rule{
+		"invalid rule test: min ratio is not a number":               {MinRatio: "a"},
+		"invalid rule test: max ratio is not a number":               {MaxRatio: "b"},
+		"invalid rule test: min ratio has to be less than max ratio": {MinRatio: "0.8"},
+		"invalid rule test: hysteresis is not a number":              {Hysteresis: "c"},
+		"invalid rule test: min capacity has to be less than max capacity": {
+			MinCapacity: 2,
+			MaxCapacity: 1,
+		},
+		"invalid rule test: unknown initiator: nobody": {Initiator: "nobody"},
+		"invalid rule test: unknown severity: fatal":   {Severity: "fatal"},
+	}
+
+	for expected, rule := range invalid {
+		rule.Name = "test"
+
+		manager := &ChannelManager{
+			Rules: []*Rule{rule},
+		}
+
+		assert.EqualError(t, manager.ParseRules(), expected)
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	channel := &lnrpc.Channel{
+		ChanId:       1,
+		RemotePubkey: "pubkey",
+		Capacity:     1000000,
+		Private:      true,
+		Initiator:    true,
+	}
+
+	assert.True(t, (&Rule{}).matches(channel, nil))
+
+	assert.True(t, (&Rule{Pubkeys: []string{"other", "pubkey"}}).matches(channel, nil))
+	assert.False(t, (&Rule{Pubkeys: []string{"other"}}).matches(channel, nil))
+
+	assert.True(t, (&Rule{MinCapacity: 1000000, MaxCapacity: 1000000}).matches(channel, nil))
+	assert.False(t, (&Rule{MinCapacity: 1000001}).matches(channel, nil))
+	assert.False(t, (&Rule{MaxCapacity: 999999}).matches(channel, nil))
+
+	assert.True(t, (&Rule{Private: boolPointer(true)}).matches(channel, nil))
+	assert.False(t, (&Rule{Private: boolPointer(false)}).matches(channel, nil))
+
+	assert.True(t, (&Rule{Initiator: initiatorLocal}).matches(channel, nil))
+	assert.False(t, (&Rule{Initiator: initiatorRemote}).matches(channel, nil))
+
+	assert.True(t, (&Rule{Tags: []string{"a", "b"}}).matches(channel, map[string]bool{"b": true}))
+	assert.False(t, (&Rule{Tags: []string{"a"}}).matches(channel, map[string]bool{"b": true}))
+}
+
+func TestMatchRule(t *testing.T) {
+	manager := &ChannelManager{
+		Rules: []*Rule{
+			{
+				Name: "exchanges",
+				Tags: []string{"exchange"},
+			},
+			{
+				Name:    "private",
+				Private: boolPointer(true),
+			},
+		},
+		Tags: map[string][]string{
+			"exchange": {"exchangePubkey", "2"},
+		},
+	}
+
+	assert.Nil(t, manager.ParseRules())
+
+	sm := initStateManager(manager, nil)
+
+	assert.Equal(t, "exchanges", sm.matchRule(&lnrpc.Channel{ChanId: 1, RemotePubkey: "exchangePubkey", Private: true}).Name)
+	assert.Equal(t, "exchanges", sm.matchRule(&lnrpc.Channel{ChanId: 2, RemotePubkey: "pubkey"}).Name)
+	assert.Equal(t, "private", sm.matchRule(&lnrpc.Channel{ChanId: 3, RemotePubkey: "pubkey", Private: true}).Name)
+	assert.Equal(t, defaultRuleName, sm.matchRule(&lnrpc.Channel{ChanId: 4, RemotePubkey: "pubkey"}).Name)
+}
+
+func TestCheckChannelRules(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	manager := &ChannelManager{
+		logInsignificant: true,
+		Rules: []*Rule{
+			{
+				Name:     "muted",
+				Pubkeys:  []string{"muted"},
+				Notify:   boolPointer(false),
+				MinRatio: "0.1",
+			},
+			{
+				Name:     "private",
+				Private:  boolPointer(true),
+				MinRatio: "0.1",
+				MaxRatio: "0.9",
+				Severity: "critical",
+			},
+		},
+	}
+
+	assert.Nil(t, manager.ParseRules())
+
+	newTestManager(manager, nil)
+
+	// Channels of muted rules are not notified
+	manager.sm.checkChannel(context.Background(), &lnrpc.Channel{
+		ChanId:        1,
+		RemotePubkey:  "muted",
+		LocalBalance:  0,
+		RemoteBalance: 100,
+		Capacity:      100,
+	})
+
+	assert.Len(t, sentEvents, 0)
+
+	// Private channels are checked with the thresholds of the rule that matches them
+	manager.sm.checkChannel(context.Background(), &lnrpc.Channel{
+		ChanId:        2,
+		RemotePubkey:  "pubkey",
+		Private:       true,
+		LocalBalance:  20,
+		RemoteBalance: 80,
+		Capacity:      100,
+	})
+
+	assert.Len(t, sentEvents, 0)
+
+	manager.sm.checkChannel(context.Background(), &lnrpc.Channel{
+		ChanId:        2,
+		RemotePubkey:  "pubkey",
+		Private:       true,
+		LocalBalance:  5,
+		RemoteBalance: 95,
+		Capacity:      100,
+	})
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, providers.SeverityCritical, sentEvents[0].Severity)
+	assert.Equal(t, &providers.Thresholds{Min: 10, Max: 90}, sentEvents[0].Thresholds)
+	assert.Equal(t, []*providers.Field{
+		{Name: "Rule", Value: "private"},
+		{Name: "Breached limit", Value: "Minimal ratio of 0.1"},
+	}, sentEvents[0].Fields)
+
+	cleanUp()
+}
@@ -0,0 +1,151 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseSignificantChannels validates that every significant channel is identified by exactly one
+// channel ID, short channel ID, channel point or pubkey and parses its thresholds
+func (manager *ChannelManager) ParseSignificantChannels(significantChannels []*SignificantChannel) error {
+	for _, significant := range significantChannels {
+		err := significant.parseIdentifier()
+
+		if err == nil {
+			significant.ratios, err = manager.parseSignificantRatios(
+				significant.MinRatio,
+				significant.MaxRatio,
+				significant.Hysteresis,
+				significant.MinDwell,
+				ratios{
+					minLocal:   significant.MinLocal,
+					maxLocal:   significant.MaxLocal,
+					minInbound: significant.MinInbound,
+				},
+			)
+		}
+
+		if err != nil {
+			return errors.New(fmt.Sprint("invalid significant channel ", significant.Alias, ": ", err))
+		}
+	}
+
+	return nil
+}
+
+func (sc *SignificantChannel) parseIdentifier() (err error) {
+	identifiers := 0
+
+	for _, isSet := range []bool{sc.ChannelID != 0, sc.ShortChannelID != "", sc.ChannelPoint != "", sc.Pubkey != ""} {
+		if isSet {
+			identifiers++
+		}
+	}
+
+	if identifiers != 1 {
+		return errors.New("exactly one of channel ID, short channel ID, channel point or pubkey has to be set")
+	}
+
+	sc.chanId = sc.ChannelID
+
+	if sc.ShortChannelID != "" {
+		sc.chanId, err = parseShortChannelID(sc.ShortChannelID)
+	}
+
+	return err
+}
+
+// parseShortChannelID parses short channel IDs in the format "block:tx:output" or "blockxtxxoutput"
+func parseShortChannelID(scid string) (uint64, error) {
+	parts := strings.FieldsFunc(scid, func(r rune) bool {
+		return r == ':' || r == 'x'
+	})
+
+	if len(parts) != 3 {
+		return 0, errors.New("invalid short channel ID: " + scid)
+	}
+
+	block, blockErr := strconv.ParseUint(parts[0], 10, 24)
+	tx, txErr := strconv.ParseUint(parts[1], 10, 24)
+	output, outputErr := strconv.ParseUint(parts[2], 10, 16)
+
+	if blockErr != nil || txErr != nil || outputErr != nil {
+		return 0, errors.New("invalid short channel ID: " + scid)
+	}
+
+	return lnwire.ShortChannelID{
+		BlockHeight: uint32(block),
+		TxIndex:     uint32(tx),
+		TxPosition:  uint16(output),
+	}.ToUint64(), nil
+}
+
+func (sc *SignificantChannel) matches(ids []uint64, channelPoint string, pubkey string) bool {
+	switch {
+	case sc.chanId != 0:
+		return slices.Contains(ids, sc.chanId)
+
+	case sc.ChannelPoint != "":
+		return sc.ChannelPoint == channelPoint
+
+	case sc.Pubkey != "":
+		return sc.Pubkey == pubkey
+	}
+
+	return false
+}
+
+// channelIds returns the ID, the confirmed SCID and the alias SCIDs of a channel
+func channelIds(chanId uint64, confirmedScid uint64, aliasScids []uint64) []uint64 {
+	return append([]uint64{chanId, confirmedScid}, aliasScids...)
+}
+
+// findSignificant returns the first significant channel that matches or nil if none does
+func (sm *stateManager) findSignificant(ids []uint64, channelPoint string, pubkey string) *SignificantChannel {
+	for _, significant := range sm.significantChannels {
+		if significant.matches(ids, channelPoint, pubkey) {
+			return significant
+		}
+	}
+
+	return nil
+}
+
+func (sm *stateManager) significantChannel(channel *lnrpc.Channel) *SignificantChannel {
+	return sm.findSignificant(
+		channelIds(channel.ChanId, channel.ZeroConfConfirmedScid, channel.AliasScids),
+		channel.ChannelPoint,
+		channel.RemotePubkey,
+	)
+}
+
+func (sm *stateManager) significantClosedChannel(closed *lnrpc.ChannelCloseSummary) *SignificantChannel {
+	return sm.findSignificant(
+		channelIds(closed.ChanId, closed.ZeroConfConfirmedScid, closed.AliasScids),
+		closed.ChannelPoint,
+		closed.RemotePubkey,
+	)
+}
+
+// channelsOfSignificant returns the tracked channels that resolve to the significant channel sorted by their IDs
+func (sm *stateManager) channelsOfSignificant(significant *SignificantChannel) []*lnrpc.Channel {
+	var channels []*lnrpc.Channel
+
+	for _, channel := range sm.channels {
+		if sm.significantChannel(channel) == significant {
+			channels = append(channels, channel)
+		}
+	}
+
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].ChanId < channels[j].ChanId
+	})
+
+	return channels
+}
@@ -0,0 +1,156 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var testScid = lnwire.ShortChannelID{BlockHeight: 563795, TxIndex: 889, TxPosition: 1}.ToUint64()
+
+func TestParseShortChannelID(t *testing.T) {
+	for _, scid := range []string{"563795:889:1", "563795x889x1"} {
+		parsed, err := parseShortChannelID(scid)
+
+		assert.Nil(t, err)
+		assert.Equal(t, testScid, parsed)
+	}
+
+	for _, scid := range []string{"", "563795:889", "563795:889:1:1", "a:889:1", "563795:889:65536", "16777216:889:1"} {
+		_, err := parseShortChannelID(scid)
+
+		assert.EqualError(t, err, "invalid short channel ID: "+scid)
+	}
+}
+
+func TestParseSignificantChannelIdentifiers(t *testing.T) {
+	significantChannels := []*SignificantChannel{
+		{Alias: "id", ChannelID: 123},
+		{Alias: "scid", ShortChannelID: "563795x889x1"},
+		{Alias: "point", ChannelPoint: "txid:0"},
+		{Alias: "peer", Pubkey: "pubkey"},
+	}
+
+	assert.Nil(t, (&ChannelManager{}).ParseSignificantChannels(significantChannels))
+
+	assert.Equal(t, uint64(123), significantChannels[0].chanId)
+	assert.Equal(t, testScid, significantChannels[1].chanId)
+	assert.Equal(t, uint64(0), significantChannels[2].chanId)
+	assert.Equal(t, uint64(0), significantChannels[3].chanId)
+
+	invalid := map[string]*SignificantChannel{
+		"invalid significant channel none: exactly one of channel ID, short channel ID, channel point or pubkey has to be set": {
+			Alias: "none",
+		},
+		"invalid significant channel both: exactly one of channel ID, short channel ID, channel point or pubkey has to be set": {
+			Alias:     "both",
+			ChannelID: 123,
+			Pubkey:    "pubkey",
+		},
+		"invalid significant channel scid: invalid short channel ID: 563795": {
+			Alias:          "scid",
+			ShortChannelID: "563795",
+		},
+		"invalid significant channel min: min ratio is not a number": {
+			Alias:     "min",
+			ChannelID: 123,
+			MinRatio:  "0,1",
+		},
+		"invalid significant channel max: max ratio is not a number": {
+			Alias:     "max",
+			ChannelID: 123,
+			MaxRatio:  "O.9",
+		},
+		"invalid significant channel hysteresis: hysteresis is not a number": {
+			Alias:      "hysteresis",
+			ChannelID:  123,
+			Hysteresis: "five",
+		},
+	}
+
+	for expected, significant := range invalid {
+		assert.EqualError(t, (&ChannelManager{}).ParseSignificantChannels([]*SignificantChannel{significant}), expected)
+	}
+}
+
+func TestSignificantChannelResolution(t *testing.T) {
+	significantChannels := []*SignificantChannel{
+		{Alias: "scid", ShortChannelID: "563795:889:1"},
+		{Alias: "point", ChannelPoint: "txid:0"},
+		{Alias: "peer", Pubkey: "pubkey"},
+	}
+
+	sm := newTestManager(&ChannelManager{}, significantChannels).sm
+
+	// Both the alias and the confirmed SCIDs of zero-conf channels are matched
+	assert.Equal(t, significantChannels[0], sm.significantChannel(&lnrpc.Channel{ChanId: testScid}))
+	assert.Equal(t, significantChannels[0], sm.significantChannel(&lnrpc.Channel{ChanId: 1, AliasScids: []uint64{testScid}}))
+	assert.Equal(t, significantChannels[0], sm.significantChannel(&lnrpc.Channel{ChanId: 1, ZeroConfConfirmedScid: testScid}))
+
+	assert.Equal(t, significantChannels[1], sm.significantChannel(&lnrpc.Channel{ChanId: 2, ChannelPoint: "txid:0"}))
+	assert.Equal(t, significantChannels[2], sm.significantChannel(&lnrpc.Channel{ChanId: 3, RemotePubkey: "pubkey"}))
+
+	// The first significant channel that matches is used
+	assert.Equal(t, significantChannels[1], sm.significantChannel(&lnrpc.Channel{
+		ChanId:       4,
+		ChannelPoint: "txid:0",
+		RemotePubkey: "pubkey",
+	}))
+
+	assert.Nil(t, sm.significantChannel(&lnrpc.Channel{ChanId: 5, ChannelPoint: "txid:1", RemotePubkey: "other"}))
+	assert.Nil(t, sm.significantClosedChannel(&lnrpc.ChannelCloseSummary{ChanId: 5}))
+	assert.Equal(t, significantChannels[0], sm.significantClosedChannel(&lnrpc.ChannelCloseSummary{
+		ChanId:     5,
+		AliasScids: []uint64{testScid},
+	}))
+}
+
+func TestSignificantPeerNotFound(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	sm := newTestManager(&ChannelManager{}, []*SignificantChannel{
+		{Alias: "Boltz", Pubkey: "boltz", MinRatio: "0.1", MaxRatio: "0.9"},
+	}).sm
+
+	sm.populateChannels(context.Background(), &lnrpc.ListChannelsResponse{
+		Channels: []*lnrpc.Channel{
+			{ChanId: 1, RemotePubkey: "boltz", LocalBalance: 50, RemoteBalance: 50, Capacity: 100},
+			{ChanId: 2, RemotePubkey: "boltz", LocalBalance: 5, RemoteBalance: 95, Capacity: 100},
+		},
+	})
+
+	// All channels to the peer are checked as significant channels
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, "Channel Boltz is imbalanced", sentEvents[0].Title)
+	assert.Equal(t, uint64(2), sentEvents[0].Channel.ID)
+
+	cleanUp()
+
+	// The significant channel is not missing as long as there are other channels to the peer
+	sm.handleClose(context.Background(), &lnrpc.ChannelCloseSummary{
+		ChanId:       2,
+		RemotePubkey: "boltz",
+		CloseType:    lnrpc.ChannelCloseSummary_COOPERATIVE_CLOSE,
+	})
+
+	assert.Len(t, sentEvents, 0)
+
+	sm.handleClose(context.Background(), &lnrpc.ChannelCloseSummary{
+		ChanId:       1,
+		RemotePubkey: "boltz",
+		CloseType:    lnrpc.ChannelCloseSummary_COOPERATIVE_CLOSE,
+	})
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, providers.EventSignificantNotFound, sentEvents[0].Type)
+	assert.Equal(t, &providers.Peer{Pubkey: "boltz"}, sentEvents[0].Peer)
+
+	cleanUp()
+}
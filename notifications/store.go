@@ -0,0 +1,303 @@
+package notifications
+
+import (
+	"encoding/json"
+	"github.com/BoltzExchange/channel-bot/database"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"strconv"
+	"time"
+)
+
+const (
+	channelStatesBucket = "channel_states"
+	peerStatesBucket    = "peer_states"
+	pendingHtlcsBucket  = "pending_htlcs"
+	nodeAliasesBucket   = "node_aliases"
+	knownChannelsBucket = "known_channels"
+	metaBucket          = "meta"
+)
+
+// Key in the meta bucket that is set once the known channels were recorded for the first time
+var channelsSyncedKey = []byte("channels_synced")
+
+// channelState is the state of a channel the last notification was sent for
+type channelState struct {
+	Imbalanced bool
+
+	LocalBalance  int64
+	RemoteBalance int64
+
+	NotifiedAt time.Time
+
+	// Since when the channel is in a state that was not notified yet
+	PendingSince time.Time
+	// Number of changes of the state that were not notified
+	SuppressedFlips int
+
+	// Number of updates of the channel when the last notification about it was sent
+	AlertedAtUpdate uint64
+	// Names of the custom conditions that are currently met
+	MetConditions []string
+}
+
+// knownChannel is a channel the bot has seen, keyed by its channel point
+type knownChannel struct {
+	ChanId uint64
+	Closed bool
+}
+
+type storedNode struct {
+	Name      string
+	FetchedAt time.Time
+}
+
+// stateStore persists the state of the notification bot, so that it can continue where it stopped after a restart.
+// All methods are no-ops when no database is configured
+type stateStore struct {
+	db *database.Database
+}
+
+func initStateStore(db *database.Database) *stateStore {
+	return &stateStore{
+		db: db,
+	}
+}
+
+func (s *stateStore) enabled() bool {
+	return s != nil && s.db != nil
+}
+
+func (s *stateStore) loadChannelStates() map[uint64]*channelState {
+	states := map[uint64]*channelState{}
+
+	if !s.enabled() {
+		return states
+	}
+
+	s.load(channelStatesBucket, func(key []byte) interface{} {
+		state := &channelState{}
+		states[database.ParseUint64Key(key)] = state
+
+		return state
+	})
+
+	return states
+}
+
+func (s *stateStore) saveChannelState(channelId uint64, state *channelState) {
+	if !s.enabled() {
+		return
+	}
+
+	s.checkError("channel state", s.db.Put(channelStatesBucket, database.Uint64Key(channelId), state))
+}
+
+func (s *stateStore) deleteChannelState(channelId uint64) {
+	if !s.enabled() {
+		return
+	}
+
+	s.checkError("channel state", s.db.Delete(channelStatesBucket, database.Uint64Key(channelId)))
+}
+
+func (s *stateStore) loadPeerStates() map[string]*channelState {
+	states := map[string]*channelState{}
+
+	if !s.enabled() {
+		return states
+	}
+
+	s.load(peerStatesBucket, func(key []byte) interface{} {
+		state := &channelState{}
+		states[string(key)] = state
+
+		return state
+	})
+
+	return states
+}
+
+func (s *stateStore) savePeerState(pubkey string, state *channelState) {
+	if !s.enabled() {
+		return
+	}
+
+	s.checkError("peer state", s.db.Put(peerStatesBucket, []byte(pubkey), state))
+}
+
+func (s *stateStore) deletePeerState(pubkey string) {
+	if !s.enabled() {
+		return
+	}
+
+	s.checkError("peer state", s.db.Delete(peerStatesBucket, []byte(pubkey)))
+}
+
+func (s *stateStore) loadPendingHtlcs() map[string]*routerrpc.ForwardEvent {
+	htlcs := map[string]*routerrpc.ForwardEvent{}
+
+	if !s.enabled() {
+		return htlcs
+	}
+
+	s.decode(pendingHtlcsBucket, func(key []byte, data []byte) error {
+		htlc := &routerrpc.ForwardEvent{}
+		htlcs[string(key)] = htlc
+
+		return protojson.Unmarshal(data, htlc)
+	})
+
+	return htlcs
+}
+
+// savePendingHtlcs replaces all persisted pending HTLCs with the ones passed in a single transaction
+func (s *stateStore) savePendingHtlcs(htlcs map[string]*routerrpc.ForwardEvent) {
+	if !s.enabled() {
+		return
+	}
+
+	entries := make(map[string][]byte, len(htlcs))
+
+	for id, htlc := range htlcs {
+		encoded, err := protojson.Marshal(htlc)
+		if err != nil {
+			s.checkError("pending HTLC", err)
+			return
+		}
+
+		entries[id] = encoded
+	}
+
+	s.checkError("pending HTLCs", s.db.Replace(pendingHtlcsBucket, entries))
+}
+
+// loadKnownChannels returns the channels the bot has seen and whether they were recorded before
+func (s *stateStore) loadKnownChannels() (map[string]*knownChannel, bool) {
+	channels := map[string]*knownChannel{}
+
+	if !s.enabled() {
+		return channels, false
+	}
+
+	s.load(knownChannelsBucket, func(key []byte) interface{} {
+		channel := &knownChannel{}
+		channels[string(key)] = channel
+
+		return channel
+	})
+
+	var syncedAt time.Time
+	synced, err := s.db.Get(metaBucket, channelsSyncedKey, &syncedAt)
+	s.checkLoadError(metaBucket, err)
+
+	return channels, synced
+}
+
+// loadKnownChannel returns the known channel with the channel point or nil if the bot has not seen it
+func (s *stateStore) loadKnownChannel(channelPoint string) *knownChannel {
+	if !s.enabled() {
+		return nil
+	}
+
+	channel := &knownChannel{}
+
+	found, err := s.db.Get(knownChannelsBucket, []byte(channelPoint), channel)
+	s.checkLoadError(knownChannelsBucket, err)
+
+	if !found {
+		return nil
+	}
+
+	return channel
+}
+
+func (s *stateStore) saveKnownChannel(channelPoint string, channel *knownChannel) {
+	if !s.enabled() {
+		return
+	}
+
+	s.checkError("known channel", s.db.Put(knownChannelsBucket, []byte(channelPoint), channel))
+}
+
+func (s *stateStore) setChannelsSynced() {
+	if !s.enabled() {
+		return
+	}
+
+	s.checkError("known channels", s.db.Put(metaBucket, channelsSyncedKey, time.Now()))
+}
+
+func (s *stateStore) loadNodes() map[string]*nodeInfo {
+	nodes := map[string]*nodeInfo{}
+
+	if !s.enabled() {
+		return nodes
+	}
+
+	stored := map[string]*storedNode{}
+
+	s.load(nodeAliasesBucket, func(key []byte) interface{} {
+		node := &storedNode{}
+		stored[string(key)] = node
+
+		return node
+	})
+
+	for pubkey, node := range stored {
+		nodes[pubkey] = &nodeInfo{
+			name:      node.Name,
+			fetchedAt: node.FetchedAt,
+		}
+	}
+
+	return nodes
+}
+
+func (s *stateStore) saveNode(pubkey string, info *nodeInfo) {
+	if !s.enabled() {
+		return
+	}
+
+	s.checkError("node alias", s.db.Put(nodeAliasesBucket, []byte(pubkey), &storedNode{
+		Name:      info.name,
+		FetchedAt: info.fetchedAt,
+	}))
+}
+
+// load decodes all entries of the bucket into the values returned by the callback
+func (s *stateStore) load(bucket string, value func(key []byte) interface{}) {
+	s.decode(bucket, func(key []byte, data []byte) error {
+		return json.Unmarshal(data, value(key))
+	})
+}
+
+// decode calls the callback with the raw data of all entries of the bucket
+func (s *stateStore) decode(bucket string, callback func(key []byte, data []byte) error) {
+	count := 0
+
+	err := s.db.ForEach(bucket, func(key []byte, data []byte) error {
+		count++
+		return callback(key, data)
+	})
+
+	if err != nil {
+		s.checkLoadError(bucket, err)
+		return
+	}
+
+	logger.Info("Loaded " + strconv.Itoa(count) + " entries of " + bucket + " from database")
+}
+
+func (s *stateStore) checkLoadError(bucket string, err error) {
+	if err != nil {
+		logger.Warning("Could not load " + bucket + " from database: " + err.Error())
+	}
+}
+
+func (s *stateStore) checkError(name string, err error) {
+	if err != nil {
+		logger.Warning("Could not persist " + name + ": " + err.Error())
+	}
+}
@@ -0,0 +1,169 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/database"
+	"github.com/BoltzExchange/channel-bot/utils"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openStore(t *testing.T) *stateStore {
+	db := &database.Database{
+		Path: filepath.Join(t.TempDir(), "test.db"),
+	}
+
+	assert.Nil(t, db.Connect())
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return initStateStore(db)
+}
+
+func TestStateManagerRestore(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	store := openStore(t)
+
+	newManager := func() *ChannelManager {
+		return newTestManager(&ChannelManager{logInsignificant: true, store: store}, nil)
+	}
+
+	imbalanced := func() *lnrpc.ListChannelsResponse {
+		return &lnrpc.ListChannelsResponse{
+			Channels: []*lnrpc.Channel{
+				{
+					ChanId:        1,
+					LocalBalance:  90,
+					RemoteBalance: 10,
+					Capacity:      100,
+				},
+				{
+					ChanId:        2,
+					LocalBalance:  50,
+					RemoteBalance: 50,
+					Capacity:      100,
+				},
+			},
+		}
+	}
+
+	checkAll := func(manager *ChannelManager) {
+		manager.sm.populateChannels(context.Background(), imbalanced())
+
+		for _, channel := range manager.sm.channels {
+			manager.sm.checkChannel(context.Background(), channel)
+		}
+	}
+
+	manager := newManager()
+	checkAll(manager)
+
+	assert.Len(t, sentMessages, 1)
+
+	cleanUp()
+
+	// After a restart, the channel that is still imbalanced should not be notified again
+	manager = newManager()
+
+	assert.True(t, manager.sm.imbalancedChannels[1])
+	assert.Equal(t, int64(90), manager.sm.notifiedStates[1].LocalBalance)
+
+	checkAll(manager)
+
+	assert.Len(t, sentMessages, 0)
+
+	cleanUp()
+
+	// The state of channels that were closed in the meantime should be dropped
+	manager = newManager()
+	manager.sm.populateChannels(context.Background(), &lnrpc.ListChannelsResponse{})
+
+	assert.Len(t, manager.sm.imbalancedChannels, 0)
+	assert.Len(t, store.loadChannelStates(), 0)
+
+	cleanUp()
+}
+
+func TestHtlcStatesRestore(t *testing.T) {
+	store := openStore(t)
+
+	states := initHtlcStates(&mockHtlcHandler{}, store)
+	states.handleEvent(context.Background(), event)
+
+	// Forwarded HTLCs are not written to the database one by one
+	assert.Len(t, store.loadPendingHtlcs(), 0)
+
+	states.persist()
+
+	restored := initHtlcStates(&mockHtlcHandler{}, store)
+
+	assert.Len(t, restored.pendingHtlcs, 2)
+	assert.Equal(
+		t,
+		event.GetForwardEvent().Info.OutgoingAmtMsat,
+		restored.pendingHtlcs[concatChanIdHtlcId(event.OutgoingChannelId, event.OutgoingHtlcId)].Info.OutgoingAmtMsat,
+	)
+
+	restored.handleEvent(context.Background(), &routerrpc.HtlcEvent{
+		OutgoingChannelId: event.OutgoingChannelId,
+		OutgoingHtlcId:    event.OutgoingHtlcId,
+		Event: &routerrpc.HtlcEvent_LinkFailEvent{
+			LinkFailEvent: &routerrpc.LinkFailEvent{},
+		},
+	})
+	restored.reconcile([]*lnrpc.Channel{
+		{
+			ChanId:       event.IncomingChannelId,
+			PendingHtlcs: []*lnrpc.HTLC{{Incoming: true, HtlcIndex: event.IncomingHtlcId}},
+		},
+	})
+
+	assert.Len(t, store.loadPendingHtlcs(), 1)
+}
+
+func TestNodeCacheRestore(t *testing.T) {
+	store := openStore(t)
+	clock := &utils.Clock{
+		MockTime: time.Now().Truncate(time.Second),
+	}
+
+	nc := initNodeCache(&MockLndClient{nodeAlias: "alias"}, clock, store)
+	assert.Equal(t, "alias", nc.getNodeName(context.Background(), "pubkey"))
+
+	restored := initNodeCache(&MockLndClient{}, clock, store)
+
+	assert.Equal(t, "alias", restored.cache["pubkey"].name)
+	assert.True(t, clock.MockTime.Equal(restored.cache["pubkey"].fetchedAt))
+}
+
+func TestLoadKnownChannel(t *testing.T) {
+	store := openStore(t)
+
+	store.saveKnownChannel("point", &knownChannel{ChanId: 1, Closed: true})
+
+	assert.Equal(t, &knownChannel{ChanId: 1, Closed: true}, store.loadKnownChannel("point"))
+	assert.Nil(t, store.loadKnownChannel("unknown"))
+}
+
+func TestStateStoreDisabled(t *testing.T) {
+	var store *stateStore
+
+	assert.Len(t, store.loadChannelStates(), 0)
+	assert.Len(t, store.loadPendingHtlcs(), 0)
+	assert.Len(t, store.loadNodes(), 0)
+	assert.Nil(t, store.loadKnownChannel("point"))
+
+	store.saveChannelState(1, &channelState{})
+	store.deleteChannelState(1)
+	store.savePendingHtlcs(map[string]*routerrpc.ForwardEvent{"1/0": {}})
+}
@@ -0,0 +1,210 @@
+package templates
+
+import "github.com/BoltzExchange/channel-bot/notifications/providers"
+
+// Prefix of the messages of events that happened while the bot was offline
+const catchUpPrefix = "{{if .CatchUp}}:hourglass: **Missed while offline:** {{end}}"
+
+// Prefix that highlights events by their severity
+const severityPrefix = "{{if eq .Severity \"critical\"}}:rotating_light: {{else if eq .Severity \"warning\"}}:warning: {{end}}"
+
+// Suffix of balance messages that lists the changes of the balance that were not notified
+const suppressedFlipsSuffix = "{{with field . \"Suppressed flips\"}}\n  Suppressed flips: {{.}}{{end}}"
+
+// Suffix of imbalanced messages that shows which limit was breached
+const breachedLimitSuffix = "{{with field . \"Breached limit\"}}\n  Breached limit: {{.}}{{end}}"
+
+// Suffix of the messages of opened and pending channels that lists the details of the channel
+const openedChannelSuffix = ":{{with .Balances}}\n  Capacity: {{sats .Capacity}}{{end}}" +
+	"{{with field . \"Initiator\"}}\n  Initiator: {{.}}{{end}}" +
+	"{{with field . \"Visibility\"}}\n  Visibility: {{.}}{{end}}" +
+	"{{with field . \"Commitment type\"}}\n  Commitment type: {{.}}{{end}}" +
+	"\n  Channel point: `{{field . \"Channel point\"}}`"
+
+// Suffix that lists all fields of the event, like how a channel was closed and what it earned
+const fieldsSuffix = "{{range .Fields}}\n  {{.Name}}: {{.Value}}{{end}}"
+
+// peerBalanceTemplate renders the combined balances of the channels to a peer and the per channel breakdown
+func peerBalanceTemplate(emoji string, info string) string {
+	return emoji + " Peer **{{alias .Peer}}** is **" + info + "** " + emoji + " :\n" +
+		"  Local: {{.Balances.Local}}\n" +
+		"    Minimal: {{.Thresholds.Min}}\n" +
+		"    Maximal: {{.Thresholds.Max}}\n" +
+		"  Remote: {{.Balances.Remote}}" +
+		"{{range .Breakdown}}\n  Channel `{{chanid .ID}}`: {{.Local}} local, {{.Remote}} remote{{end}}"
+}
+
+// The default templates render the messages the bot has always sent
+var defaultTemplates = map[providers.EventType]string{
+	providers.EventStarted:            "Started channel bot with LND node: **{{.Peer.Alias}}** (`{{.Peer.Pubkey}}`)",
+	providers.EventStopped:            "Stopped channel bot",
+	providers.EventConnectionLost:     ":rotating_light: LND connection lost: `{{field . \"Error\"}}`",
+	providers.EventConnectionRestored: ":zap: LND connection restored",
+
+	providers.EventImbalanced: "{{if .Breakdown}}" + peerBalanceTemplate(":rotating_light:", "imbalanced") +
+		"{{else if .Channel.Alias}}" +
+		":rotating_light: Channel **{{.Channel.Alias}}** `{{chanid .Channel.ID}}` is **imbalanced** :rotating_light: :\n" +
+		"  Local: {{.Balances.Local}}\n" +
+		"    Minimal: {{.Thresholds.Min}}\n" +
+		"    Maximal: {{.Thresholds.Max}}\n" +
+		"  Remote: {{.Balances.Remote}}" +
+		"{{else}}" +
+		"Channel `{{chanid .Channel.ID}}` to `{{alias .Peer}}` is **imbalanced**:\n" +
+		"  Local: {{.Balances.Local}}\n" +
+		"  Remote: {{.Balances.Remote}}" +
+		"{{end}}" + breachedLimitSuffix + suppressedFlipsSuffix,
+	providers.EventBalanced: "{{if .Breakdown}}" + peerBalanceTemplate(":zap:", "balanced again") +
+		"{{else if .Channel.Alias}}" +
+		":zap: Channel **{{.Channel.Alias}}** `{{chanid .Channel.ID}}` is **balanced again** :zap: :\n" +
+		"  Local: {{.Balances.Local}}\n" +
+		"    Minimal: {{.Thresholds.Min}}\n" +
+		"    Maximal: {{.Thresholds.Max}}\n" +
+		"  Remote: {{.Balances.Remote}}" +
+		"{{else}}" +
+		"Channel `{{chanid .Channel.ID}}` to `{{alias .Peer}}` is **balanced again**:\n" +
+		"  Local: {{.Balances.Local}}\n" +
+		"  Remote: {{.Balances.Remote}}" +
+		"{{end}}" + suppressedFlipsSuffix,
+	providers.EventSignificantNotFound: ":rotating_light: Channel **{{.Channel.Alias}}** " +
+		"{{if .Channel.ID}}`{{chanid .Channel.ID}}`{{else if .Peer}}to `{{.Peer.Pubkey}}`{{else}}`{{field . \"Channel point\"}}`{{end}} " +
+		"couldn't be found :rotating_light:",
+
+	providers.EventPendingOpen: "Funding transaction of channel {{if .Peer}}to `{{alias .Peer}}` {{end}}was broadcast" +
+		openedChannelSuffix + "{{with field . \"Confirmation updates\"}}\n  Confirmation updates: {{.}}{{end}}",
+	providers.EventFundingConfirmation: "Funding transaction of channel to `{{alias .Peer}}` has " +
+		"**{{field . \"Confirmations\"}}** confirmations" + openedChannelSuffix,
+	providers.EventOpened: catchUpPrefix + "Channel `{{chanid .Channel.ID}}` to `{{alias .Peer}}` was opened" +
+		"{{if not .CatchUp}} and is usable{{end}}" + openedChannelSuffix,
+	providers.EventClosed: catchUpPrefix + severityPrefix +
+		"Channel `{{chanid .Channel.ID}}` to `{{alias .Peer}}` was " +
+		"{{with field . \"Close type\"}}{{if eq . \"abandoned\"}}**abandoned**{{else if eq . \"funding canceled\"}}" +
+		"**canceled** before its funding confirmed{{else}}closed{{end}}{{else}}closed{{end}}" +
+		"{{if .Fields}}:{{end}}" + fieldsSuffix,
+	providers.EventForceClosed: catchUpPrefix + "Channel `{{chanid .Channel.ID}}` to `{{alias .Peer}}` was **force closed** :rotating_light:" +
+		"{{if .Fields}} :{{end}}" + fieldsSuffix,
+	providers.EventCloseMilestone: "Force close of channel {{if .Channel}}`{{chanid .Channel.ID}}` {{end}}" +
+		"to `{{alias .Peer}}`: **{{field . \"Milestone\"}}**:\n" +
+		"  Closing transaction: `{{field . \"Closing transaction\"}}`" +
+		"{{range .Fields}}{{if and (ne .Name \"Milestone\") (ne .Name \"Channel point\") (ne .Name \"Closing transaction\")}}" +
+		"\n  {{.Name}}: {{.Value}}{{end}}{{end}}",
+	providers.EventFullyResolved: "Channel {{if .Channel}}`{{chanid .Channel.ID}}` to `{{alias .Peer}}`" +
+		"{{else}}`{{field . \"Channel point\"}}`{{end}} was fully resolved on-chain",
+
+	providers.EventLockedFunds: ":lock: **{{field . \"Locked balance\"}}** are locked in closing channels:" +
+		"{{range .Fields}}{{if ne .Name \"Locked balance\"}}\n  {{.Name}}: {{.Value}}{{end}}{{end}}",
+
+	providers.EventInactive: ":rotating_light: Channel {{with .Channel.Alias}}**{{.}}** {{end}}`{{chanid .Channel.ID}}` " +
+		"to `{{alias .Peer}}` is **inactive** for {{field . \"Inactive for\"}} :rotating_light:",
+	providers.EventActive: ":zap: Channel {{with .Channel.Alias}}**{{.}}** {{end}}`{{chanid .Channel.ID}}` " +
+		"to `{{alias .Peer}}` is **active** again after {{field . \"Inactive for\"}}",
+
+	providers.EventCondition: severityPrefix + "{{field . \"Alert\"}}: channel {{with .Channel.Alias}}**{{.}}** {{end}}" +
+		"`{{chanid .Channel.ID}}` to `{{alias .Peer}}`:\n" +
+		"  Local: {{.Balances.Local}}\n" +
+		"  Remote: {{.Balances.Remote}}",
+
+	providers.EventZombieClose: "{{if eq (field . \"Close type\") \"cooperative\"}}Cooperatively closing{{else}}Force closing{{end}} " +
+		"{{if .Channel.Private}}private{{else}}public{{end}} channel `{{chanid .Channel.ID}}` " +
+		"to `{{alias .Peer}}` because it was inactive for {{field . \"Inactive for\"}}{{with field . \"Reason\"}} ({{.}}){{end}}",
+	providers.EventZombieCloseUpdate: "{{if field . \"Error\"}}:rotating_light: Closing inactive channel `{{chanid .Channel.ID}}` " +
+		"to `{{alias .Peer}}` **failed**: {{field . \"Error\"}} :rotating_light:{{else}}Closing transaction of " +
+		"{{field . \"Close type\"}} close of inactive channel `{{chanid .Channel.ID}}` to `{{alias .Peer}}` was " +
+		"**{{field . \"Status\"}}**: `{{field . \"Closing transaction\"}}`{{end}}",
+	providers.EventZombieReconnect: "{{if eq (field . \"Status\") \"active\"}}:zap: Inactive channel `{{chanid .Channel.ID}}` to " +
+		"`{{alias .Peer}}` is **active** again after reconnecting and is not closed{{else if field . \"Error\"}}Could not " +
+		"reconnect to `{{alias .Peer}}` before closing its inactive channels: {{field . \"Error\"}}{{else}}Reconnected to " +
+		"`{{alias .Peer}}` at `{{field . \"Address\"}}`, its inactive channels have {{field . \"Grace period\"}} " +
+		"to become active again{{end}}",
+}
+
+// eventParts are the parts of an event that can be missing
+type eventParts struct {
+	channel    bool
+	peer       bool
+	balances   bool
+	thresholds bool
+}
+
+// requiredParts are the parts that events of the type always have. Everything else is missing for some of them,
+// like the channel of closes whose channel has no ID or of imbalanced peers
+var requiredParts = map[providers.EventType]eventParts{
+	providers.EventStarted:             {peer: true},
+	providers.EventImbalanced:          {peer: true, balances: true, thresholds: true},
+	providers.EventBalanced:            {peer: true, balances: true, thresholds: true},
+	providers.EventSignificantNotFound: {channel: true},
+	providers.EventFundingConfirmation: {peer: true, balances: true},
+	providers.EventOpened:              {channel: true, peer: true, balances: true},
+	providers.EventClosed:              {channel: true, peer: true},
+	providers.EventForceClosed:         {channel: true, peer: true},
+	providers.EventCloseMilestone:      {peer: true},
+	providers.EventInactive:            {channel: true, peer: true},
+	providers.EventActive:              {channel: true, peer: true},
+	providers.EventCondition:           {channel: true, peer: true, balances: true},
+	providers.EventZombieClose:         {channel: true, peer: true},
+	providers.EventZombieCloseUpdate:   {channel: true, peer: true},
+	providers.EventZombieReconnect:     {peer: true},
+}
+
+// sampleEvents returns the samples against which templates of the event type are validated:
+// one with all fields populated and one that has only the parts that events of the type always have
+func sampleEvents(eventType providers.EventType) []*providers.Event {
+	full := *sampleEvent
+	full.Type = eventType
+
+	required := requiredParts[eventType]
+
+	partial := full
+	partial.Breakdown = sampleBreakdown
+
+	if !required.channel {
+		partial.Channel = nil
+	}
+	if !required.peer {
+		partial.Peer = nil
+	}
+	if !required.balances {
+		partial.Balances = nil
+	}
+	if !required.thresholds {
+		partial.Thresholds = nil
+	}
+
+	return []*providers.Event{&full, &partial}
+}
+
+// Events about all channels to a peer have the balances of the single channels instead of a channel
+var sampleBreakdown = []*providers.ChannelBalance{
+	{
+		ID: 619899158240231424,
+		Balances: providers.Balances{
+			Local:    1000000,
+			Remote:   9000000,
+			Capacity: 10000000,
+		},
+	},
+}
+
+// sampleEvent has all fields populated to be able to validate templates at startup
+var sampleEvent = &providers.Event{
+	Severity: providers.SeverityInfo,
+	Title:    "Sample",
+	Message:  "Sample",
+	Channel: &providers.Channel{
+		ID:      619899158240231424,
+		Alias:   "sample",
+		Private: true,
+	},
+	Peer: &providers.Peer{
+		Pubkey: "03793e5deff6c3acc0558440bf04ffd6ea2adebd8eb50246b98a8d27abbf79539a",
+		Alias:  "sample",
+	},
+	Balances: &providers.Balances{
+		Local:    1000000,
+		Remote:   9000000,
+		Capacity: 10000000,
+	},
+	Thresholds: &providers.Thresholds{
+		Min: 3000000,
+		Max: 7000000,
+	},
+}
@@ -0,0 +1,50 @@
+package templates
+
+import (
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+)
+
+// Renderer renders and logs the messages of events before they are passed on to the provider
+type Renderer struct {
+	provider  providers.NotificationProvider
+	templates *Templates
+}
+
+func NewRenderer(provider providers.NotificationProvider, templates *Templates) *Renderer {
+	return &Renderer{
+		provider:  provider,
+		templates: templates,
+	}
+}
+
+func (r *Renderer) Name() string {
+	return r.provider.Name()
+}
+
+func (r *Renderer) Init() error {
+	return r.provider.Init()
+}
+
+func (r *Renderer) SendMessage(message string) error {
+	logger.Info(message)
+	return r.provider.SendMessage(message)
+}
+
+func (r *Renderer) SendEvent(event *providers.Event) error {
+	message, err := r.templates.Render(event)
+
+	if err != nil {
+		logger.Warning("Could not render message of " + string(event.Type) + " event: " + err.Error())
+		message = providers.RenderText(event)
+	}
+
+	event.Message = message
+
+	logger.Info(message)
+	return r.provider.SendEvent(event)
+}
+
+func (r *Renderer) Close() error {
+	return r.provider.Close()
+}
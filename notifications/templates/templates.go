@@ -0,0 +1,140 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// Templates render the messages of notification events
+type Templates struct {
+	templates map[providers.EventType]*template.Template
+}
+
+var funcs = template.FuncMap{
+	"sats":   providers.FormatSats,
+	"ratio":  formatRatio,
+	"chanid": formatChannelID,
+	"scid":   formatShortChannelID,
+	"alias":  formatAlias,
+	"field":  getField,
+}
+
+// Parse parses the default templates and the overrides, which are keyed by event type.
+// Overrides that cannot be parsed or rendered are rejected
+func Parse(overrides map[string]string) (*Templates, error) {
+	t := &Templates{
+		templates: map[providers.EventType]*template.Template{},
+	}
+
+	for eventType, text := range defaultTemplates {
+		parsed, err := parse(eventType, text)
+		if err != nil {
+			return nil, err
+		}
+
+		t.templates[eventType] = parsed
+	}
+
+	for name, text := range overrides {
+		eventTypes, err := providers.ParseEventTypes([]string{name})
+		if err != nil {
+			return nil, err
+		}
+
+		for eventType := range eventTypes {
+			parsed, err := parse(eventType, text)
+			if err != nil {
+				return nil, err
+			}
+
+			t.templates[eventType] = parsed
+		}
+	}
+
+	return t, nil
+}
+
+// Default returns the templates that render the default messages
+func Default() *Templates {
+	t, err := Parse(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func (t *Templates) Render(event *providers.Event) (string, error) {
+	tmpl := t.templates[event.Type]
+	if tmpl == nil {
+		return "", errors.New("no template for event type: " + string(event.Type))
+	}
+
+	var rendered bytes.Buffer
+
+	if err := tmpl.Execute(&rendered, event); err != nil {
+		return "", err
+	}
+
+	return rendered.String(), nil
+}
+
+func parse(eventType providers.EventType, text string) (*template.Template, error) {
+	parsed, err := template.New(string(eventType)).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template of %s: %s", eventType, err)
+	}
+
+	for _, sample := range sampleEvents(eventType) {
+		if err := parsed.Execute(&bytes.Buffer{}, sample); err != nil {
+			return nil, fmt.Errorf("could not render template of %s: %s", eventType, err)
+		}
+	}
+
+	return parsed, nil
+}
+
+func formatRatio(amount int64, total int64) string {
+	if total == 0 {
+		return "0.00"
+	}
+
+	return strconv.FormatFloat(float64(amount)/float64(total), 'f', 2, 64)
+}
+
+func formatChannelID(channelId uint64) string {
+	return strconv.FormatUint(channelId, 10)
+}
+
+func formatShortChannelID(channelId uint64) string {
+	return lnwire.NewShortChanIDFromInt(channelId).String()
+}
+
+func formatAlias(peer *providers.Peer) string {
+	if peer == nil {
+		return ""
+	}
+
+	if peer.Alias != "" {
+		return peer.Alias
+	}
+
+	return peer.Pubkey
+}
+
+func getField(event *providers.Event, name string) string {
+	for _, field := range event.Fields {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+
+	return ""
+}
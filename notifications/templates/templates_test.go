@@ -0,0 +1,138 @@
+package templates
+
+import (
+	"io"
+	"testing"
+
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockProvider struct {
+	events []*providers.Event
+}
+
+func (m *mockProvider) Name() string {
+	return "Mock"
+}
+
+func (m *mockProvider) Init() error {
+	return nil
+}
+
+func (m *mockProvider) SendMessage(string) error {
+	return nil
+}
+
+func (m *mockProvider) SendEvent(event *providers.Event) error {
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *mockProvider) Close() error {
+	return nil
+}
+
+func closedEvent() *providers.Event {
+	return &providers.Event{
+		Type:     providers.EventClosed,
+		Severity: providers.SeverityInfo,
+		Title:    "Channel to node was closed",
+		Channel: &providers.Channel{
+			ID: 619899158240231424,
+		},
+		Peer: &providers.Peer{
+			Pubkey: "pubkey",
+			Alias:  "node",
+		},
+		Balances: &providers.Balances{
+			Local:    2500000,
+			Capacity: 10000000,
+		},
+		Fields: []*providers.Field{
+			{Name: "Close type", Value: "cooperative close"},
+		},
+	}
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	tmpls := Default()
+
+	for _, eventType := range providers.EventTypes {
+		assert.Contains(t, tmpls.templates, eventType, "No default template for "+string(eventType))
+	}
+
+	message, err := tmpls.Render(closedEvent())
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Channel `619899158240231424` to `node` was closed:\n  Close type: cooperative close", message)
+}
+
+func TestParseOverrides(t *testing.T) {
+	tmpls, err := Parse(map[string]string{
+		"Closed": "{{scid .Channel.ID}} to {{alias .Peer}}: {{with .Balances}}{{sats .Local}} ({{ratio .Local .Capacity}}){{end}}, {{field . \"close type\"}}",
+	})
+
+	assert.Nil(t, err)
+
+	message, err := tmpls.Render(closedEvent())
+
+	assert.Nil(t, err)
+	assert.Equal(t, "563795:889:0 to node: 2,500,000 sats (0.25), cooperative close", message)
+
+	// Event types without override still use the default template
+	message, err = tmpls.Render(&providers.Event{Type: providers.EventStopped})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Stopped channel bot", message)
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse(map[string]string{"notanevent": "message"})
+	assert.Equal(t, "unknown event type: notanevent", err.Error())
+
+	_, err = Parse(map[string]string{"closed": "{{.Channel.ID"})
+	assert.ErrorContains(t, err, "could not parse template of closed")
+
+	_, err = Parse(map[string]string{"closed": "{{.Channel.Unknown}}"})
+	assert.ErrorContains(t, err, "could not render template of closed")
+
+	// Templates have to handle the parts that events of the type do not always have
+	_, err = Parse(map[string]string{"closed": "{{sats .Balances.Local}}"})
+	assert.ErrorContains(t, err, "could not render template of closed")
+
+	_, err = Parse(map[string]string{"fully_resolved": "{{chanid .Channel.ID}}"})
+	assert.ErrorContains(t, err, "could not render template of fully_resolved")
+
+	_, err = Parse(map[string]string{"fully_resolved": "{{if .Channel}}{{chanid .Channel.ID}}{{end}}"})
+	assert.Nil(t, err)
+}
+
+func TestFormatAlias(t *testing.T) {
+	assert.Equal(t, "", formatAlias(nil))
+	assert.Equal(t, "pubkey", formatAlias(&providers.Peer{Pubkey: "pubkey"}))
+	assert.Equal(t, "node", formatAlias(&providers.Peer{Pubkey: "pubkey", Alias: "node"}))
+}
+
+func TestFormatRatio(t *testing.T) {
+	assert.Equal(t, "0.00", formatRatio(1, 0))
+	assert.Equal(t, "0.33", formatRatio(1, 3))
+}
+
+func TestRenderer(t *testing.T) {
+	logger.Init("", false, false, io.Discard)
+
+	provider := &mockProvider{}
+	renderer := NewRenderer(provider, Default())
+
+	assert.Nil(t, renderer.SendEvent(closedEvent()))
+	assert.Equal(t, "Channel `619899158240231424` to `node` was closed:\n  Close type: cooperative close", provider.events[0].Message)
+
+	// Falls back to the plain text rendering if the template cannot be rendered
+	event := closedEvent()
+	event.Channel = nil
+
+	assert.Nil(t, renderer.SendEvent(event))
+	assert.Equal(t, providers.RenderText(event), provider.events[1].Message)
+}
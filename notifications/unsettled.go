@@ -0,0 +1,83 @@
+package notifications
+
+import (
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/protobuf/proto"
+	"time"
+)
+
+// balanceOutcomes returns the balances of the channel for when all pending HTLCs settle in the direction in which
+// they were moving and for when all of them fail. Channels without pending HTLCs only have one outcome
+func balanceOutcomes(channel *lnrpc.Channel) []*lnrpc.Channel {
+	if len(channel.PendingHtlcs) == 0 {
+		return []*lnrpc.Channel{channel}
+	}
+
+	optimistic := proto.Clone(channel).(*lnrpc.Channel)
+	pessimistic := proto.Clone(channel).(*lnrpc.Channel)
+
+	for _, htlc := range channel.PendingHtlcs {
+		if htlc.Incoming {
+			optimistic.LocalBalance += htlc.Amount
+			pessimistic.RemoteBalance += htlc.Amount
+		} else {
+			optimistic.RemoteBalance += htlc.Amount
+			pessimistic.LocalBalance += htlc.Amount
+		}
+	}
+
+	return []*lnrpc.Channel{optimistic, pessimistic}
+}
+
+// checkOutcomes returns whether the channel is imbalanced and the outcome that should be shown in notifications.
+// While HTLCs are pending, all outcomes have to breach a limit, unless the channel has been unsettled for too long
+func (r ratios) checkOutcomes(channel *lnrpc.Channel, wasImbalanced bool, unsettledTooLong bool) (bool, *lnrpc.Channel) {
+	outcomes := balanceOutcomes(channel)
+
+	var breached []*lnrpc.Channel
+
+	for _, outcome := range outcomes {
+		if r.breachedLimit(outcome, wasImbalanced) != "" {
+			breached = append(breached, outcome)
+		}
+	}
+
+	if len(breached) == len(outcomes) || (unsettledTooLong && len(breached) != 0) {
+		return true, breached[0]
+	}
+
+	return false, outcomes[0]
+}
+
+// isUnsettledTooLong tracks since when the channel has been unsettled and returns whether that was longer
+// than the timeout ago
+func isUnsettledTooLong[K comparable](
+	unsettledSince map[K]time.Time,
+	key K,
+	channel *lnrpc.Channel,
+	now time.Time,
+	timeout time.Duration,
+) bool {
+	if channel.UnsettledBalance == 0 && len(channel.PendingHtlcs) == 0 {
+		delete(unsettledSince, key)
+		return false
+	}
+
+	since, isTracked := unsettledSince[key]
+
+	if !isTracked {
+		since = now
+		unsettledSince[key] = since
+	}
+
+	return timeout != 0 && now.Sub(since) >= timeout
+}
+
+func unsettledFields(channel *lnrpc.Channel) []*providers.Field {
+	if channel.UnsettledBalance == 0 {
+		return nil
+	}
+
+	return []*providers.Field{{Name: "Unsettled balance", Value: providers.FormatSats(channel.UnsettledBalance)}}
+}
@@ -0,0 +1,181 @@
+package notifications
+
+import (
+	"context"
+	"github.com/BoltzExchange/channel-bot/notifications/providers"
+	"github.com/google/logger"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func unsettledChannel(localBalance int64, remoteBalance int64, htlcs ...*lnrpc.HTLC) *lnrpc.Channel {
+	channel := &lnrpc.Channel{
+		ChanId:        1,
+		RemotePubkey:  "pubkey",
+		Capacity:      100,
+		LocalBalance:  localBalance,
+		RemoteBalance: remoteBalance,
+		PendingHtlcs:  htlcs,
+	}
+
+	for _, htlc := range htlcs {
+		channel.UnsettledBalance += htlc.Amount
+	}
+
+	return channel
+}
+
+func TestBalanceOutcomes(t *testing.T) {
+	settled := unsettledChannel(50, 50)
+	assert.Equal(t, []*lnrpc.Channel{settled}, balanceOutcomes(settled))
+
+	channel := unsettledChannel(20, 50, &lnrpc.HTLC{Incoming: true, Amount: 20}, &lnrpc.HTLC{Incoming: false, Amount: 10})
+	outcomes := balanceOutcomes(channel)
+
+	assert.Len(t, outcomes, 2)
+
+	// The HTLCs settle in the direction they were moving
+	assert.Equal(t, int64(40), outcomes[0].LocalBalance)
+	assert.Equal(t, int64(60), outcomes[0].RemoteBalance)
+
+	// The HTLCs fail and go back
+	assert.Equal(t, int64(30), outcomes[1].LocalBalance)
+	assert.Equal(t, int64(70), outcomes[1].RemoteBalance)
+
+	// The channel itself is not modified
+	assert.Equal(t, int64(20), channel.LocalBalance)
+	assert.Equal(t, int64(50), channel.RemoteBalance)
+}
+
+func TestCheckOutcomes(t *testing.T) {
+	r := ratios{min: 0.3, max: 0.7}
+
+	// Only the pessimistic outcome is imbalanced
+	channel := unsettledChannel(25, 65, &lnrpc.HTLC{Incoming: true, Amount: 10})
+
+	isImbalanced, shown := r.checkOutcomes(channel, false, false)
+	assert.False(t, isImbalanced)
+	assert.Equal(t, int64(35), shown.LocalBalance)
+
+	isImbalanced, shown = r.checkOutcomes(channel, false, true)
+	assert.True(t, isImbalanced)
+	assert.Equal(t, int64(25), shown.LocalBalance)
+
+	// Both outcomes are imbalanced
+	channel = unsettledChannel(10, 80, &lnrpc.HTLC{Incoming: true, Amount: 10})
+
+	isImbalanced, shown = r.checkOutcomes(channel, false, false)
+	assert.True(t, isImbalanced)
+	assert.Equal(t, int64(20), shown.LocalBalance)
+}
+
+func TestIsUnsettledTooLong(t *testing.T) {
+	unsettledSince := map[uint64]time.Time{}
+	now := time.Now()
+
+	channel := unsettledChannel(50, 40, &lnrpc.HTLC{Amount: 10})
+
+	assert.False(t, isUnsettledTooLong(unsettledSince, 1, channel, now, time.Minute))
+	assert.Equal(t, now, unsettledSince[1])
+
+	assert.False(t, isUnsettledTooLong(unsettledSince, 1, channel, now.Add(30*time.Second), time.Minute))
+	assert.True(t, isUnsettledTooLong(unsettledSince, 1, channel, now.Add(time.Minute), time.Minute))
+
+	// Without timeout channels are never unsettled for too long
+	assert.False(t, isUnsettledTooLong(unsettledSince, 1, channel, now.Add(time.Hour), 0))
+
+	// The time is reset once the channel is settled
+	assert.False(t, isUnsettledTooLong(unsettledSince, 1, unsettledChannel(50, 50), now.Add(time.Hour), time.Minute))
+	assert.Empty(t, unsettledSince)
+}
+
+func TestCheckUnsettledChannel(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	sm := newTestManager(&ChannelManager{UnsettledTimeout: 60, logInsignificant: true}, nil).sm
+
+	// Channels with pending HTLCs are checked instead of being skipped
+	sm.checkChannel(context.Background(), unsettledChannel(10, 80, &lnrpc.HTLC{Incoming: true, Amount: 10}))
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, &providers.Balances{Local: 20, Remote: 80, Capacity: 100}, sentEvents[0].Balances)
+	assert.Equal(t, []*providers.Field{
+		{Name: "Breached limit", Value: "Minimal ratio of 0.3"},
+		{Name: "Unsettled balance", Value: "10 sats"},
+	}, sentEvents[0].Fields)
+
+	cleanUp()
+
+	// The channel is balanced again when one of the outcomes is
+	sm.checkChannel(context.Background(), unsettledChannel(40, 40, &lnrpc.HTLC{Incoming: false, Amount: 20}))
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, providers.EventBalanced, sentEvents[0].Type)
+
+	cleanUp()
+
+	// Channels that are imbalanced in only one outcome are notified once they were unsettled for too long
+	pending := unsettledChannel(25, 65, &lnrpc.HTLC{Incoming: true, Amount: 10})
+
+	sm.checkChannel(context.Background(), pending)
+	assert.Len(t, sentEvents, 0)
+
+	sm.clock.MockTime = sm.clock.MockTime.Add(time.Minute)
+	sm.checkChannel(context.Background(), pending)
+
+	assert.Len(t, sentEvents, 1)
+	assert.Equal(t, providers.EventImbalanced, sentEvents[0].Type)
+	assert.Equal(t, &providers.Balances{Local: 25, Remote: 75, Capacity: 100}, sentEvents[0].Balances)
+
+	cleanUp()
+}
+
+func TestResolvePendingHtlc(t *testing.T) {
+	cleanUp()
+
+	mockWriter := &MockWriter{}
+	logger.Init("", false, false, mockWriter)
+
+	sm := newTestManager(&ChannelManager{logInsignificant: true}, nil).sm
+	ctx := context.Background()
+
+	// The HTLCs are pending in the snapshot of the channel
+	channel := unsettledChannel(40, 40, &lnrpc.HTLC{Incoming: true, Amount: 10, HtlcIndex: 7}, &lnrpc.HTLC{Amount: 10, HtlcIndex: 8})
+	sm.channels[channel.ChanId] = channel
+
+	sm.checkChannel(ctx, channel)
+	assert.Contains(t, sm.unsettledChannels, channel.ChanId)
+
+	// The settled HTLC is only counted once
+	sm.handleHtlc(ctx, channel.ChanId, 7, true, 10000)
+
+	assert.Equal(t, int64(50), channel.LocalBalance)
+	assert.Equal(t, int64(40), channel.RemoteBalance)
+	assert.Equal(t, int64(10), channel.UnsettledBalance)
+	assert.Len(t, channel.PendingHtlcs, 1)
+
+	outcomes := balanceOutcomes(channel)
+	assert.Equal(t, int64(50), outcomes[0].LocalBalance)
+	assert.Equal(t, int64(50), outcomes[0].RemoteBalance)
+	assert.Equal(t, int64(60), outcomes[1].LocalBalance)
+
+	// Incoming and outgoing HTLCs are indexed separately
+	sm.handleFailedHtlc(ctx, channel.ChanId, 8, true)
+	assert.Len(t, channel.PendingHtlcs, 1)
+
+	// The unsettled timer stops once the last HTLC failed, whose amount goes back to the sending side
+	sm.handleFailedHtlc(ctx, channel.ChanId, 8, false)
+
+	assert.Equal(t, int64(60), channel.LocalBalance)
+	assert.Equal(t, int64(40), channel.RemoteBalance)
+	assert.Empty(t, channel.PendingHtlcs)
+	assert.Equal(t, int64(0), channel.UnsettledBalance)
+	assert.NotContains(t, sm.unsettledChannels, channel.ChanId)
+
+	cleanUp()
+}